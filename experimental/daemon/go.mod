@@ -4,5 +4,6 @@ go 1.21
 
 require (
 	github.com/gorilla/mux v1.8.1
+	golang.org/x/crypto v0.21.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,105 @@
+// Package apps reads wild-cloud app manifests and manages the secrets they
+// require.
+package apps
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFile is the name of the manifest in each app directory
+const ManifestFile = "manifest.yaml"
+
+// Manifest is the part of an app's manifest.yaml the daemon uses
+type Manifest struct {
+	Name            string       `yaml:"name" json:"name"`
+	Description     string       `yaml:"description" json:"description"`
+	Version         string       `yaml:"version" json:"version"`
+	Install         bool         `yaml:"install" json:"install"`
+	RequiredSecrets []SecretSpec `yaml:"requiredSecrets" json:"requiredSecrets"`
+}
+
+// SecretSpec is one entry of requiredSecrets. It is either a plain dotted
+// path or a mapping with the path and a generation policy:
+//
+//	requiredSecrets:
+//	  - apps.immich.dbPassword
+//	  - path: apps.immich.jwtSecret
+//	    format: hex
+//	    length: 32
+type SecretSpec struct {
+	Path   string `yaml:"path" json:"path"`
+	Policy `yaml:",inline"`
+}
+
+// UnmarshalYAML accepts both the short and the policy form of a secret
+func (s *SecretSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = SecretSpec{Path: node.Value}
+		return nil
+	}
+
+	type plain SecretSpec
+	var spec plain
+	if err := node.Decode(&spec); err != nil {
+		return err
+	}
+	if spec.Path == "" {
+		return fmt.Errorf("line %d: required secret has no path", node.Line)
+	}
+	*s = SecretSpec(spec)
+	return nil
+}
+
+// LoadManifest reads the manifest of the app in dir
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Join(dir, ManifestFile), err)
+	}
+	if manifest.Name == "" {
+		manifest.Name = filepath.Base(dir)
+	}
+	for _, spec := range manifest.RequiredSecrets {
+		if err := spec.Policy.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: secret %s: %w", manifest.Name, spec.Path, err)
+		}
+	}
+	return &manifest, nil
+}
+
+// LoadManifests reads the manifest of every app under appsDir, sorted by
+// name. Directories without a manifest are skipped.
+func LoadManifests(appsDir string) ([]*Manifest, error) {
+	entries, err := os.ReadDir(appsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading apps directory: %w", err)
+	}
+
+	var manifests []*Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := LoadManifest(filepath.Join(appsDir, entry.Name()))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Name < manifests[j].Name })
+	return manifests, nil
+}
@@ -0,0 +1,90 @@
+package apps
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, appsDir, app, content string) {
+	t.Helper()
+	dir := filepath.Join(appsDir, app)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadManifests(t *testing.T) {
+	appsDir := t.TempDir()
+	writeManifest(t, appsDir, "immich", `name: immich
+description: Photo library
+requiredSecrets:
+  - apps.immich.dbPassword
+  - path: apps.immich.jwtSecret
+    format: hex
+    length: 32
+`)
+	// The directory name stands in for a missing name
+	writeManifest(t, appsDir, "ghost", "install: true\n")
+	if err := os.MkdirAll(filepath.Join(appsDir, "no-manifest"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(appsDir, "README.md"), []byte("# Apps\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, err := LoadManifests(appsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Manifest{
+		{Name: "ghost", Install: true},
+		{
+			Name:        "immich",
+			Description: "Photo library",
+			RequiredSecrets: []SecretSpec{
+				{Path: "apps.immich.dbPassword"},
+				{Path: "apps.immich.jwtSecret", Policy: Policy{Format: FormatHex, Length: 32}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(manifests, want) {
+		t.Errorf("manifests = %+v, want %+v", manifests, want)
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		message string
+	}{
+		"secret without a path": {
+			content: "requiredSecrets:\n  - format: hex\n",
+			message: "has no path",
+		},
+		"invalid policy": {
+			content: "requiredSecrets:\n  - path: apps.a.key\n    length: 8\n",
+			message: "secret apps.a.key: length must be at least",
+		},
+		"invalid YAML": {
+			content: "requiredSecrets: [\n",
+			message: "parsing",
+		},
+	}
+	for name, tt := range tests {
+		appsDir := t.TempDir()
+		writeManifest(t, appsDir, "a", tt.content)
+		if _, err := LoadManifests(appsDir); err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: err = %v, want one containing %q", name, err, tt.message)
+		}
+	}
+
+	if _, err := LoadManifests(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("loaded manifests from a missing directory")
+	}
+}
@@ -0,0 +1,110 @@
+package apps
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// Secret formats a policy can ask for
+const (
+	FormatAlphanumeric = "alphanumeric"
+	FormatHex          = "hex"
+	FormatBase64       = "base64"
+	FormatBase64URL    = "base64url"
+)
+
+// DefaultLength is used when a policy does not set a length
+const DefaultLength = 32
+
+// minLength keeps generated secrets from being trivially guessable
+const minLength = 16
+
+const alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// Policy describes how to generate a secret. For alphanumeric secrets and
+// custom alphabets Length is the number of characters; for hex and base64 it
+// is the number of random bytes before encoding.
+type Policy struct {
+	Length   int    `yaml:"length,omitempty" json:"length,omitempty"`
+	Format   string `yaml:"format,omitempty" json:"format,omitempty"`
+	Alphabet string `yaml:"alphabet,omitempty" json:"alphabet,omitempty"`
+}
+
+// Validate checks that the policy can be used to generate a secret
+func (p Policy) Validate() error {
+	if p.Length != 0 && p.Length < minLength {
+		return fmt.Errorf("length must be at least %d", minLength)
+	}
+	switch p.Format {
+	case "", FormatAlphanumeric:
+	case FormatHex, FormatBase64, FormatBase64URL:
+		if p.Alphabet != "" {
+			return fmt.Errorf("alphabet cannot be combined with format %s", p.Format)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", p.Format)
+	}
+	if p.Alphabet != "" && len(uniqueRunes(p.Alphabet)) < 2 {
+		return fmt.Errorf("alphabet must have at least two distinct characters")
+	}
+	return nil
+}
+
+// Generate returns a new random secret following the policy
+func (p Policy) Generate() (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	length := p.Length
+	if length == 0 {
+		length = DefaultLength
+	}
+
+	switch p.Format {
+	case FormatHex, FormatBase64, FormatBase64URL:
+		raw := make([]byte, length)
+		if _, err := rand.Read(raw); err != nil {
+			return "", err
+		}
+		switch p.Format {
+		case FormatHex:
+			return hex.EncodeToString(raw), nil
+		case FormatBase64:
+			return base64.StdEncoding.EncodeToString(raw), nil
+		default:
+			return base64.RawURLEncoding.EncodeToString(raw), nil
+		}
+	}
+
+	alphabet := []rune(alphanumeric)
+	if p.Alphabet != "" {
+		alphabet = uniqueRunes(p.Alphabet)
+	}
+	out := make([]rune, length)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range out {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = alphabet[n.Int64()]
+	}
+	return string(out), nil
+}
+
+// uniqueRunes returns the distinct characters of s in order, so a repeated
+// character does not skew the distribution
+func uniqueRunes(s string) []rune {
+	seen := make(map[rune]bool)
+	var out []rune
+	for _, r := range s {
+		if !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+	return out
+}
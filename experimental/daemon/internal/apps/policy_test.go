@@ -0,0 +1,98 @@
+package apps
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPolicyGenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		check  func(string) bool
+	}{
+		{
+			name:   "default",
+			policy: Policy{},
+			check: func(s string) bool {
+				return len(s) == DefaultLength && strings.Trim(s, alphanumeric) == ""
+			},
+		},
+		{
+			name:   "alphanumeric length",
+			policy: Policy{Format: FormatAlphanumeric, Length: 20},
+			check: func(s string) bool {
+				return len(s) == 20 && strings.Trim(s, alphanumeric) == ""
+			},
+		},
+		{
+			name:   "hex counts bytes",
+			policy: Policy{Format: FormatHex, Length: 16},
+			check: func(s string) bool {
+				raw, err := hex.DecodeString(s)
+				return err == nil && len(raw) == 16
+			},
+		},
+		{
+			name:   "base64",
+			policy: Policy{Format: FormatBase64},
+			check: func(s string) bool {
+				raw, err := base64.StdEncoding.DecodeString(s)
+				return err == nil && len(raw) == DefaultLength
+			},
+		},
+		{
+			name:   "base64url",
+			policy: Policy{Format: FormatBase64URL, Length: 24},
+			check: func(s string) bool {
+				raw, err := base64.RawURLEncoding.DecodeString(s)
+				return err == nil && len(raw) == 24
+			},
+		},
+		{
+			name:   "custom alphabet",
+			policy: Policy{Alphabet: "aabé", Length: 64},
+			check: func(s string) bool {
+				return len([]rune(s)) == 64 && strings.Trim(s, "abé") == ""
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := tt.policy.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(first) {
+				t.Errorf("Generate = %q does not match the policy", first)
+			}
+			second, err := tt.policy.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first == second {
+				t.Errorf("Generate returned %q twice", first)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	invalid := map[string]Policy{
+		"too short":                 {Length: minLength - 1},
+		"unknown format":            {Format: "uuid"},
+		"alphabet with hex":         {Format: FormatHex, Alphabet: "abc"},
+		"single character alphabet": {Alphabet: "aaaa"},
+	}
+	for name, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("%s: %+v is valid", name, policy)
+		}
+		if _, err := policy.Generate(); err == nil {
+			t.Errorf("%s: generated a secret from %+v", name, policy)
+		}
+	}
+}
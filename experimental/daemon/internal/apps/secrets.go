@@ -0,0 +1,120 @@
+package apps
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"wild-cloud-central/internal/secrets"
+)
+
+// Secret states reported by Check
+const (
+	StatusSet         = "set"
+	StatusMissing     = "missing"
+	StatusPlaceholder = "placeholder"
+)
+
+// PlaceholderPrefix marks the dummy values wild-app-add scaffolds
+const PlaceholderPrefix = "CHANGE_ME"
+
+// SecretStatus reports whether one required secret has a real value
+type SecretStatus struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Policy Policy `json:"policy"`
+}
+
+// AppSecrets lists the state of every secret an app requires
+type AppSecrets struct {
+	App     string         `json:"app"`
+	Secrets []SecretStatus `json:"secrets"`
+}
+
+// Unset reports whether any of the app's secrets still needs a value
+func (a AppSecrets) Unset() bool {
+	for _, secret := range a.Secrets {
+		if secret.Status != StatusSet {
+			return true
+		}
+	}
+	return false
+}
+
+// Check looks up every secret the manifests require
+func Check(manifests []*Manifest, store *secrets.Store) ([]AppSecrets, error) {
+	report := make([]AppSecrets, 0, len(manifests))
+	for _, manifest := range manifests {
+		app := AppSecrets{App: manifest.Name, Secrets: []SecretStatus{}}
+		for _, spec := range manifest.RequiredSecrets {
+			status, err := secretStatus(store, spec.Path)
+			if err != nil {
+				return nil, err
+			}
+			app.Secrets = append(app.Secrets, SecretStatus{Path: spec.Path, Status: status, Policy: spec.Policy})
+		}
+		report = append(report, app)
+	}
+	return report, nil
+}
+
+// Generate stores a new random value for every missing or placeholder secret
+// the manifests require and returns the paths it generated. Secrets that
+// already have a real value are never replaced. When several apps require
+// the same secret the first manifest's policy is used.
+func Generate(manifests []*Manifest, store *secrets.Store) ([]string, error) {
+	generated := []string{}
+	done := make(map[string]bool)
+	for _, manifest := range manifests {
+		for _, spec := range manifest.RequiredSecrets {
+			if done[spec.Path] {
+				continue
+			}
+			done[spec.Path] = true
+
+			status, err := secretStatus(store, spec.Path)
+			if err != nil {
+				return generated, err
+			}
+			if status == StatusSet {
+				continue
+			}
+
+			value, err := spec.Policy.Generate()
+			if err != nil {
+				return generated, fmt.Errorf("generating %s: %w", spec.Path, err)
+			}
+			if err := store.Set(spec.Path, value); err != nil {
+				return generated, fmt.Errorf("storing %s: %w", spec.Path, err)
+			}
+			generated = append(generated, spec.Path)
+		}
+	}
+	return generated, nil
+}
+
+// secretStatus classifies the current value of a secret
+func secretStatus(store *secrets.Store, path string) (string, error) {
+	value, err := store.Get(path)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return StatusMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return StatusMissing, nil
+	case string:
+		if v == "" {
+			return StatusMissing, nil
+		}
+		if strings.HasPrefix(v, PlaceholderPrefix) {
+			return StatusPlaceholder, nil
+		}
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("secret %s is not a single value", path)
+	}
+	return StatusSet, nil
+}
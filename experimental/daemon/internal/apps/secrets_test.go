@@ -0,0 +1,116 @@
+package apps
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"wild-cloud-central/internal/secrets"
+)
+
+// testManifests returns two apps that share the database password
+func testManifests() []*Manifest {
+	return []*Manifest{
+		{
+			Name: "immich",
+			RequiredSecrets: []SecretSpec{
+				{Path: "apps.immich.dbPassword"},
+				{Path: "apps.shared.dbPassword", Policy: Policy{Format: FormatHex, Length: 16}},
+				{Path: "apps.immich.apiKey"},
+			},
+		},
+		{
+			Name: "ghost",
+			RequiredSecrets: []SecretSpec{
+				{Path: "apps.shared.dbPassword", Policy: Policy{Length: 64}},
+			},
+		},
+	}
+}
+
+func newTestStore(t *testing.T) *secrets.Store {
+	t.Helper()
+	store := secrets.NewStore(filepath.Join(t.TempDir(), "secrets.yaml"))
+	if err := store.Set("apps.immich.dbPassword", "CHANGE_ME_db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("apps.immich.apiKey", "real-api-key"); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func statuses(report []AppSecrets) map[string]map[string]string {
+	out := map[string]map[string]string{}
+	for _, app := range report {
+		out[app.App] = map[string]string{}
+		for _, secret := range app.Secrets {
+			out[app.App][secret.Path] = secret.Status
+		}
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	report, err := Check(testManifests(), newTestStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		"immich": {
+			"apps.immich.dbPassword": StatusPlaceholder,
+			"apps.shared.dbPassword": StatusMissing,
+			"apps.immich.apiKey":     StatusSet,
+		},
+		"ghost": {"apps.shared.dbPassword": StatusMissing},
+	}
+	if got := statuses(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %v, want %v", got, want)
+	}
+	if !report[0].Unset() || !report[1].Unset() {
+		t.Error("apps with missing secrets are not reported as unset")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	store := newTestStore(t)
+	generated, err := Generate(testManifests(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"apps.immich.dbPassword", "apps.shared.dbPassword"}; !reflect.DeepEqual(generated, want) {
+		t.Errorf("generated = %v, want %v", generated, want)
+	}
+
+	// Real values are kept and a shared secret follows the first policy
+	if value, err := store.Get("apps.immich.apiKey"); err != nil || value != "real-api-key" {
+		t.Errorf("apiKey = %v (%v), want it kept", value, err)
+	}
+	if value, err := store.Get("apps.shared.dbPassword"); err != nil || len(value.(string)) != 32 {
+		t.Errorf("shared password = %v (%v), want 16 hex-encoded bytes", value, err)
+	}
+
+	report, err := Check(testManifests(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, app := range report {
+		if app.Unset() {
+			t.Errorf("%s still has unset secrets: %+v", app.App, app.Secrets)
+		}
+	}
+
+	// Running again generates nothing
+	generated, err = Generate(testManifests(), store)
+	if err != nil || len(generated) != 0 {
+		t.Errorf("second Generate = %v (%v), want nothing", generated, err)
+	}
+}
+
+func TestCheckRejectsNestedSecret(t *testing.T) {
+	store := newTestStore(t)
+	manifests := []*Manifest{{Name: "immich", RequiredSecrets: []SecretSpec{{Path: "apps.immich"}}}}
+	if _, err := Check(manifests, store); err == nil {
+		t.Error("Check accepted a map where a secret value belongs")
+	}
+}
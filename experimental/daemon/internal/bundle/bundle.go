@@ -0,0 +1,601 @@
+// Package bundle exports a wild-cloud instance to a single tar.gz archive
+// and restores it, so central can be moved to new hardware.
+//
+// A bundle contains:
+//
+//	manifest.json       format version, contents and asset checksums
+//	config.yaml         the config file
+//	secrets.enc         secrets.yaml sealed with the export passphrase
+//	dnsmasq.conf        the generated dnsmasq config, for reference
+//	revisions/NNNNNN.*  the config revision history
+//
+// PXE assets are not included because they can be downloaded again; the
+// manifest lists their checksums so a restore can report what is missing.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/data"
+	"wild-cloud-central/internal/secrets"
+)
+
+// FormatVersion is the bundle layout version written by Export
+const FormatVersion = 1
+
+// Archive entry names
+const (
+	manifestEntry  = "manifest.json"
+	configEntry    = "config.yaml"
+	secretsEntry   = "secrets.enc"
+	dnsmasqEntry   = "dnsmasq.conf"
+	revisionsEntry = "revisions/"
+)
+
+// maxEntrySize bounds any single file read from a bundle
+const maxEntrySize = 16 << 20
+
+// Restore actions reported for each item in a plan
+const (
+	ActionCreate    = "create"
+	ActionReplace   = "replace"
+	ActionUnchanged = "unchanged"
+)
+
+// ErrPassphraseRequired is returned when secrets are exported or restored
+// without a passphrase
+var ErrPassphraseRequired = errors.New("a passphrase is required for secrets")
+
+var revisionName = regexp.MustCompile(`^[0-9]{6}\.(yaml|json)$`)
+
+// Asset is one PXE asset recorded in the manifest
+type Asset struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes the contents of a bundle
+type Manifest struct {
+	Format    int       `json:"format"`
+	Created   time.Time `json:"created"`
+	Secrets   bool      `json:"secrets"`
+	Revisions int       `json:"revisions"`
+	Assets    []Asset   `json:"assets"`
+}
+
+// Bundle is a bundle read into memory, with secrets decrypted
+type Bundle struct {
+	Manifest    Manifest
+	Config      []byte
+	Secrets     []byte
+	DnsmasqConf []byte
+	Revisions   map[string][]byte
+}
+
+// Change describes what restoring a bundle would do to one item
+type Change struct {
+	Item   string `json:"item"`
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AssetReport compares the manifest's assets with those on disk
+type AssetReport struct {
+	Present  int      `json:"present"`
+	Missing  []string `json:"missing"`
+	Modified []string `json:"modified"`
+}
+
+// Plan lists the changes a restore would make
+type Plan struct {
+	Changes []Change    `json:"changes"`
+	Assets  AssetReport `json:"assets"`
+}
+
+// Export writes a bundle of the instance at paths to w. Secrets are sealed
+// with passphrase; if includeSecrets is false they are left out. An empty
+// paths.DnsmasqConf leaves the dnsmasq config out of the bundle.
+func Export(w io.Writer, paths data.Paths, store *secrets.Store, passphrase string, includeSecrets bool) error {
+	config, err := readOptional(paths.ConfigFile)
+	if err != nil {
+		return err
+	}
+	var dnsmasqConf []byte
+	if paths.DnsmasqConf != "" {
+		if dnsmasqConf, err = readOptional(paths.DnsmasqConf); err != nil {
+			return err
+		}
+	}
+
+	var sealed []byte
+	if includeSecrets {
+		plaintext, err := store.Raw()
+		if err != nil {
+			return err
+		}
+		if plaintext != nil {
+			if passphrase == "" {
+				return ErrPassphraseRequired
+			}
+			if sealed, err = secrets.Seal(plaintext, passphrase); err != nil {
+				return err
+			}
+		}
+	}
+
+	revisions, err := readRevisions(paths.RevisionsDir)
+	if err != nil {
+		return err
+	}
+	assets, err := scanAssets(paths.AssetsDir)
+	if err != nil {
+		return err
+	}
+
+	manifest := Manifest{
+		Format:    FormatVersion,
+		Created:   time.Now().UTC(),
+		Secrets:   sealed != nil,
+		Revisions: countRevisions(revisions),
+		Assets:    assets,
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, content []byte, mode int64) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    mode,
+			Size:    int64(len(content)),
+			ModTime: manifest.Created,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+
+	if err := write(manifestEntry, manifestJSON, 0644); err != nil {
+		return err
+	}
+	if config != nil {
+		if err := write(configEntry, config, 0644); err != nil {
+			return err
+		}
+	}
+	if sealed != nil {
+		if err := write(secretsEntry, sealed, 0600); err != nil {
+			return err
+		}
+	}
+	if dnsmasqConf != nil {
+		if err := write(dnsmasqEntry, dnsmasqConf, 0644); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(revisions) {
+		if err := write(revisionsEntry+name, revisions[name], 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Read parses a bundle from r, decrypting the secrets with passphrase
+func Read(r io.Reader, passphrase string) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("bundle is not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	b := &Bundle{Revisions: make(map[string][]byte)}
+	var manifestJSON, sealed []byte
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxEntrySize {
+			return nil, fmt.Errorf("bundle entry %s is too large", header.Name)
+		}
+		content, err := io.ReadAll(io.LimitReader(tr, maxEntrySize))
+		if err != nil {
+			return nil, fmt.Errorf("reading bundle entry %s: %w", header.Name, err)
+		}
+
+		switch name := header.Name; {
+		case name == manifestEntry:
+			manifestJSON = content
+		case name == configEntry:
+			b.Config = content
+		case name == secretsEntry:
+			sealed = content
+		case name == dnsmasqEntry:
+			b.DnsmasqConf = content
+		case len(name) > len(revisionsEntry) && name[:len(revisionsEntry)] == revisionsEntry:
+			base := name[len(revisionsEntry):]
+			if !revisionName.MatchString(base) {
+				return nil, fmt.Errorf("unexpected revision file %s in bundle", name)
+			}
+			b.Revisions[base] = content
+		default:
+			return nil, fmt.Errorf("unexpected file %s in bundle", name)
+		}
+	}
+
+	if manifestJSON == nil {
+		return nil, fmt.Errorf("bundle has no %s", manifestEntry)
+	}
+	if err := json.Unmarshal(manifestJSON, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("parsing bundle manifest: %w", err)
+	}
+	if b.Manifest.Format > FormatVersion {
+		return nil, fmt.Errorf("bundle format %d is newer than this daemon supports (%d)", b.Manifest.Format, FormatVersion)
+	}
+
+	if sealed != nil {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		if b.Secrets, err = secrets.Open(sealed, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// CompareFile describes replacing current, nil if the file does not exist,
+// with incoming
+func CompareFile(item, path string, current, incoming []byte) Change {
+	change := Change{Item: item, Path: path, Action: ActionReplace}
+	switch {
+	case current == nil:
+		change.Action = ActionCreate
+	case string(current) == string(incoming):
+		change.Action = ActionUnchanged
+	}
+	return change
+}
+
+// Plan compares the bundle with the instance at paths without changing it
+func (b *Bundle) Plan(paths data.Paths, store *secrets.Store) (*Plan, error) {
+	plan := &Plan{Changes: []Change{}}
+
+	add := func(item, path string, current, incoming []byte) {
+		if incoming != nil {
+			plan.Changes = append(plan.Changes, CompareFile(item, path, current, incoming))
+		}
+	}
+
+	config, err := readOptional(paths.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	add("config", paths.ConfigFile, config, b.Config)
+
+	currentSecrets, err := store.Raw()
+	if err != nil {
+		return nil, err
+	}
+	add("secrets", store.Path(), currentSecrets, b.Secrets)
+
+	if len(b.Revisions) > 0 {
+		current, err := readRevisions(paths.RevisionsDir)
+		if err != nil {
+			return nil, err
+		}
+		change := Change{
+			Item:   "revisions",
+			Path:   paths.RevisionsDir,
+			Action: ActionReplace,
+			Detail: fmt.Sprintf("%d in bundle, %d on disk", countRevisions(b.Revisions), countRevisions(current)),
+		}
+		if len(current) == 0 {
+			change.Action = ActionCreate
+		} else if sameFiles(current, b.Revisions) {
+			change.Action = ActionUnchanged
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	report, err := b.checkAssets(paths.AssetsDir)
+	if err != nil {
+		return nil, err
+	}
+	plan.Assets = report
+	return plan, nil
+}
+
+// Restore writes the bundle onto the instance at paths, replacing the
+// config, secrets and revision history it contains. The dnsmasq config in
+// the bundle is only for reference; it is regenerated from the restored
+// config so it is checked like any other change.
+//
+// Nothing changes unless every step succeeds: the revisions are staged
+// beside the revisions directory and swapped in with a rename, the current
+// secrets are kept to be put back, and the config, replaced atomically, is
+// written last.
+func (b *Bundle) Restore(paths data.Paths, store *secrets.Store) (err error) {
+	var previousSecrets []byte
+	if b.Secrets != nil {
+		if previousSecrets, err = store.Raw(); err != nil {
+			return fmt.Errorf("reading current secrets: %w", err)
+		}
+	}
+
+	var staged string
+	if len(b.Revisions) > 0 {
+		if staged, err = stageRevisions(paths.RevisionsDir, b.Revisions); err != nil {
+			return err
+		}
+		defer os.RemoveAll(staged)
+	}
+
+	// undo holds the steps that put back what has been replaced so far
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undoErr := undo[i](); undoErr != nil {
+				err = fmt.Errorf("%w; rolling back: %v", err, undoErr)
+			}
+		}
+	}()
+
+	if b.Secrets != nil {
+		if err = store.Replace(b.Secrets); err != nil {
+			return fmt.Errorf("restoring secrets: %w", err)
+		}
+		undo = append(undo, func() error { return store.Replace(previousSecrets) })
+	}
+
+	if staged != "" {
+		var previous string
+		if previous, err = swapDir(staged, paths.RevisionsDir); err != nil {
+			return fmt.Errorf("restoring revisions: %w", err)
+		}
+		undo = append(undo, func() error { return unswapDir(previous, paths.RevisionsDir) })
+		defer func() {
+			if err == nil && previous != "" {
+				os.RemoveAll(previous)
+			}
+		}()
+	}
+
+	// The config goes last so a file watcher sees a complete instance
+	if b.Config != nil {
+		if err = os.MkdirAll(filepath.Dir(paths.ConfigFile), 0755); err != nil {
+			return fmt.Errorf("restoring config: %w", err)
+		}
+		if err = config.WriteFile(paths.ConfigFile, b.Config); err != nil {
+			return fmt.Errorf("restoring config: %w", err)
+		}
+	}
+	return nil
+}
+
+// stageRevisions writes revisions to a new directory beside dir and
+// returns its path
+func stageRevisions(dir string, revisions map[string][]byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("creating revisions directory: %w", err)
+	}
+	staged, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+"-restore-*")
+	if err != nil {
+		return "", fmt.Errorf("staging revisions: %w", err)
+	}
+	if err := os.Chmod(staged, 0755); err != nil {
+		os.RemoveAll(staged)
+		return "", fmt.Errorf("staging revisions: %w", err)
+	}
+	for name, content := range revisions {
+		if err := os.WriteFile(filepath.Join(staged, name), content, 0644); err != nil {
+			os.RemoveAll(staged)
+			return "", fmt.Errorf("staging revision %s: %w", name, err)
+		}
+	}
+	return staged, nil
+}
+
+// swapDir moves src into place at dst. The directory it replaces is moved
+// aside and its new path returned, or "" if dst did not exist.
+func swapDir(src, dst string) (string, error) {
+	aside := ""
+	if _, err := os.Stat(dst); err == nil {
+		aside = fmt.Sprintf("%s.old-%d", dst, time.Now().UnixNano())
+		if err := os.Rename(dst, aside); err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		if aside != "" {
+			os.Rename(aside, dst)
+		}
+		return "", err
+	}
+	return aside, nil
+}
+
+// unswapDir reverses swapDir, putting aside, the directory it returned,
+// back at dst and discarding the one that replaced it
+func unswapDir(aside, dst string) error {
+	if aside == "" {
+		return os.RemoveAll(dst)
+	}
+	replaced, err := swapDir(aside, dst)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(replaced)
+}
+
+// checkAssets compares the manifest's assets with the files in assetsDir
+func (b *Bundle) checkAssets(assetsDir string) (AssetReport, error) {
+	report := AssetReport{Missing: []string{}, Modified: []string{}}
+	for _, asset := range b.Manifest.Assets {
+		sum, _, err := hashFile(filepath.Join(assetsDir, filepath.FromSlash(asset.Path)))
+		if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, asset.Path)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		if sum != asset.SHA256 {
+			report.Modified = append(report.Modified, asset.Path)
+			continue
+		}
+		report.Present++
+	}
+	return report, nil
+}
+
+// scanAssets records the size and checksum of every file under assetsDir
+func scanAssets(assetsDir string) ([]Asset, error) {
+	assets := []Asset{}
+	err := filepath.WalkDir(assetsDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == assetsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(assetsDir, path)
+		if err != nil {
+			return err
+		}
+		sum, size, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		assets = append(assets, Asset{Path: filepath.ToSlash(rel), Size: size, SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning assets: %w", err)
+	}
+	return assets, nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// readRevisions reads every revision file in dir
+func readRevisions(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string][]byte{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading revisions: %w", err)
+	}
+
+	revisions := make(map[string][]byte)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !revisionName.MatchString(entry.Name()) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading revision %s: %w", entry.Name(), err)
+		}
+		revisions[entry.Name()] = content
+	}
+	return revisions, nil
+}
+
+// countRevisions counts revisions by their content files
+func countRevisions(files map[string][]byte) int {
+	count := 0
+	for name := range files {
+		if filepath.Ext(name) == ".yaml" {
+			count++
+		}
+	}
+	return count
+}
+
+func sameFiles(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, content := range a {
+		if other, ok := b[name]; !ok || string(other) != string(content) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readOptional reads a file, returning nil content if it does not exist
+func readOptional(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return content, nil
+}
@@ -0,0 +1,227 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"wild-cloud-central/internal/data"
+	"wild-cloud-central/internal/secrets"
+)
+
+const passphrase = "correct horse battery staple"
+
+// testLayout returns the paths of an instance in a fresh directory and its
+// secrets store
+func testLayout(t *testing.T) (data.Paths, *secrets.Store) {
+	t.Helper()
+	dir := t.TempDir()
+	paths := data.Paths{
+		DataDir:      dir,
+		ConfigFile:   filepath.Join(dir, "config.yaml"),
+		AssetsDir:    filepath.Join(dir, "assets"),
+		RevisionsDir: filepath.Join(dir, "revisions"),
+		DnsmasqConf:  filepath.Join(dir, "dnsmasq.conf"),
+	}
+	return paths, secrets.NewStore(filepath.Join(dir, "secrets.yaml"))
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sourceInstance fills a layout with a config, a secret, two revisions and
+// a PXE asset
+func sourceInstance(t *testing.T) (data.Paths, *secrets.Store) {
+	t.Helper()
+	paths, store := testLayout(t)
+	writeTestFile(t, paths.ConfigFile, "cloud:\n  domain: example.com\n")
+	writeTestFile(t, paths.DnsmasqConf, "domain=example.com\n")
+	writeTestFile(t, filepath.Join(paths.RevisionsDir, "000001.yaml"), "cloud: {}\n")
+	writeTestFile(t, filepath.Join(paths.RevisionsDir, "000001.json"), `{"id":1}`)
+	writeTestFile(t, filepath.Join(paths.AssetsDir, "tftp", "ipxe.efi"), "ipxe")
+	if err := store.Set("cloudflare.token", "s3cr3t-token"); err != nil {
+		t.Fatal(err)
+	}
+	return paths, store
+}
+
+func exportBundle(t *testing.T, paths data.Paths, store *secrets.Store) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Export(&buf, paths, store, passphrase, true); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// actions maps each planned item to its action
+func actions(plan *Plan) map[string]string {
+	out := map[string]string{}
+	for _, change := range plan.Changes {
+		out[change.Item] = change.Action
+	}
+	return out
+}
+
+func TestExportAndRestoreIntoFreshInstance(t *testing.T) {
+	source, sourceStore := sourceInstance(t)
+	archive := exportBundle(t, source, sourceStore)
+
+	b, err := Read(bytes.NewReader(archive), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Manifest.Secrets || b.Manifest.Revisions != 1 || len(b.Manifest.Assets) != 1 {
+		t.Errorf("manifest = %+v", b.Manifest)
+	}
+	if string(b.DnsmasqConf) != "domain=example.com\n" {
+		t.Errorf("dnsmasq.conf = %q", b.DnsmasqConf)
+	}
+
+	target, targetStore := testLayout(t)
+
+	// A dry run reports the changes and touches nothing
+	plan, err := b.Plan(target, targetStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"config": ActionCreate, "secrets": ActionCreate, "revisions": ActionCreate}
+	if got := actions(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("plan = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(plan.Assets.Missing, []string{"tftp/ipxe.efi"}) {
+		t.Errorf("missing assets = %v, want tftp/ipxe.efi", plan.Assets.Missing)
+	}
+	entries, err := os.ReadDir(target.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("dry run wrote %d files", len(entries))
+	}
+
+	if err := b.Restore(target, targetStore); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"config.yaml", "revisions/000001.yaml", "revisions/000001.json"} {
+		want, _ := os.ReadFile(filepath.Join(source.DataDir, path))
+		got, err := os.ReadFile(filepath.Join(target.DataDir, path))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s = %q (%v), want %q", path, got, err, want)
+		}
+	}
+	if value, err := targetStore.Get("cloudflare.token"); err != nil || value != "s3cr3t-token" {
+		t.Errorf("restored secret = %v (%v)", value, err)
+	}
+	if _, err := os.Stat(target.DnsmasqConf); !os.IsNotExist(err) {
+		t.Error("restore wrote the reference dnsmasq.conf")
+	}
+
+	// Restoring leaves nothing staged behind and nothing left to change
+	entries, err = os.ReadDir(target.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"config.yaml", "revisions", "secrets.yaml"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("data directory holds %v, want %v", names, want)
+	}
+	plan, err = b.Plan(target, targetStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"config": ActionUnchanged, "secrets": ActionUnchanged, "revisions": ActionUnchanged}
+	if got := actions(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("plan after restore = %v, want %v", got, want)
+	}
+}
+
+func TestRestoreRollsBackOnFailure(t *testing.T) {
+	source, sourceStore := sourceInstance(t)
+	b, err := Read(bytes.NewReader(exportBundle(t, source, sourceStore)), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, targetStore := testLayout(t)
+	writeTestFile(t, filepath.Join(target.RevisionsDir, "000007.yaml"), "old: true\n")
+	if err := targetStore.Set("old", "value-kept"); err != nil {
+		t.Fatal(err)
+	}
+	// A directory where the config file belongs makes the last step fail
+	if err := os.MkdirAll(filepath.Join(target.ConfigFile, "in-the-way"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Restore(target, targetStore); err == nil {
+		t.Fatal("restore succeeded, want the config write to fail")
+	}
+
+	if value, err := targetStore.Get("old"); err != nil || value != "value-kept" {
+		t.Errorf("secret old = %v (%v), want the previous secrets back", value, err)
+	}
+	if _, err := targetStore.Get("cloudflare.token"); err == nil {
+		t.Error("the bundle's secrets were left in place")
+	}
+	revisions, err := readRevisions(target.RevisionsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]byte{"000007.yaml": []byte("old: true\n")}; !reflect.DeepEqual(revisions, want) {
+		t.Errorf("revisions = %v, want the previous ones back", sortedKeys(revisions))
+	}
+	entries, err := os.ReadDir(target.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("data directory holds %d entries, want config.yaml, revisions and secrets.yaml", len(entries))
+	}
+}
+
+func TestReadPassphrase(t *testing.T) {
+	source, store := sourceInstance(t)
+	archive := exportBundle(t, source, store)
+
+	if _, err := Read(bytes.NewReader(archive), ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("no passphrase: err = %v, want ErrPassphraseRequired", err)
+	}
+	if _, err := Read(bytes.NewReader(archive), "wrong"); !errors.Is(err, secrets.ErrDecrypt) {
+		t.Errorf("wrong passphrase: err = %v, want ErrDecrypt", err)
+	}
+	if _, err := Read(bytes.NewReader([]byte("not a bundle")), passphrase); err == nil {
+		t.Error("read a file that is not a bundle")
+	}
+}
+
+func TestExportWithoutSecrets(t *testing.T) {
+	source, store := sourceInstance(t)
+	var buf bytes.Buffer
+	if err := Export(&buf, source, store, "", false); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Read(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Manifest.Secrets || b.Secrets != nil {
+		t.Error("bundle exported without secrets contains secrets")
+	}
+
+	if err := Export(&bytes.Buffer{}, source, store, "", true); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("export of secrets without a passphrase: err = %v, want ErrPassphraseRequired", err)
+	}
+}
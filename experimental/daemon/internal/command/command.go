@@ -0,0 +1,42 @@
+// Package command runs external programs behind an interface so callers can
+// be exercised without them.
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Runner runs an external command and returns its combined output
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner runs commands with os/exec
+type ExecRunner struct{}
+
+// Run implements Runner. A failing command's error includes its output.
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		if output := strings.TrimSpace(out.String()); output != "" {
+			return out.Bytes(), fmt.Errorf("%s: %w: %s", name, err, output)
+		}
+		return out.Bytes(), fmt.Errorf("%s: %w", name, err)
+	}
+	return out.Bytes(), nil
+}
+
+// RunnerFunc adapts a function to the Runner interface
+type RunnerFunc func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// Run implements Runner
+func (f RunnerFunc) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return f(ctx, name, args...)
+}
@@ -8,8 +8,11 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Config represents the main configuration structure
+// Config represents the main configuration structure. Only the fields the
+// daemon works with are modelled; everything else in the file is kept in the
+// underlying YAML document and written back untouched.
 type Config struct {
+	Version   int `yaml:"version" json:"version"`
 	Wildcloud struct {
 		Repository       string   `yaml:"repository" json:"repository"`
 		CurrentPhase     string   `yaml:"currentPhase" json:"currentPhase"`
@@ -18,18 +21,30 @@ type Config struct {
 	Server struct {
 		Port int    `yaml:"port" json:"port"`
 		Host string `yaml:"host" json:"host"`
+
+		// ServiceManager controls dnsmasq and other helper services:
+		// systemd (the default), openrc, process or none
+		ServiceManager string                   `yaml:"serviceManager" json:"serviceManager"`
+		Services       map[string]ServiceConfig `yaml:"services" json:"services"`
 	} `yaml:"server" json:"server"`
 	Cloud struct {
 		Domain         string `yaml:"domain" json:"domain"`
 		InternalDomain string `yaml:"internalDomain" json:"internalDomain"`
 		DNS            struct {
-			IP string `yaml:"ip" json:"ip"`
+			IP      string      `yaml:"ip" json:"ip"`
+			Server  DNSServer   `yaml:"server" json:"server"`
+			Records []DNSRecord `yaml:"records" json:"records"`
 		} `yaml:"dns" json:"dns"`
 		Router struct {
 			IP string `yaml:"ip" json:"ip"`
 		} `yaml:"router" json:"router"`
-		DHCPRange string `yaml:"dhcpRange" json:"dhcpRange"`
-		Dnsmasq   struct {
+		TFTP struct {
+			Server TFTPServer `yaml:"server" json:"server"`
+		} `yaml:"tftp" json:"tftp"`
+		DHCPRange    string `yaml:"dhcpRange" json:"dhcpRange"`
+		DHCPMode     string `yaml:"dhcpMode" json:"dhcpMode"`
+		SubnetPrefix int    `yaml:"subnetPrefix,omitempty" json:"subnetPrefix,omitempty"`
+		Dnsmasq      struct {
 			Interface string `yaml:"interface" json:"interface"`
 		} `yaml:"dnsmasq" json:"dnsmasq"`
 	} `yaml:"cloud" json:"cloud"`
@@ -39,19 +54,58 @@ type Config struct {
 			Talos struct {
 				Version string `yaml:"version" json:"version"`
 			} `yaml:"talos" json:"talos"`
+			Reservations []Reservation `yaml:"reservations" json:"reservations"`
 		} `yaml:"nodes" json:"nodes"`
 	} `yaml:"cluster" json:"cluster"`
+
+	// doc is the YAML document the config was parsed from
+	doc *yaml.Node
+	// migrations lists the schema migrations Load applied to the file
+	migrations []AppliedMigration
 }
 
-// Load loads configuration from the specified path
+// Load loads configuration from the specified path. A file written for an
+// older schema version is backed up and migrated on disk first.
 func Load(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file %s: %w", configPath, err)
 	}
 
-	config := &Config{}
-	if err := yaml.Unmarshal(data, config); err != nil {
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	applied, err := migrateFile(configPath, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	config.migrations = applied
+	return config, nil
+}
+
+// Parse parses configuration from raw YAML, migrating it to the current
+// schema version in memory
+func Parse(data []byte) (*Config, error) {
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	if _, err := Migrate(doc, nil); err != nil {
+		return nil, err
+	}
+	return decode(doc)
+}
+
+// decode builds a Config from a parsed document and applies defaults
+func decode(doc *yaml.Node) (*Config, error) {
+	config := &Config{doc: doc}
+	if err := doc.Decode(config); err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
 
@@ -66,19 +120,98 @@ func Load(configPath string) (*Config, error) {
 	return config, nil
 }
 
-// Save saves the configuration to the specified path
+// Save saves the configuration to the specified path. The modelled fields are
+// merged into the document currently on disk (or the one the config was
+// parsed from) so unmodelled keys, comments and key order are preserved.
 func Save(config *Config, configPath string) error {
+	// New configs are written at the current schema version
+	if config.Version == 0 {
+		config.Version = CurrentVersion()
+	}
+
 	// Ensure the directory exists
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("creating config directory: %w", err)
 	}
 
-	data, err := yaml.Marshal(config)
+	doc, err := baseDocument(config, configPath)
+	if err != nil {
+		return err
+	}
+	if err := mergeInto(doc, config); err != nil {
+		return err
+	}
+
+	data, err := EncodeDocument(doc)
 	if err != nil {
 		return fmt.Errorf("marshaling config: %w", err)
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	if err := WriteFile(configPath, data); err != nil {
+		return err
+	}
+	config.doc = doc
+	return nil
+}
+
+// WriteFile replaces the config file at path with data through a temporary
+// file and a rename, so readers and crashes never see a partial file. An
+// existing file keeps its permissions; a new one is created 0644.
+func WriteFile(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("setting config file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing config file: %w", err)
+	}
+	return nil
+}
+
+// baseDocument returns the YAML document that Save merges config into
+func baseDocument(config *Config, configPath string) (*yaml.Node, error) {
+	data, err := os.ReadFile(configPath)
+	if err == nil {
+		if doc, err := ParseDocument(data); err == nil {
+			return doc, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading config file %s: %w", configPath, err)
+	}
+
+	if config.doc != nil {
+		return config.doc, nil
+	}
+	return ParseDocument(nil)
+}
+
+// AppliedMigrations returns the schema migrations Load applied to the file
+func (c *Config) AppliedMigrations() []AppliedMigration {
+	return c.migrations
 }
 
 // IsEmpty checks if the configuration is empty or uninitialized
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sampleConfig is the shared test fixture, which carries sections the
+// config does not model such as operator, cloud.nfs and apps
+const sampleConfig = "../../../../test/fixtures/sample-config.yaml"
+
+// topLevelKeys returns the keys of a YAML mapping document in file order
+func topLevelKeys(t *testing.T, data []byte) []string {
+	t.Helper()
+	doc, err := ParseDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for i := 0; i < len(doc.Content[0].Content); i += 2 {
+		keys = append(keys, doc.Content[0].Content[i].Value)
+	}
+	return keys
+}
+
+func TestSaveRoundTripsFixture(t *testing.T) {
+	fixture, err := os.ReadFile(sampleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := append([]byte("# Wild Cloud test config\n"), fixture...)
+	original = []byte(strings.Replace(string(original),
+		"  nfs:\n", "  # Shared storage\n  nfs:\n", 1))
+	original = []byte(strings.Replace(string(original),
+		"storageCapacity: 100Gi", "storageCapacity: 100Gi # grows with the pool", 1))
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Cloud.Domain = "changed.example.com"
+	if err := Save(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range []string{"# Wild Cloud test config", "# Shared storage", "# grows with the pool"} {
+		if !strings.Contains(string(saved), comment) {
+			t.Errorf("comment %q was lost:\n%s", comment, saved)
+		}
+	}
+
+	// Every original key keeps its place; Save adds the version and the
+	// server defaults
+	wantKeys := append([]string{"version"}, topLevelKeys(t, original)...)
+	wantKeys = append(wantKeys, "server")
+	if got := topLevelKeys(t, saved); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("top-level keys = %v, want %v", got, wantKeys)
+	}
+
+	// Apart from the edit and those additions, the document is unchanged,
+	// unmodelled sections included
+	var want, got map[string]interface{}
+	if err := yaml.Unmarshal(original, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(saved, &got); err != nil {
+		t.Fatal(err)
+	}
+	delete(got, "server")
+	want["version"] = CurrentVersion()
+	want["cloud"].(map[string]interface{})["domain"] = "changed.example.com"
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("saved document differs from the fixture:\n%s", saved)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("config file mode = %v, want the original 0600", mode)
+	}
+}
+
+func TestWriteFileLeavesNoTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	for _, content := range []string{"version: 1\n", "version: 2\n"} {
+		if err := WriteFile(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != content {
+			t.Errorf("content = %q, want %q", got, content)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory holds %v, want only config.yaml", names)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0644 {
+		t.Errorf("new config file mode = %v, want 0644", mode)
+	}
+}
+
+func TestWriteFileMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "config.yaml")
+	if err := WriteFile(path, []byte("version: 1\n")); err == nil {
+		t.Error("wrote into a directory that does not exist")
+	}
+}
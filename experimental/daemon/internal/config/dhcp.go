@@ -0,0 +1,71 @@
+package config
+
+import (
+	"net"
+	"strings"
+)
+
+// DHCP modes for cloud.dhcpMode
+const (
+	// DHCPModeServer hands out addresses from cloud.dhcpRange; the router's
+	// DHCP server must be off
+	DHCPModeServer = "server"
+
+	// DHCPModeProxy leaves addresses to the router's DHCP server and only
+	// answers PXE clients with boot information
+	DHCPModeProxy = "proxy"
+)
+
+// DHCPModes are the accepted values of cloud.dhcpMode; empty means server
+var DHCPModes = []string{DHCPModeServer, DHCPModeProxy}
+
+// ProxyDHCP reports whether dnsmasq runs as a proxy DHCP server
+func (c *Config) ProxyDHCP() bool {
+	return c.Cloud.DHCPMode == DHCPModeProxy
+}
+
+// DefaultLeaseTime is the DHCP lease time used when cloud.dhcpRange does not
+// give one
+const DefaultLeaseTime = "12h"
+
+// DHCPRangeSetting returns cloud.dhcpRange as a dnsmasq dhcp-range value,
+// adding DefaultLeaseTime unless the range has its own lease time
+func (c *Config) DHCPRangeSetting() string {
+	if strings.Count(c.Cloud.DHCPRange, ",") >= 2 {
+		return c.Cloud.DHCPRange
+	}
+	return c.Cloud.DHCPRange + "," + DefaultLeaseTime
+}
+
+// LANNetwork returns the network address of the LAN, taken from the router
+// or else the DNS server, or "" if neither is set
+func (c *Config) LANNetwork() string {
+	for _, addr := range []string{c.Cloud.Router.IP, c.Cloud.DNS.IP} {
+		if ip := net.ParseIP(addr).To4(); ip != nil {
+			return subnetOf(ip, c.SubnetPrefixLength()).IP.String()
+		}
+	}
+	return ""
+}
+
+// Warnings lists settings that are valid on their own but do not fit the
+// DHCP mode or the DNS backend. Unlike validation errors they do not stop a
+// config from being saved.
+func (c *Config) Warnings() []FieldError {
+	w := &ValidationError{}
+	if c.ProxyDHCP() {
+		if c.Cloud.DHCPRange != "" {
+			w.add("cloud.dhcpRange", "is ignored in proxy mode; the router hands out addresses")
+		}
+		if len(c.Cluster.Nodes.Reservations) > 0 {
+			w.add("cluster.nodes.reservations", "are ignored in proxy mode; reserve addresses on the router instead")
+		}
+		if c.LANNetwork() == "" {
+			w.add("cloud.dhcpMode", "proxy mode needs cloud.router.ip or cloud.dns.ip to find the LAN; dnsmasq serves no DHCP until one is set")
+		}
+	} else if c.Cloud.DHCPRange == "" {
+		w.add("cloud.dhcpRange", "is required in server mode; dnsmasq serves no DHCP until a range is set, or use proxy mode if the router's DHCP server stays on")
+	}
+	c.dnsRecordWarnings(w)
+	return w.Errors
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// DNS record types accepted in cloud.dns.records
+var DNSRecordTypes = []string{"A", "AAAA", "CNAME", "TXT", "SRV"}
+
+// maxTXTLength is the longest TXT value; longer ones would need splitting
+// into several strings
+const maxTXTLength = 255
+
+// recordLabelPattern is a DNS label that may also start with an underscore,
+// as SRV service and protocol labels do
+var recordLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9])?$`)
+
+// DNSRecord is a host record served alongside the wildcard domain mappings
+type DNSRecord struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"`
+
+	// Value is the address of an A or AAAA record, the target of a CNAME or
+	// SRV record or the text of a TXT record
+	Value string `yaml:"value" json:"value"`
+
+	// Priority, Weight and Port are only used by SRV records
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Weight   int `yaml:"weight,omitempty" json:"weight,omitempty"`
+	Port     int `yaml:"port,omitempty" json:"port,omitempty"`
+}
+
+// NormalizeDNSName returns name in lowercase without a trailing dot
+func NormalizeDNSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// NormalizeDNSRecord returns record with its name, type and any target name
+// in canonical form
+func NormalizeDNSRecord(record DNSRecord) DNSRecord {
+	record.Name = NormalizeDNSName(record.Name)
+	record.Type = strings.ToUpper(strings.TrimSpace(record.Type))
+	switch record.Type {
+	case "CNAME", "SRV":
+		record.Value = NormalizeDNSName(record.Value)
+	case "A", "AAAA":
+		record.Value = strings.TrimSpace(record.Value)
+	}
+	return record
+}
+
+// FindDNSRecords returns the indexes of the records for name, optionally
+// only those of type recordType
+func FindDNSRecords(records []DNSRecord, name, recordType string) []int {
+	name = NormalizeDNSName(name)
+	var found []int
+	for i, record := range records {
+		if NormalizeDNSName(record.Name) != name {
+			continue
+		}
+		if recordType != "" && !strings.EqualFold(record.Type, recordType) {
+			continue
+		}
+		found = append(found, i)
+	}
+	return found
+}
+
+// WildcardDomains returns the cloud domains whose every name resolves to
+// cluster.endpointIp. There are none until the endpoint is set.
+func (c *Config) WildcardDomains() []string {
+	if c.Cluster.EndpointIP == "" {
+		return nil
+	}
+	var domains []string
+	for _, domain := range []string{c.Cloud.Domain, c.Cloud.InternalDomain} {
+		if domain = NormalizeDNSName(domain); domain != "" && !contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// DNSRecordOverrides returns the wildcard mapping, like *.cloud.example.com,
+// that an address or CNAME record takes the name out of, or "" if it takes
+// over no mapped name
+func (c *Config) DNSRecordOverrides(record DNSRecord) string {
+	switch strings.ToUpper(record.Type) {
+	case "A", "AAAA", "CNAME":
+	default:
+		return ""
+	}
+	if domain := closestDomain(NormalizeDNSName(record.Name), c.WildcardDomains()); domain != "" {
+		return "*." + domain
+	}
+	return ""
+}
+
+// closestDomain returns the longest of domains that is name or contains it,
+// or ""
+func closestDomain(name string, domains []string) string {
+	var closest string
+	for _, domain := range domains {
+		if (name == domain || strings.HasSuffix(name, "."+domain)) && len(domain) > len(closest) {
+			closest = domain
+		}
+	}
+	return closest
+}
+
+// validateDNSRecords checks the custom DNS records. Each must sit inside a
+// cloud domain, fit its type, and not clash with other records or with the
+// apex of a wildcard domain mapping.
+func (c *Config) validateDNSRecords(v *ValidationError) {
+	var cloudDomains []string
+	for _, domain := range []string{c.Cloud.Domain, c.Cloud.InternalDomain} {
+		if domain = NormalizeDNSName(domain); domain != "" {
+			cloudDomains = append(cloudDomains, domain)
+		}
+	}
+	wildcards := c.WildcardDomains()
+
+	hostnames := make(map[string]int)
+	if internal := NormalizeDNSName(c.Cloud.InternalDomain); internal != "" {
+		for i, reservation := range c.Cluster.Nodes.Reservations {
+			if reservation.Hostname != "" {
+				hostnames[strings.ToLower(reservation.Hostname)+"."+internal] = i
+			}
+		}
+	}
+
+	seen := make(map[DNSRecord]int)
+	cnames := make(map[string]int)
+	others := make(map[string]int)
+
+	for i, record := range c.Cloud.DNS.Records {
+		field := fmt.Sprintf("cloud.dns.records[%d]", i)
+		normalized := NormalizeDNSRecord(record)
+		name := normalized.Name
+
+		// The record is rendered as written, so it is checked as written
+		// and only compared in normal form
+		nameValid := false
+		switch {
+		case record.Name == "":
+			v.add(field+".name", "is required")
+		case strings.Contains(record.Name, "*"):
+			v.add(field+".name", "must not be a wildcard; wildcards are reserved for the domain mappings")
+		case checkRecordName(record.Name) != "":
+			v.add(field+".name", "%s", checkRecordName(record.Name))
+		case len(cloudDomains) == 0:
+			v.add(field+".name", "needs cloud.domain or cloud.internalDomain to be set")
+		case closestDomain(name, cloudDomains) == "":
+			v.add(field+".name", "must be in %s", strings.Join(cloudDomains, " or "))
+		default:
+			nameValid = true
+		}
+
+		if !contains(DNSRecordTypes, record.Type) {
+			v.add(field+".type", "must be one of %v", DNSRecordTypes)
+			continue
+		}
+		validateDNSRecordValue(v, field, record)
+		if !nameValid {
+			continue
+		}
+
+		if first, ok := seen[normalized]; ok {
+			v.add(field, "duplicates record %d", first)
+			continue
+		}
+		seen[normalized] = i
+
+		if normalized.Type == "CNAME" {
+			if first, ok := cnames[name]; ok {
+				v.add(field+".name", "already has a CNAME in record %d", first)
+			} else if first, ok := others[name]; ok {
+				v.add(field+".name", "cannot be a CNAME because record %d uses the name", first)
+			}
+			cnames[name] = i
+		} else {
+			if first, ok := cnames[name]; ok {
+				v.add(field+".name", "is a CNAME in record %d and cannot have other records", first)
+			}
+			if _, ok := others[name]; !ok {
+				others[name] = i
+			}
+		}
+
+		switch normalized.Type {
+		case "A", "AAAA", "CNAME":
+			if contains(cloudDomains, name) && normalized.Type == "CNAME" {
+				v.add(field+".name", "cannot be a CNAME because it is the apex of a cloud domain")
+			} else if contains(wildcards, name) {
+				v.add(field+".name", "conflicts with the wildcard mapping of %s to cluster.endpointIp", name)
+			} else if reservation, ok := hostnames[name]; ok {
+				v.add(field+".name", "conflicts with the hostname of reservation %d", reservation)
+			}
+		}
+	}
+}
+
+// validateDNSRecordValue checks that a record's value fits its type, and
+// that only SRV records set the SRV fields
+func validateDNSRecordValue(v *ValidationError, field string, record DNSRecord) {
+	switch record.Type {
+	case "A":
+		if net.ParseIP(record.Value).To4() == nil {
+			v.add(field+".value", "must be an IPv4 address")
+		}
+	case "AAAA":
+		if ip := net.ParseIP(record.Value); ip == nil || ip.To4() != nil {
+			v.add(field+".value", "must be an IPv6 address")
+		}
+	case "CNAME", "SRV":
+		if record.Value == "" {
+			v.add(field+".value", "must be the target host name")
+		} else if msg := checkRecordName(record.Value); msg != "" {
+			v.add(field+".value", "%s", msg)
+		}
+	case "TXT":
+		switch {
+		case record.Value == "":
+			v.add(field+".value", "is required")
+		case len(record.Value) > maxTXTLength:
+			v.add(field+".value", "must be at most %d characters", maxTXTLength)
+		case strings.ContainsAny(record.Value, "\"\\\n\r"):
+			v.add(field+".value", "must not contain quotes, backslashes or line breaks")
+		}
+	}
+
+	if record.Type != "SRV" {
+		if record.Priority != 0 || record.Weight != 0 || record.Port != 0 {
+			v.add(field, "priority, weight and port are only used by SRV records")
+		}
+		return
+	}
+	if record.Port < 1 || record.Port > 65535 {
+		v.add(field+".port", "must be between 1 and 65535")
+	}
+	if record.Priority < 0 || record.Priority > 65535 {
+		v.add(field+".priority", "must be between 0 and 65535")
+	}
+	if record.Weight < 0 || record.Weight > 65535 {
+		v.add(field+".weight", "must be between 0 and 65535")
+	}
+}
+
+// dnsRecordWarnings lists records dnsmasq will not answer as configured.
+// dnsmasq only serves a CNAME whose target it knows itself.
+func (c *Config) dnsRecordWarnings(w *ValidationError) {
+	if c.Cloud.DNS.Server.Enabled {
+		return
+	}
+	local := make(map[string]bool)
+	for _, record := range c.Cloud.DNS.Records {
+		switch strings.ToUpper(record.Type) {
+		case "A", "AAAA", "CNAME":
+			local[NormalizeDNSName(record.Name)] = true
+		}
+	}
+	for i, record := range c.Cloud.DNS.Records {
+		if strings.ToUpper(record.Type) != "CNAME" {
+			continue
+		}
+		if target := NormalizeDNSName(record.Value); !local[target] {
+			w.add(fmt.Sprintf("cloud.dns.records[%d].value", i), "dnsmasq only answers CNAMEs to names it has records for; add a record for %s or enable the embedded DNS server", target)
+		}
+	}
+}
+
+// checkRecordName checks a record or target name and returns a description
+// of the problem, if any
+func checkRecordName(name string) string {
+	if len(name) > 253 {
+		return "must be at most 253 characters"
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !recordLabelPattern.MatchString(label) {
+			return fmt.Sprintf("contains invalid label %q", label)
+		}
+	}
+	return ""
+}
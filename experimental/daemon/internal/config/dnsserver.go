@@ -0,0 +1,102 @@
+package config
+
+import (
+	"net"
+	"strconv"
+)
+
+// Embedded DNS server defaults
+const (
+	DefaultDNSPort = 53
+	DefaultDNSTTL  = 60
+)
+
+// DefaultDNSUpstreams are the resolvers names outside the cloud domains are
+// forwarded to, the same ones the generated dnsmasq config uses
+var DefaultDNSUpstreams = []string{"1.1.1.1", "8.8.8.8"}
+
+// DNSServer configures the embedded DNS server. When it is enabled, dnsmasq
+// only serves DHCP and TFTP.
+type DNSServer struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Listen is the UDP and TCP address to serve on; it defaults to port 53
+	// on cloud.dns.ip
+	Listen string `yaml:"listen" json:"listen"`
+
+	// Upstreams are resolvers for everything outside the cloud domains, as
+	// IP or IP:port
+	Upstreams []string `yaml:"upstreams" json:"upstreams"`
+
+	// TTL is the time to live of the records the server answers with, in
+	// seconds
+	TTL int `yaml:"ttl" json:"ttl"`
+}
+
+// DNSListenAddress returns the address the embedded DNS server listens on
+func (c *Config) DNSListenAddress() string {
+	if listen := c.Cloud.DNS.Server.Listen; listen != "" {
+		return listen
+	}
+	return net.JoinHostPort(c.Cloud.DNS.IP, strconv.Itoa(DefaultDNSPort))
+}
+
+// DNSUpstreams returns the upstream resolvers as IP:port addresses
+func (c *Config) DNSUpstreams() []string {
+	upstreams := c.Cloud.DNS.Server.Upstreams
+	if len(upstreams) == 0 {
+		upstreams = DefaultDNSUpstreams
+	}
+	addrs := make([]string, len(upstreams))
+	for i, upstream := range upstreams {
+		if net.ParseIP(upstream) != nil {
+			upstream = net.JoinHostPort(upstream, strconv.Itoa(DefaultDNSPort))
+		}
+		addrs[i] = upstream
+	}
+	return addrs
+}
+
+// DNSTTL returns the TTL of the embedded DNS server's records in seconds
+func (c *Config) DNSTTL() uint32 {
+	if ttl := c.Cloud.DNS.Server.TTL; ttl > 0 {
+		return uint32(ttl)
+	}
+	return DefaultDNSTTL
+}
+
+// validateDNSServer checks the embedded DNS server settings
+func (c *Config) validateDNSServer(v *ValidationError) {
+	server := c.Cloud.DNS.Server
+	validateListen(v, "cloud.dns.server.listen", server.Listen, DefaultDNSPort)
+	for i, upstream := range server.Upstreams {
+		if net.ParseIP(upstream) != nil {
+			continue
+		}
+		if host, port, err := net.SplitHostPort(upstream); err != nil || !validPort(port) || net.ParseIP(host) == nil {
+			v.add("cloud.dns.server.upstreams["+strconv.Itoa(i)+"]", "must be an IP address, optionally with a port")
+		}
+	}
+	if server.TTL < 0 {
+		v.add("cloud.dns.server.ttl", "must not be negative")
+	}
+	if server.Enabled && server.Listen == "" && c.Cloud.DNS.IP == "" {
+		v.add("cloud.dns.server.listen", "is required when cloud.dns.ip is not set")
+	}
+}
+
+// validateListen checks an optional listen address
+func validateListen(v *ValidationError, field, listen string, defaultPort int) {
+	if listen == "" {
+		return
+	}
+	if host, port, err := net.SplitHostPort(listen); err != nil || !validPort(port) || (host != "" && net.ParseIP(host) == nil) {
+		v.add(field, "must be an address like 192.168.8.50:%d", defaultPort)
+	}
+}
+
+// validPort reports whether port is a TCP or UDP port number
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
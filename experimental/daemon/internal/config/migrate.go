@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Migration upgrades a config document from Version-1 to Version. Apply
+// edits the document in place; the version key is updated by the caller.
+type Migration struct {
+	Version     int                         `json:"version"`
+	Description string                      `json:"description"`
+	Apply       func(root *yaml.Node) error `json:"-"`
+}
+
+// AppliedMigration records a migration that was run on a config file
+type AppliedMigration struct {
+	From        int       `json:"from"`
+	To          int       `json:"to"`
+	Description string    `json:"description"`
+	Backup      string    `json:"backup,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// migrations is the registered chain of schema migrations, in order. Files
+// without a version key are version 0. To change the config format, append
+// a migration here and update the Config struct to match.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "add schema version",
+	},
+}
+
+func init() {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			panic(fmt.Sprintf("config migration %d registered out of order", m.Version))
+		}
+	}
+}
+
+// CurrentVersion is the config schema version written by this daemon
+func CurrentVersion() int {
+	return len(migrations)
+}
+
+// Migrations returns the registered migrations in order
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// Migrate upgrades doc to the current schema version in memory. If backup is
+// not nil it is called with the document before each migration and may
+// return the location it saved it to.
+func Migrate(doc *yaml.Node, backup func(doc *yaml.Node, version int) (string, error)) ([]AppliedMigration, error) {
+	root := doc.Content[0]
+	version, err := documentVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	if version > CurrentVersion() {
+		return nil, fmt.Errorf("config version %d is newer than this daemon supports (%d)", version, CurrentVersion())
+	}
+
+	var applied []AppliedMigration
+	for _, m := range migrations[version:] {
+		record := AppliedMigration{From: m.Version - 1, To: m.Version, Description: m.Description}
+		if backup != nil {
+			location, err := backup(doc, m.Version-1)
+			if err != nil {
+				return applied, fmt.Errorf("backing up config before migration to version %d: %w", m.Version, err)
+			}
+			record.Backup = location
+		}
+		if m.Apply != nil {
+			if err := m.Apply(root); err != nil {
+				return applied, fmt.Errorf("migrating config to version %d: %w", m.Version, err)
+			}
+		}
+		setDocumentVersion(root, m.Version)
+		record.Time = time.Now().UTC()
+		applied = append(applied, record)
+	}
+	return applied, nil
+}
+
+// migrateFile upgrades the config file at configPath, saving a backup of the
+// file before each migration and writing the result back
+func migrateFile(configPath string, doc *yaml.Node) ([]AppliedMigration, error) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return nil, err
+	}
+	mode := info.Mode().Perm()
+
+	applied, err := Migrate(doc, func(doc *yaml.Node, version int) (string, error) {
+		data, err := EncodeDocument(doc)
+		if err != nil {
+			return "", err
+		}
+		location := backupPath(configPath, version)
+		if err := os.WriteFile(location, data, mode); err != nil {
+			return "", err
+		}
+		return location, nil
+	})
+	if err != nil || len(applied) == 0 {
+		return applied, err
+	}
+
+	data, err := EncodeDocument(doc)
+	if err != nil {
+		return applied, fmt.Errorf("marshaling migrated config: %w", err)
+	}
+	if err := WriteFile(configPath, data); err != nil {
+		return applied, fmt.Errorf("writing migrated config: %w", err)
+	}
+	return applied, nil
+}
+
+// backupPath picks an unused backup file name for a config at version
+func backupPath(configPath string, version int) string {
+	path := fmt.Sprintf("%s.v%d.bak", configPath, version)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	return fmt.Sprintf("%s.v%d.%s.bak", configPath, version, time.Now().UTC().Format("20060102T150405Z"))
+}
+
+// DocumentVersion reads the schema version of a config document, treating
+// a missing version as 0
+func DocumentVersion(doc *yaml.Node) (int, error) {
+	return documentVersion(doc.Content[0])
+}
+
+// documentVersion reads the version key of a config mapping
+func documentVersion(root *yaml.Node) (int, error) {
+	node := mappingValue(root, "version")
+	if node == nil || node.Tag == "!!null" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(node.Value)
+	if node.Kind != yaml.ScalarNode || err != nil || version < 0 {
+		return 0, fmt.Errorf("config version must be a non-negative integer")
+	}
+	return version, nil
+}
+
+// setDocumentVersion sets the version key, adding it as the first key if
+// the document does not have one yet
+func setDocumentVersion(root *yaml.Node, version int) {
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(version)}
+	if existing := mappingValue(root, "version"); existing != nil {
+		replaceNode(existing, value)
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	if len(root.Content) > 0 {
+		// Keep a file header comment at the top of the file
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+}
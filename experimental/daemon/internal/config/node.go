@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseDocument parses raw YAML into a document node, treating empty input
+// as an empty mapping
+func ParseDocument(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config must be a YAML mapping")
+	}
+	return &doc, nil
+}
+
+// EncodeDocument renders a YAML document with the two-space indent used by
+// the wild-cloud config files
+func EncodeDocument(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeInto copies the modelled fields of config into the document doc,
+// leaving unmodelled keys, comments and key order untouched
+func mergeInto(doc *yaml.Node, config *Config) error {
+	var modelled yaml.Node
+	if err := modelled.Encode(config); err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+	mergeMapping(doc.Content[0], &modelled)
+	return nil
+}
+
+// mergeMapping updates dst with every key from src. Keys missing from dst
+// are appended unless their value is empty, so saving a config does not
+// litter the file with blank fields it never had.
+func mergeMapping(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		existing := mappingValue(dst, key.Value)
+		switch {
+		case existing == nil:
+			if !isEmptyNode(value) {
+				dst.Content = append(dst.Content, key, value)
+			}
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeMapping(existing, value)
+		case !sameValue(existing, value):
+			replaceNode(existing, value)
+		}
+	}
+}
+
+// mappingValue returns the value node for key in a mapping node
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// replaceNode overwrites dst with src while keeping the comments of dst
+func replaceNode(dst, src *yaml.Node) {
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+}
+
+// sameValue reports whether two nodes represent the same data, ignoring
+// style and comments
+func sameValue(a, b *yaml.Node) bool {
+	var va, vb interface{}
+	if a.Decode(&va) != nil || b.Decode(&vb) != nil {
+		return false
+	}
+	ea, errA := yaml.Marshal(va)
+	eb, errB := yaml.Marshal(vb)
+	return errA == nil && errB == nil && bytes.Equal(ea, eb)
+}
+
+// isEmptyNode reports whether a node holds only zero values
+func isEmptyNode(n *yaml.Node) bool {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		switch n.Tag {
+		case "!!null":
+			return true
+		case "!!str":
+			return n.Value == ""
+		case "!!int":
+			return n.Value == "0"
+		case "!!bool":
+			return n.Value == "false"
+		}
+		return false
+	case yaml.SequenceNode:
+		return len(n.Content) == 0
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if !isEmptyNode(n.Content[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
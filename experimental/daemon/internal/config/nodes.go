@@ -0,0 +1,36 @@
+package config
+
+// ActiveNode is the part of a cluster.nodes.active entry the daemon uses.
+// The entries are keyed by the node's IP address.
+type ActiveNode struct {
+	IP            string `yaml:"-" json:"ip"`
+	MaintenanceIP string `yaml:"maintenanceIp" json:"maintenanceIp,omitempty"`
+
+	// Hostname names the node in the internal domain
+	Hostname string `yaml:"hostname" json:"hostname,omitempty"`
+}
+
+// ActiveNodes returns the nodes listed in cluster.nodes.active. They are read
+// from the underlying document rather than modelled, so saving a config
+// never rewrites the node entries.
+func (c *Config) ActiveNodes() []ActiveNode {
+	if c == nil || c.doc == nil {
+		return nil
+	}
+
+	node := c.doc.Content[0]
+	for _, key := range []string{"cluster", "nodes", "active"} {
+		if node = mappingValue(node, key); node == nil {
+			return nil
+		}
+	}
+
+	var nodes []ActiveNode
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		active := ActiveNode{IP: node.Content[i].Value}
+		// Entries that are not mappings still name a node
+		_ = node.Content[i+1].Decode(&active)
+		nodes = append(nodes, active)
+	}
+	return nodes
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Reservation pins the IP address a node gets from DHCP to its MAC address
+type Reservation struct {
+	MAC      string `yaml:"mac" json:"mac"`
+	IP       string `yaml:"ip" json:"ip"`
+	Hostname string `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+}
+
+// NormalizeMAC returns mac in the lowercase, colon-separated form dnsmasq
+// writes to its lease file
+func NormalizeMAC(mac string) (string, error) {
+	hw, err := net.ParseMAC(strings.TrimSpace(mac))
+	if err != nil || len(hw) != 6 {
+		return "", fmt.Errorf("must be a MAC address like 52:54:00:12:34:56")
+	}
+	return hw.String(), nil
+}
+
+// FindReservation returns the index of the reservation for mac, or -1
+func FindReservation(reservations []Reservation, mac string) int {
+	want, err := NormalizeMAC(mac)
+	if err != nil {
+		return -1
+	}
+	for i, reservation := range reservations {
+		if have, err := NormalizeMAC(reservation.MAC); err == nil && have == want {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateReservations checks every DHCP reservation. Addresses must be on
+// the LAN subnet, if known, and outside the dynamic range, if one is set.
+func (c *Config) validateReservations(v *ValidationError, subnet *net.IPNet, rangeStart, rangeEnd net.IP) {
+	macs := make(map[string]int)
+	ips := make(map[string]int)
+	hostnames := make(map[string]int)
+
+	for i, reservation := range c.Cluster.Nodes.Reservations {
+		field := fmt.Sprintf("cluster.nodes.reservations[%d]", i)
+
+		if mac, err := NormalizeMAC(reservation.MAC); err != nil {
+			v.add(field+".mac", "%v", err)
+		} else if first, ok := macs[mac]; ok {
+			v.add(field+".mac", "duplicates the MAC address of reservation %d", first)
+		} else {
+			macs[mac] = i
+		}
+
+		ip := net.ParseIP(reservation.IP).To4()
+		switch {
+		case ip == nil:
+			v.add(field+".ip", "must be an IPv4 address")
+		case subnet != nil && !subnet.Contains(ip):
+			v.add(field+".ip", "must be within subnet %s", subnet)
+		case rangeStart != nil && compareIPs(ip, rangeStart) >= 0 && compareIPs(ip, rangeEnd) <= 0:
+			v.add(field+".ip", "must be outside the dynamic DHCP range %s", c.Cloud.DHCPRange)
+		default:
+			if first, ok := ips[ip.String()]; ok {
+				v.add(field+".ip", "duplicates the IP address of reservation %d", first)
+			} else {
+				ips[ip.String()] = i
+			}
+		}
+
+		if hostname := reservation.Hostname; hostname != "" {
+			if !domainLabelPattern.MatchString(hostname) {
+				v.add(field+".hostname", "must be a single DNS label")
+			} else if first, ok := hostnames[strings.ToLower(hostname)]; ok {
+				v.add(field+".hostname", "duplicates the hostname of reservation %d", first)
+			} else {
+				hostnames[strings.ToLower(hostname)] = i
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reservationConfig returns a valid config on 192.168.8.0/24 with a
+// dynamic range of .100 to .200 and the given reservations
+func reservationConfig(reservations ...Reservation) *Config {
+	c := &Config{}
+	c.Cloud.Router.IP = "192.168.8.1"
+	c.Cloud.DNS.IP = "192.168.8.50"
+	c.Cloud.DHCPRange = "192.168.8.100,192.168.8.200"
+	c.Cluster.Nodes.Reservations = reservations
+	return c
+}
+
+// fieldErrors returns the validation errors of c as field: message lines
+func fieldErrors(t *testing.T, c *Config) []string {
+	t.Helper()
+	err := c.Validate()
+	if err == nil {
+		return nil
+	}
+	var v *ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("Validate returned %T, want *ValidationError", err)
+	}
+	var out []string
+	for _, fe := range v.Errors {
+		out = append(out, fe.Field+": "+fe.Message)
+	}
+	return out
+}
+
+func TestValidateReservationAddresses(t *testing.T) {
+	tests := []struct {
+		name   string
+		ip     string
+		modify func(*Config)
+		want   []string
+	}{
+		{name: "inside the subnet, below the range", ip: "192.168.8.21"},
+		{name: "just below the range", ip: "192.168.8.99"},
+		{name: "just above the range", ip: "192.168.8.201"},
+		{
+			name: "outside the subnet",
+			ip:   "192.168.9.21",
+			want: []string{"cluster.nodes.reservations[0].ip: must be within subnet 192.168.8.0/24"},
+		},
+		{
+			name:   "outside a /24 but inside the configured prefix",
+			ip:     "192.168.9.21",
+			modify: func(c *Config) { c.Cloud.SubnetPrefix = 16 },
+		},
+		{
+			name:   "outside the configured prefix",
+			ip:     "192.168.8.130",
+			modify: func(c *Config) { c.Cloud.SubnetPrefix = 25; c.Cloud.DHCPRange = "192.168.8.10,192.168.8.20" },
+			want:   []string{"cluster.nodes.reservations[0].ip: must be within subnet 192.168.8.0/25"},
+		},
+		{
+			name: "inside the range",
+			ip:   "192.168.8.150",
+			want: []string{"cluster.nodes.reservations[0].ip: must be outside the dynamic DHCP range 192.168.8.100,192.168.8.200"},
+		},
+		{
+			name: "first address of the range",
+			ip:   "192.168.8.100",
+			want: []string{"cluster.nodes.reservations[0].ip: must be outside the dynamic DHCP range 192.168.8.100,192.168.8.200"},
+		},
+		{
+			name: "last address of the range",
+			ip:   "192.168.8.200",
+			want: []string{"cluster.nodes.reservations[0].ip: must be outside the dynamic DHCP range 192.168.8.100,192.168.8.200"},
+		},
+		{
+			name:   "inside a range with a lease time",
+			ip:     "192.168.8.150",
+			modify: func(c *Config) { c.Cloud.DHCPRange = "192.168.8.100,192.168.8.200,24h" },
+			want:   []string{"cluster.nodes.reservations[0].ip: must be outside the dynamic DHCP range 192.168.8.100,192.168.8.200,24h"},
+		},
+		{
+			name:   "no range",
+			ip:     "192.168.8.150",
+			modify: func(c *Config) { c.Cloud.DHCPRange = "" },
+		},
+		{
+			name: "invalid range is reported once",
+			ip:   "192.168.8.150",
+			modify: func(c *Config) {
+				c.Cloud.DHCPRange = "192.168.8.200,192.168.8.100"
+			},
+			want: []string{"cloud.dhcpRange: start must not be after end"},
+		},
+		{
+			name: "no known subnet",
+			ip:   "10.1.2.3",
+			modify: func(c *Config) {
+				c.Cloud.Router.IP, c.Cloud.DNS.IP, c.Cloud.DHCPRange = "", "", ""
+			},
+		},
+		{
+			name: "not an IPv4 address",
+			ip:   "fd00::21",
+			want: []string{"cluster.nodes.reservations[0].ip: must be an IPv4 address"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := reservationConfig(Reservation{MAC: "52:54:00:aa:bb:01", IP: tt.ip})
+			if tt.modify != nil {
+				tt.modify(c)
+			}
+			if got := fieldErrors(t, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReservationDuplicates(t *testing.T) {
+	c := reservationConfig(
+		Reservation{MAC: "52:54:00:AA:BB:01", IP: "192.168.8.21", Hostname: "cp-1"},
+		Reservation{MAC: "52-54-00-aa-bb-01", IP: "192.168.8.22", Hostname: "cp-2"},
+		Reservation{MAC: "52:54:00:aa:bb:03", IP: "192.168.8.21", Hostname: "CP-1"},
+		Reservation{MAC: "not-a-mac", IP: "192.168.8.24", Hostname: "cp_4"},
+	)
+	want := []string{
+		"cluster.nodes.reservations[1].mac: duplicates the MAC address of reservation 0",
+		"cluster.nodes.reservations[2].ip: duplicates the IP address of reservation 0",
+		"cluster.nodes.reservations[2].hostname: duplicates the hostname of reservation 0",
+		"cluster.nodes.reservations[3].mac: must be a MAC address like 52:54:00:12:34:56",
+		"cluster.nodes.reservations[3].hostname: must be a single DNS label",
+	}
+	if got := fieldErrors(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFindReservation(t *testing.T) {
+	reservations := []Reservation{
+		{MAC: "52:54:00:aa:bb:01", IP: "192.168.8.21"},
+		{MAC: "52:54:00:AA:BB:02", IP: "192.168.8.22"},
+	}
+	tests := map[string]int{
+		"52:54:00:aa:bb:01": 0,
+		"52:54:00:AA:BB:01": 0,
+		"52-54-00-aa-bb-02": 1,
+		"52:54:00:aa:bb:03": -1,
+		"nonsense":          -1,
+	}
+	for mac, want := range tests {
+		if got := FindReservation(reservations, mac); got != want {
+			t.Errorf("FindReservation(%q) = %d, want %d", mac, got, want)
+		}
+	}
+}
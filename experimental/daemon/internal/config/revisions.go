@@ -0,0 +1,253 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrRevisionNotFound is returned when a revision does not exist
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// maxSummaryFields limits how many changed paths a revision summary names
+const maxSummaryFields = 5
+
+// Revision describes one accepted version of the config file
+type Revision struct {
+	ID        int       `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+	Summary   string    `json:"summary"`
+}
+
+// RevisionStore keeps numbered copies of every accepted config file. Each
+// revision is stored as NNNNNN.yaml with its metadata in NNNNNN.json.
+type RevisionStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewRevisionStore creates a revision store rooted at dir
+func NewRevisionStore(dir string) *RevisionStore {
+	return &RevisionStore{dir: dir}
+}
+
+// Record stores content as a new revision. If summary is empty one is
+// generated from the differences to the previous revision. Content identical
+// to the latest revision is not recorded again; the latest revision is
+// returned instead.
+func (s *RevisionStore) Record(content []byte, source, summary string) (*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	id := 1
+	var previous []byte
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		previous, err = os.ReadFile(s.contentPath(latest.ID))
+		if err != nil {
+			return nil, fmt.Errorf("reading revision %d: %w", latest.ID, err)
+		}
+		if bytes.Equal(previous, content) {
+			return &latest, nil
+		}
+		id = latest.ID + 1
+	}
+
+	if summary == "" {
+		if previous == nil {
+			summary = "initial revision"
+		} else {
+			summary = Summarize(previous, content)
+		}
+	}
+
+	revision := Revision{
+		ID:        id,
+		Timestamp: time.Now().UTC(),
+		Source:    source,
+		Summary:   summary,
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating revisions directory: %w", err)
+	}
+	if err := os.WriteFile(s.contentPath(id), content, 0644); err != nil {
+		return nil, fmt.Errorf("writing revision %d: %w", id, err)
+	}
+	meta, err := json.MarshalIndent(revision, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling revision %d: %w", id, err)
+	}
+	if err := os.WriteFile(s.metaPath(id), meta, 0644); err != nil {
+		return nil, fmt.Errorf("writing revision %d metadata: %w", id, err)
+	}
+
+	return &revision, nil
+}
+
+// List returns all revisions ordered from oldest to newest
+func (s *RevisionStore) List() ([]Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// Get returns a revision and the config file content it recorded
+func (s *RevisionStore) Get(id int) (*Revision, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meta, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrRevisionNotFound
+		}
+		return nil, nil, fmt.Errorf("reading revision %d metadata: %w", id, err)
+	}
+	var revision Revision
+	if err := json.Unmarshal(meta, &revision); err != nil {
+		return nil, nil, fmt.Errorf("parsing revision %d metadata: %w", id, err)
+	}
+
+	content, err := os.ReadFile(s.contentPath(id))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading revision %d: %w", id, err)
+	}
+	return &revision, content, nil
+}
+
+// Dir returns the directory holding the revisions
+func (s *RevisionStore) Dir() string {
+	return s.dir
+}
+
+// list reads all revision metadata; callers must hold s.mu
+func (s *RevisionStore) list() ([]Revision, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading revisions directory: %w", err)
+	}
+
+	var revisions []Revision
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimSuffix(name, ".json")); err != nil {
+			continue
+		}
+
+		meta, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading revision metadata %s: %w", name, err)
+		}
+		var revision Revision
+		if err := json.Unmarshal(meta, &revision); err != nil {
+			return nil, fmt.Errorf("parsing revision metadata %s: %w", name, err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].ID < revisions[j].ID })
+	return revisions, nil
+}
+
+func (s *RevisionStore) contentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d.yaml", id))
+}
+
+func (s *RevisionStore) metaPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d.json", id))
+}
+
+// Summarize describes which dotted paths differ between two YAML documents
+func Summarize(previous, current []byte) string {
+	before, errBefore := flattenYAML(previous)
+	after, errAfter := flattenYAML(current)
+	if errBefore != nil || errAfter != nil {
+		return "replaced configuration"
+	}
+
+	var changed []string
+	for path, value := range after {
+		if old, ok := before[path]; !ok {
+			changed = append(changed, "+"+path)
+		} else if old != value {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, "-"+path)
+		}
+	}
+
+	if len(changed) == 0 {
+		return "formatting or comments changed"
+	}
+
+	sort.Slice(changed, func(i, j int) bool {
+		return strings.TrimLeft(changed[i], "+-") < strings.TrimLeft(changed[j], "+-")
+	})
+	summary := "changed " + strings.Join(changed[:min(len(changed), maxSummaryFields)], ", ")
+	if len(changed) > maxSummaryFields {
+		summary += fmt.Sprintf(" and %d more", len(changed)-maxSummaryFields)
+	}
+	return summary
+}
+
+// flattenYAML maps every scalar in a YAML document to its dotted path
+func flattenYAML(content []byte) (map[string]string, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	flat := map[string]string{}
+	var walk func(value interface{}, path string)
+	walk = func(value interface{}, path string) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				walk(item, joinPath(path, key))
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		default:
+			if path != "" {
+				flat[path] = fmt.Sprint(v)
+			}
+		}
+	}
+	walk(doc, "")
+	return flat, nil
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
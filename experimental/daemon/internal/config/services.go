@@ -0,0 +1,63 @@
+package config
+
+import (
+	"regexp"
+	"sort"
+)
+
+// ServiceManagers are the accepted values of server.serviceManager
+var ServiceManagers = []string{"systemd", "openrc", "process", "none"}
+
+var (
+	serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	unitPattern        = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@:-]*$`)
+)
+
+// ServiceConfig tells the service manager how to control one service
+type ServiceConfig struct {
+	// Unit is the systemd unit or OpenRC service name
+	Unit string `yaml:"unit,omitempty" json:"unit,omitempty"`
+
+	// Command runs the service in the foreground under the process manager
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// validateServices checks the service manager settings
+func (c *Config) validateServices(v *ValidationError) {
+	manager := c.Server.ServiceManager
+	if manager != "" && !contains(ServiceManagers, manager) {
+		v.add("server.serviceManager", "must be one of %v", ServiceManagers)
+	}
+
+	names := make([]string, 0, len(c.Server.Services))
+	for name := range c.Server.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		service := c.Server.Services[name]
+		field := "server.services." + name
+		if !serviceNamePattern.MatchString(name) {
+			v.add(field, "service names use lowercase letters, digits, '-' and '_'")
+			continue
+		}
+		if service.Unit != "" && !unitPattern.MatchString(service.Unit) {
+			v.add(field+".unit", "must be a unit or service name")
+		}
+		// dnsmasq has a built-in command
+		if manager == "process" && name != "dnsmasq" && len(service.Command) == 0 {
+			v.add(field+".command", "is required by the process service manager")
+		}
+	}
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"net"
+	"strconv"
+)
+
+// DefaultTFTPPort is the port the embedded TFTP server listens on by default
+const DefaultTFTPPort = 69
+
+// TFTPServer configures the embedded TFTP server. When it is enabled, it
+// serves the PXE bootloaders from the assets tftp directory and dnsmasq's
+// own TFTP server is turned off.
+type TFTPServer struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Listen is the UDP address to serve on; it defaults to port 69 on
+	// cloud.dns.ip
+	Listen string `yaml:"listen" json:"listen"`
+}
+
+// TFTPListenAddress returns the address the embedded TFTP server listens on
+func (c *Config) TFTPListenAddress() string {
+	if listen := c.Cloud.TFTP.Server.Listen; listen != "" {
+		return listen
+	}
+	return net.JoinHostPort(c.Cloud.DNS.IP, strconv.Itoa(DefaultTFTPPort))
+}
+
+// validateTFTPServer checks the embedded TFTP server settings
+func (c *Config) validateTFTPServer(v *ValidationError) {
+	server := c.Cloud.TFTP.Server
+	validateListen(v, "cloud.tftp.server.listen", server.Listen, DefaultTFTPPort)
+	if server.Enabled && server.Listen == "" && c.Cloud.DNS.IP == "" {
+		v.add("cloud.tftp.server.listen", "is required when cloud.dns.ip is not set")
+	}
+}
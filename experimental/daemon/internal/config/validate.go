@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// DefaultSubnetPrefix is the prefix length of the LAN that the router, DNS
+// server, cluster endpoint and DHCP range must share when
+// cloud.subnetPrefix is not set
+const DefaultSubnetPrefix = 24
+
+var (
+	domainLabelPattern  = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+	talosVersionPattern = regexp.MustCompile(`^v\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`)
+	leaseTimePattern    = regexp.MustCompile(`^(\d+[smhdw]?|infinite)$`)
+)
+
+// FieldError describes a single invalid configuration field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every invalid field found in a configuration
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// add records a field error
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every invalid field, or nil if the configuration is valid. Empty optional
+// fields are accepted so a partially completed setup can still be saved.
+func (c *Config) Validate() error {
+	v := &ValidationError{}
+
+	if c.Version < 0 || c.Version > CurrentVersion() {
+		v.add("version", "must be between 0 and %d", CurrentVersion())
+	}
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		v.add("server.port", "must be between 0 and 65535 (0 for the default)")
+	}
+	if c.Server.Host != "" && net.ParseIP(c.Server.Host) == nil {
+		v.add("server.host", "must be an IP address")
+	}
+
+	validateDomain(v, "cloud.domain", c.Cloud.Domain)
+	validateDomain(v, "cloud.internalDomain", c.Cloud.InternalDomain)
+
+	dnsIP := validateIPv4(v, "cloud.dns.ip", c.Cloud.DNS.IP)
+	routerIP := validateIPv4(v, "cloud.router.ip", c.Cloud.Router.IP)
+	endpointIP := validateIPv4(v, "cluster.endpointIp", c.Cluster.EndpointIP)
+
+	// The router, DNS server and cluster endpoint must all sit on one LAN
+	prefix := c.SubnetPrefixLength()
+	if p := c.Cloud.SubnetPrefix; p != 0 && (p < 8 || p > 30) {
+		v.add("cloud.subnetPrefix", "must be between 8 and 30")
+		prefix = DefaultSubnetPrefix
+	}
+	var subnet *net.IPNet
+	for _, candidate := range []struct {
+		field string
+		ip    net.IP
+	}{
+		{"cloud.router.ip", routerIP},
+		{"cloud.dns.ip", dnsIP},
+		{"cluster.endpointIp", endpointIP},
+	} {
+		if candidate.ip == nil {
+			continue
+		}
+		if subnet == nil {
+			subnet = subnetOf(candidate.ip, prefix)
+			continue
+		}
+		if !subnet.Contains(candidate.ip) {
+			v.add(candidate.field, "must be in the same subnet as the other addresses (%s); set cloud.subnetPrefix if the LAN is larger", subnet)
+		}
+	}
+
+	var rangeStart, rangeEnd net.IP
+	if c.Cloud.DHCPRange != "" {
+		start, end, err := ParseDHCPRange(c.Cloud.DHCPRange)
+		switch {
+		case err != nil:
+			v.add("cloud.dhcpRange", "%v", err)
+		case subnet != nil && (!subnet.Contains(start) || !subnet.Contains(end)):
+			v.add("cloud.dhcpRange", "must be within subnet %s", subnet)
+		default:
+			rangeStart, rangeEnd = start, end
+		}
+	}
+
+	if mode := c.Cloud.DHCPMode; mode != "" && !contains(DHCPModes, mode) {
+		v.add("cloud.dhcpMode", "must be one of %v", DHCPModes)
+	}
+
+	if iface := c.Cloud.Dnsmasq.Interface; iface != "" {
+		if msg := checkInterfaceName(iface); msg != "" {
+			v.add("cloud.dnsmasq.interface", "%s", msg)
+		}
+	}
+
+	if version := c.Cluster.Nodes.Talos.Version; version != "" && !talosVersionPattern.MatchString(version) {
+		v.add("cluster.nodes.talos.version", "must look like v1.10.4")
+	}
+
+	c.validateReservations(v, subnet, rangeStart, rangeEnd)
+	c.validateServices(v)
+	c.validateDNSServer(v)
+	c.validateDNSRecords(v)
+	c.validateTFTPServer(v)
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
+
+// ParseDHCPRange parses a dnsmasq-style "start,end" DHCP range. An optional
+// trailing lease time, like 24h, is checked but not returned.
+func ParseDHCPRange(dhcpRange string) (net.IP, net.IP, error) {
+	parts := strings.Split(dhcpRange, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, nil, fmt.Errorf("must be in the form start,end or start,end,lease-time")
+	}
+	if len(parts) == 3 && !leaseTimePattern.MatchString(strings.TrimSpace(parts[2])) {
+		return nil, nil, fmt.Errorf("lease time must be a number of seconds, optionally followed by s, m, h, d or w, or infinite")
+	}
+
+	start := net.ParseIP(strings.TrimSpace(parts[0])).To4()
+	end := net.ParseIP(strings.TrimSpace(parts[1])).To4()
+	if start == nil || end == nil {
+		return nil, nil, fmt.Errorf("start and end must be IPv4 addresses")
+	}
+	if compareIPs(start, end) > 0 {
+		return nil, nil, fmt.Errorf("start must not be after end")
+	}
+	return start, end, nil
+}
+
+// validateIPv4 checks an optional IPv4 address field and returns the parsed
+// address if it is valid
+func validateIPv4(v *ValidationError, field, value string) net.IP {
+	if value == "" {
+		return nil
+	}
+	ip := net.ParseIP(value).To4()
+	if ip == nil {
+		v.add(field, "must be an IPv4 address")
+		return nil
+	}
+	return ip
+}
+
+// validateDomain checks an optional DNS domain name field
+func validateDomain(v *ValidationError, field, value string) {
+	if value == "" {
+		return
+	}
+	if len(value) > 253 {
+		v.add(field, "must be at most 253 characters")
+		return
+	}
+	labels := strings.Split(strings.TrimSuffix(value, "."), ".")
+	if len(labels) < 2 {
+		v.add(field, "must be a fully qualified domain name")
+		return
+	}
+	for _, label := range labels {
+		if !domainLabelPattern.MatchString(label) {
+			v.add(field, "contains invalid label %q", label)
+			return
+		}
+	}
+}
+
+// checkInterfaceName applies the Linux network interface naming rules and
+// returns a description of the problem, if any
+func checkInterfaceName(name string) string {
+	if len(name) > 15 {
+		return "must be at most 15 characters"
+	}
+	if name == "." || name == ".." {
+		return "must not be . or .."
+	}
+	if strings.ContainsAny(name, "/: \t\n") {
+		return "must not contain '/', ':' or whitespace"
+	}
+	return ""
+}
+
+// SubnetPrefixLength returns the prefix length of the LAN, from
+// cloud.subnetPrefix or else DefaultSubnetPrefix
+func (c *Config) SubnetPrefixLength() int {
+	if p := c.Cloud.SubnetPrefix; p >= 8 && p <= 30 {
+		return p
+	}
+	return DefaultSubnetPrefix
+}
+
+// subnetOf returns the network with the given prefix length containing ip
+func subnetOf(ip net.IP, prefix int) *net.IPNet {
+	mask := net.CIDRMask(prefix, 32)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// compareIPs compares two IPv4 addresses numerically
+func compareIPs(a, b net.IP) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often the watcher checks the config file
+const DefaultWatchInterval = 2 * time.Second
+
+// Watcher polls the config file for changes made outside the daemon, such as
+// hand edits or wild-config-set. Polling is used instead of inotify because
+// editors commonly replace the file rather than writing it in place.
+type Watcher struct {
+	path     string
+	interval time.Duration
+
+	// lock is held while checking the file and running callbacks so a
+	// reload never interleaves with a write made through the API
+	lock sync.Locker
+
+	// OnChange is called with a new valid config and the file contents
+	OnChange func(cfg *Config, content []byte)
+	// OnInvalid is called when the file changed but cannot be used; the
+	// previous config stays active
+	OnInvalid func(err error)
+
+	mu       sync.Mutex
+	lastSum  [sha256.Size]byte
+	seen     bool
+	modTime  time.Time
+	fileSize int64
+}
+
+// NewWatcher creates a watcher for the config file at path. lock may be nil.
+func NewWatcher(path string, interval time.Duration, lock sync.Locker) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	return &Watcher{path: path, interval: interval, lock: lock}
+}
+
+// Acknowledge records content as the current file contents so that writes
+// made by the daemon itself are not reported as external changes
+func (w *Watcher) Acknowledge(content []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastSum = sha256.Sum256(content)
+	w.seen = true
+	if info, err := os.Stat(w.path); err == nil {
+		w.modTime, w.fileSize = info.ModTime(), info.Size()
+	}
+}
+
+// Start polls the config file until ctx is cancelled
+func (w *Watcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// Check looks at the config file once and runs the callbacks if it changed
+func (w *Watcher) Check() {
+	if w.lock != nil {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+	}
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Failed to stat config file", "error", err)
+		}
+		return
+	}
+
+	w.mu.Lock()
+	unchanged := w.seen && info.ModTime().Equal(w.modTime) && info.Size() == w.fileSize
+	w.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		slog.Error("Failed to read config file", "error", err)
+		return
+	}
+	sum := sha256.Sum256(content)
+
+	w.mu.Lock()
+	changed := !w.seen || sum != w.lastSum
+	w.lastSum, w.seen = sum, true
+	w.modTime, w.fileSize = info.ModTime(), info.Size()
+	w.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	cfg, err := Parse(content)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		slog.Warn("Ignoring invalid config file change, keeping previous config", "error", err)
+		if w.OnInvalid != nil {
+			w.OnInvalid(err)
+		}
+		return
+	}
+
+	slog.Info("Config file changed on disk, reloading")
+	if w.OnChange != nil {
+		w.OnChange(cfg, content)
+	}
+}
@@ -2,7 +2,7 @@ package data
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,17 +10,46 @@ import (
 
 // Paths represents the data directory paths configuration
 type Paths struct {
-	ConfigFile  string
+	ConfigFile   string
+	DataDir      string
+	LogsDir      string
+	AssetsDir    string
+	DnsmasqConf  string
+	SecretsFile  string
+	RevisionsDir string
+
+	// DnsmasqTemplate and DnsmasqSnippetsDir customize the generated
+	// dnsmasq config; both are optional
+	DnsmasqTemplate    string
+	DnsmasqSnippetsDir string
+
+	// DnsmasqLeases is the lease file dnsmasq maintains
+	DnsmasqLeases string
+}
+
+// Overrides replaces individual paths that would otherwise be derived from
+// the detected environment. Empty fields keep the default.
+type Overrides struct {
 	DataDir     string
-	LogsDir     string
+	ConfigFile  string
 	AssetsDir   string
 	DnsmasqConf string
+
+	DnsmasqTemplate    string
+	DnsmasqSnippetsDir string
+	DnsmasqLeases      string
 }
 
 // Manager handles data directory management
 type Manager struct {
-	dataDir string
-	isDev   bool
+	dataDir   string
+	isDev     bool
+	overrides Overrides
+
+	// local is set when every path that is not overridden lives under the
+	// data directory: in development and whenever the data directory is
+	// given explicitly
+	local bool
 }
 
 // NewManager creates a new data manager
@@ -28,42 +57,82 @@ func NewManager() *Manager {
 	return &Manager{}
 }
 
+// SetOverrides sets paths that take precedence over the detected defaults;
+// it must be called before Initialize
+func (m *Manager) SetOverrides(overrides Overrides) {
+	m.overrides = overrides
+}
+
 // Initialize sets up the data directory structure
 func (m *Manager) Initialize() error {
-	// Detect environment: development vs production
-	m.isDev = m.isDevelopmentMode()
-	
 	var dataDir string
-	if m.isDev {
+	if m.overrides.DataDir != "" {
+		// An explicit data directory needs no guessing: the paths that are
+		// not overridden are derived from it
+		absDir, err := filepath.Abs(m.overrides.DataDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve data directory: %w", err)
+		}
+		dataDir = absDir
+		m.local = true
+		slog.Info("Using data directory", "dir", dataDir)
+	} else if m.isDev = m.isDevelopmentMode(); m.isDev {
 		// Development mode: use .wildcloud in current directory
 		cwd, err := os.Getwd()
 		if err != nil {
 			return fmt.Errorf("failed to get current directory: %w", err)
 		}
 		dataDir = filepath.Join(cwd, ".wildcloud")
-		log.Printf("Running in development mode, using data directory: %s", dataDir)
+		m.local = true
+		slog.Info("Running in development mode", "dataDir", dataDir)
 	} else {
 		// Production mode: use standard Linux directories
 		dataDir = "/var/lib/wild-cloud-central"
-		log.Printf("Running in production mode, using data directory: %s", dataDir)
+		slog.Info("Running in production mode", "dataDir", dataDir)
 	}
 	
 	m.dataDir = dataDir
 	
-	// Create directory structure
-	paths := m.GetPaths()
+	if err := m.CreateDirs(); err != nil {
+		return err
+	}
 	
-	// Create all necessary directories
+	slog.Debug("Data directory structure initialized", "dir", dataDir)
+	return nil
+}
+
+// CreateDirs creates the data, logs and assets directories
+func (m *Manager) CreateDirs() error {
+	paths := m.GetPaths()
 	for _, dir := range []string{paths.DataDir, paths.LogsDir, paths.AssetsDir} {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 	}
-	
-	log.Printf("Data directory structure initialized at: %s", dataDir)
 	return nil
 }
 
+// InstancesDir returns the directory holding named instances
+func (m *Manager) InstancesDir() string {
+	return filepath.Join(m.dataDir, "instances")
+}
+
+// ForInstance returns a manager for a named instance kept in its own
+// directory under InstancesDir. All its files live in that directory except
+// the dnsmasq config and lease file, which are shared by every instance.
+func (m *Manager) ForInstance(name string) *Manager {
+	paths := m.GetPaths()
+	return &Manager{
+		dataDir: filepath.Join(m.InstancesDir(), name),
+		isDev:   m.isDev,
+		local:   true,
+		overrides: Overrides{
+			DnsmasqConf:   paths.DnsmasqConf,
+			DnsmasqLeases: paths.DnsmasqLeases,
+		},
+	}
+}
+
 // isDevelopmentMode detects if we're running in development mode
 func (m *Manager) isDevelopmentMode() bool {
 	// Check multiple indicators for development mode
@@ -98,23 +167,60 @@ func (m *Manager) isDevelopmentMode() bool {
 	return true
 }
 
-// GetPaths returns the appropriate paths for the current environment
+// GetPaths returns the appropriate paths for the current environment, with
+// any overrides applied
 func (m *Manager) GetPaths() Paths {
-	if m.isDev {
+	paths := m.defaultPaths()
+	if m.overrides.ConfigFile != "" {
+		paths.ConfigFile = m.overrides.ConfigFile
+	}
+	if m.overrides.AssetsDir != "" {
+		paths.AssetsDir = m.overrides.AssetsDir
+	}
+	if m.overrides.DnsmasqConf != "" {
+		paths.DnsmasqConf = m.overrides.DnsmasqConf
+	}
+	if m.overrides.DnsmasqTemplate != "" {
+		paths.DnsmasqTemplate = m.overrides.DnsmasqTemplate
+	}
+	if m.overrides.DnsmasqSnippetsDir != "" {
+		paths.DnsmasqSnippetsDir = m.overrides.DnsmasqSnippetsDir
+	}
+	if m.overrides.DnsmasqLeases != "" {
+		paths.DnsmasqLeases = m.overrides.DnsmasqLeases
+	}
+	return paths
+}
+
+// defaultPaths returns the paths used when nothing is overridden
+func (m *Manager) defaultPaths() Paths {
+	if m.local {
 		return Paths{
-			ConfigFile:  filepath.Join(m.dataDir, "config.yaml"),
-			DataDir:     m.dataDir,
-			LogsDir:     filepath.Join(m.dataDir, "logs"),
-			AssetsDir:   filepath.Join(m.dataDir, "assets"),
-			DnsmasqConf: filepath.Join(m.dataDir, "dnsmasq.conf"),
+			ConfigFile:   filepath.Join(m.dataDir, "config.yaml"),
+			DataDir:      m.dataDir,
+			LogsDir:      filepath.Join(m.dataDir, "logs"),
+			AssetsDir:    filepath.Join(m.dataDir, "assets"),
+			DnsmasqConf:  filepath.Join(m.dataDir, "dnsmasq.conf"),
+			SecretsFile:  filepath.Join(m.dataDir, "secrets.yaml"),
+			RevisionsDir: filepath.Join(m.dataDir, "revisions"),
+
+			DnsmasqTemplate:    filepath.Join(m.dataDir, "dnsmasq.conf.tmpl"),
+			DnsmasqSnippetsDir: filepath.Join(m.dataDir, "dnsmasq.d"),
+			DnsmasqLeases:      filepath.Join(m.dataDir, "dnsmasq.leases"),
 		}
 	} else {
 		return Paths{
-			ConfigFile:  "/etc/wild-cloud-central/config.yaml",
-			DataDir:     m.dataDir,
-			LogsDir:     "/var/log/wild-cloud-central",
-			AssetsDir:   "/var/www/html/wild-central",
-			DnsmasqConf: "/etc/dnsmasq.conf",
+			ConfigFile:   "/etc/wild-cloud-central/config.yaml",
+			DataDir:      m.dataDir,
+			LogsDir:      "/var/log/wild-cloud-central",
+			AssetsDir:    "/var/www/html/wild-central",
+			DnsmasqConf:  "/etc/dnsmasq.conf",
+			SecretsFile:  filepath.Join(m.dataDir, "secrets.yaml"),
+			RevisionsDir: filepath.Join(m.dataDir, "revisions"),
+
+			DnsmasqTemplate:    "/etc/wild-cloud-central/dnsmasq.conf.tmpl",
+			DnsmasqSnippetsDir: "/etc/wild-cloud-central/dnsmasq.d",
+			DnsmasqLeases:      "/var/lib/misc/dnsmasq.leases",
 		}
 	}
 }
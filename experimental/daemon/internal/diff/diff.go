@@ -0,0 +1,167 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// opKind identifies a line-level edit operation
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// op is a single line in the edit script
+type op struct {
+	kind opKind
+	a, b int // line indices in the old and new text
+}
+
+// Unified returns a unified diff between two texts, or an empty string if
+// they are identical
+func Unified(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	a := splitLines(from)
+	b := splitLines(to)
+	ops := editScript(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == opEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				break
+			}
+			end = run
+		}
+
+		lo := max(start-contextLines, 0)
+		hi := min(end+contextLines, len(ops))
+		writeHunk(&out, ops[lo:hi], a, b)
+		start = hi
+	}
+
+	return out.String()
+}
+
+// writeHunk renders one hunk of the edit script
+func writeHunk(out *strings.Builder, ops []op, a, b []string) {
+	aStart, bStart := ops[0].a, ops[0].b
+	aCount, bCount := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			aCount++
+		}
+		if o.kind != opDelete {
+			bCount++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			writeLine(out, ' ', a[o.a])
+		case opDelete:
+			writeLine(out, '-', a[o.a])
+		case opInsert:
+			writeLine(out, '+', b[o.b])
+		}
+	}
+}
+
+// hunkRange formats a "start,count" hunk range with 1-based line numbers
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writeLine(out *strings.Builder, prefix byte, line string) {
+	out.WriteByte(prefix)
+	out.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// splitLines splits text into lines, keeping the line terminators
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript computes a minimal line edit script from a to b using the
+// longest common subsequence
+func editScript(a, b []string) []op {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]op, 0, n+m)
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, op{opEqual, i, j})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{opDelete, i, j})
+			i++
+		default:
+			ops = append(ops, op{opInsert, i, j})
+			j++
+		}
+	}
+	return ops
+}
@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines 1 to n, one number per line, with the given
+// lines replaced
+func numbered(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		line, ok := replace[i]
+		if !ok {
+			line = strconv.Itoa(i)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// The expected hunks are the output of GNU diff -u for the same inputs
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{
+			name: "identical",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "insertion in the middle",
+			from: "a\nb\nc\nd\ne\nf\ng\nh\n",
+			to:   "a\nb\nc\nd\nX\ne\nf\ng\nh\n",
+			want: "@@ -2,6 +2,7 @@\n b\n c\n d\n+X\n e\n f\n g\n",
+		},
+		{
+			name: "changes six lines apart share a hunk",
+			from: numbered(11, nil),
+			to:   numbered(11, map[int]string{2: "TWO", 9: "NINE"}),
+			want: "@@ -1,11 +1,11 @@\n 1\n-2\n+TWO\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+NINE\n 10\n 11\n",
+		},
+		{
+			name: "changes seven lines apart get separate hunks",
+			from: numbered(12, nil),
+			to:   numbered(12, map[int]string{2: "TWO", 10: "TEN"}),
+			want: "@@ -1,5 +1,5 @@\n 1\n-2\n+TWO\n 3\n 4\n 5\n" +
+				"@@ -7,6 +7,6 @@\n 7\n 8\n 9\n-10\n+TEN\n 11\n 12\n",
+		},
+		{
+			name: "changes at the start and the end",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			to:   "0\n1\n2\n3\n4\n5\n6\n7\n8\n",
+			want: "@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n" +
+				"@@ -6,4 +7,3 @@\n 6\n 7\n 8\n-9\n",
+		},
+		{
+			name: "empty old file",
+			from: "",
+			to:   "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "empty new file",
+			from: "a\nb\n",
+			to:   "",
+			want: "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "no newline at the end of either file",
+			from: "a\nb",
+			to:   "a\nc",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name: "newline added at the end",
+			from: "a\nb",
+			to:   "a\nb\n",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "unchanged last line without a newline",
+			from: "a\nb\nc",
+			to:   "x\nb\nc",
+			want: "@@ -1,3 +1,3 @@\n-a\n+x\n b\n c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want != "" {
+				want = "--- old\n+++ new\n" + want
+			}
+			if got := Unified("old", "new", tt.from, tt.to); got != want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start, count int
+		want         string
+	}{
+		{0, 0, "0,0"},
+		{4, 0, "4,0"},
+		{0, 1, "1"},
+		{4, 1, "5"},
+		{0, 3, "1,3"},
+		{4, 2, "5,2"},
+	}
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %q, want %q", tt.start, tt.count, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Package dns is a small authoritative DNS server for the cloud domains. It
+// answers from records built out of the config and forwards every other
+// query to upstream resolvers.
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Record types
+const (
+	TypeA     uint16 = 1
+	TypeNS    uint16 = 2
+	TypeCNAME uint16 = 5
+	TypeSOA   uint16 = 6
+	TypeTXT   uint16 = 16
+	TypeAAAA  uint16 = 28
+	TypeSRV   uint16 = 33
+	TypeANY   uint16 = 255
+)
+
+// Classes
+const (
+	ClassINET uint16 = 1
+	ClassANY  uint16 = 255
+)
+
+// Response codes
+const (
+	RcodeSuccess        = 0
+	RcodeFormatError    = 1
+	RcodeServerFailure  = 2
+	RcodeNameError      = 3
+	RcodeNotImplemented = 4
+	RcodeRefused        = 5
+)
+
+// Header flag bits
+const (
+	flagResponse           = 1 << 15
+	flagAuthoritative      = 1 << 10
+	flagTruncated          = 1 << 9
+	flagRecursionDesired   = 1 << 8
+	flagRecursionAvailable = 1 << 7
+)
+
+const (
+	headerLen = 12
+
+	// maxUDPSize is the largest response sent over UDP to a client that did
+	// not negotiate a bigger one
+	maxUDPSize = 512
+
+	// maxPointers bounds compression pointer chains when reading names
+	maxPointers = 16
+)
+
+var errMalformed = errors.New("malformed DNS message")
+
+// Question is the question section of a query
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// Resource is a resource record with packed record data
+type Resource struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// Message is a DNS message. Only the header and question are read from
+// queries; answers are only ever written.
+type Message struct {
+	ID        uint16
+	Flags     uint16
+	Questions []Question
+	Answers   []Resource
+	Authority []Resource
+}
+
+// Opcode returns the kind of query
+func (m *Message) Opcode() int {
+	return int(m.Flags>>11) & 0xf
+}
+
+// Rcode returns the response code
+func (m *Message) Rcode() int {
+	return int(m.Flags & 0xf)
+}
+
+// parseQuery reads the header and questions of a query. The header is
+// returned even when the questions are malformed so the error can be
+// answered.
+func parseQuery(b []byte) (*Message, error) {
+	if len(b) < headerLen {
+		return nil, errMalformed
+	}
+	m := &Message{
+		ID:    binary.BigEndian.Uint16(b[0:]),
+		Flags: binary.BigEndian.Uint16(b[2:]),
+	}
+	count := int(binary.BigEndian.Uint16(b[4:]))
+
+	off := headerLen
+	for i := 0; i < count; i++ {
+		name, next, err := readName(b, off)
+		if err != nil || next+4 > len(b) {
+			return m, errMalformed
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[next:]),
+			Class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+	return m, nil
+}
+
+// reply starts a response to query carrying its ID, opcode, recursion
+// desired bit and questions
+func reply(query *Message, rcode int) *Message {
+	flags := flagResponse | flagRecursionAvailable | query.Flags&(0xf<<11|flagRecursionDesired) | uint16(rcode)
+	return &Message{ID: query.ID, Flags: flags, Questions: query.Questions}
+}
+
+// pack encodes the message. Names are written without compression.
+func (m *Message) pack() ([]byte, error) {
+	b := make([]byte, headerLen, maxUDPSize)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.Flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authority)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+	for _, section := range [][]Resource{m.Answers, m.Authority} {
+		for _, rr := range section {
+			if b, err = appendName(b, rr.Name); err != nil {
+				return nil, err
+			}
+			b = binary.BigEndian.AppendUint16(b, rr.Type)
+			b = binary.BigEndian.AppendUint16(b, rr.Class)
+			b = binary.BigEndian.AppendUint32(b, rr.TTL)
+			b = binary.BigEndian.AppendUint16(b, uint16(len(rr.Data)))
+			b = append(b, rr.Data...)
+		}
+	}
+	return b, nil
+}
+
+// packUDP encodes the message for a UDP response, dropping the records and
+// setting the truncated bit if it does not fit so the client retries over
+// TCP
+func (m *Message) packUDP() ([]byte, error) {
+	b, err := m.pack()
+	if err != nil || len(b) <= maxUDPSize {
+		return b, err
+	}
+	truncated := *m
+	truncated.Flags |= flagTruncated
+	truncated.Answers, truncated.Authority = nil, nil
+	return truncated.pack()
+}
+
+// readName reads a possibly compressed domain name at off and returns it in
+// lowercase with a trailing dot, along with the offset after it
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for pointers := 0; ; {
+		if off >= len(b) {
+			return "", 0, errMalformed
+		}
+		length := int(b[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")) + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(b) || pointers >= maxPointers {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			pointers++
+		case length&0xc0 != 0:
+			return "", 0, errMalformed
+		default:
+			if off+1+length > len(b) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(b[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// appendName appends a domain name in wire format
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("invalid domain name %q", name)
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+// Fqdn returns name in lowercase with a trailing dot
+func Fqdn(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+// AddressRecord returns an A or AAAA record for ip
+func AddressRecord(name string, ip net.IP, ttl uint32) Resource {
+	if ip4 := ip.To4(); ip4 != nil {
+		return Resource{Name: Fqdn(name), Type: TypeA, Class: ClassINET, TTL: ttl, Data: []byte(ip4)}
+	}
+	return Resource{Name: Fqdn(name), Type: TypeAAAA, Class: ClassINET, TTL: ttl, Data: []byte(ip.To16())}
+}
+
+// CNAMERecord returns a CNAME record pointing name at target
+func CNAMERecord(name, target string, ttl uint32) Resource {
+	data, _ := appendName(nil, Fqdn(target))
+	return Resource{Name: Fqdn(name), Type: TypeCNAME, Class: ClassINET, TTL: ttl, Data: data}
+}
+
+// TXTRecord returns a TXT record, splitting text into strings of at most 255
+// bytes
+func TXTRecord(name, text string, ttl uint32) Resource {
+	var data []byte
+	for len(text) > 255 {
+		data = append(append(data, 255), text[:255]...)
+		text = text[255:]
+	}
+	data = append(append(data, byte(len(text))), text...)
+	return Resource{Name: Fqdn(name), Type: TypeTXT, Class: ClassINET, TTL: ttl, Data: data}
+}
+
+// SRVRecord returns an SRV record for a service at target:port
+func SRVRecord(name string, priority, weight, port uint16, target string, ttl uint32) Resource {
+	data := binary.BigEndian.AppendUint16(nil, priority)
+	data = binary.BigEndian.AppendUint16(data, weight)
+	data = binary.BigEndian.AppendUint16(data, port)
+	data, _ = appendName(data, Fqdn(target))
+	return Resource{Name: Fqdn(name), Type: TypeSRV, Class: ClassINET, TTL: ttl, Data: data}
+}
+
+// TypeName returns the mnemonic of a record type
+func TypeName(t uint16) string {
+	switch t {
+	case TypeA:
+		return "A"
+	case TypeNS:
+		return "NS"
+	case TypeCNAME:
+		return "CNAME"
+	case TypeSOA:
+		return "SOA"
+	case TypeTXT:
+		return "TXT"
+	case TypeAAAA:
+		return "AAAA"
+	case TypeSRV:
+		return "SRV"
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// Value returns the record data in zone file notation
+func (rr Resource) Value() string {
+	switch rr.Type {
+	case TypeA, TypeAAAA:
+		return net.IP(rr.Data).String()
+	case TypeNS, TypeCNAME:
+		if name, _, err := readName(rr.Data, 0); err == nil {
+			return name
+		}
+	case TypeTXT:
+		var texts []string
+		for data := rr.Data; len(data) > 0 && int(data[0]) < len(data); data = data[1+int(data[0]):] {
+			texts = append(texts, strconv.Quote(string(data[1:1+int(data[0])])))
+		}
+		return strings.Join(texts, " ")
+	case TypeSRV:
+		if len(rr.Data) < 6 {
+			break
+		}
+		if target, _, err := readName(rr.Data, 6); err == nil {
+			d := rr.Data
+			return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(d), binary.BigEndian.Uint16(d[2:]), binary.BigEndian.Uint16(d[4:]), target)
+		}
+	}
+	return fmt.Sprintf("%x", rr.Data)
+}
+
+// soaRecord returns the SOA record of a zone
+func soaRecord(origin string, serial, ttl uint32) Resource {
+	data, _ := appendName(nil, origin)
+	data, _ = appendName(data, "hostmaster."+origin)
+	for _, v := range []uint32{serial, 3600, 600, 86400, ttl} {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	return Resource{Name: origin, Type: TypeSOA, Class: ClassINET, TTL: ttl, Data: data}
+}
@@ -0,0 +1,303 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wild-cloud-central/internal/config"
+)
+
+const (
+	// upstreamTimeout bounds each attempt to forward a query
+	upstreamTimeout = 2 * time.Second
+
+	// tcpIdleTimeout closes TCP connections that stop sending queries
+	tcpIdleTimeout = 10 * time.Second
+
+	// maxMessageSize is the largest DNS message over either transport
+	maxMessageSize = 65535
+)
+
+// Server answers queries for its zone over UDP and TCP and forwards the
+// rest. The zone and upstreams can be replaced at any time without
+// interrupting the listeners.
+type Server struct {
+	view atomic.Pointer[view]
+
+	mu     sync.Mutex
+	listen string
+	udp    net.PacketConn
+	tcp    net.Listener
+}
+
+// view is what queries are answered from; it is replaced as a whole
+type view struct {
+	zone      *Zone
+	upstreams []string
+}
+
+// NewServer creates a stopped server with an empty zone
+func NewServer() *Server {
+	s := &Server{}
+	s.SetZone(NewZone(config.DefaultDNSTTL), nil)
+	return s
+}
+
+// SetZone replaces the zone and the upstream resolvers
+func (s *Server) SetZone(zone *Zone, upstreams []string) {
+	s.view.Store(&view{zone: zone, upstreams: upstreams})
+}
+
+// Zone returns the zone queries are currently answered from
+func (s *Server) Zone() *Zone {
+	return s.view.Load().zone
+}
+
+// Update rebuilds the zone from cfg and starts, stops or moves the
+// listeners to match its cloud.dns.server settings
+func (s *Server) Update(cfg *config.Config) error {
+	s.SetZone(BuildZone(cfg), cfg.DNSUpstreams())
+
+	var listen string
+	if cfg.Cloud.DNS.Server.Enabled {
+		listen = cfg.DNSListenAddress()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if listen == s.listen {
+		return nil
+	}
+	s.stopLocked()
+	if listen == "" {
+		return nil
+	}
+	return s.startLocked(listen)
+}
+
+// Start listens on addr over UDP and TCP, replacing any earlier listeners.
+// A port of 0 picks a free port, the same for both; see Addr.
+func (s *Server) Start(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+	return s.startLocked(addr)
+}
+
+// Stop closes the listeners
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+}
+
+// Addr returns the address the server listens on, or "" if it is stopped
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.udp == nil {
+		return ""
+	}
+	return s.udp.LocalAddr().String()
+}
+
+// startLocked opens the listeners. s.mu must be held.
+func (s *Server) startLocked(addr string) error {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("starting DNS server: %w", err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return fmt.Errorf("starting DNS server: %w", err)
+	}
+
+	s.listen, s.udp, s.tcp = addr, udp, tcp
+	go s.serveUDP(udp)
+	go s.serveTCP(tcp)
+	slog.Info("DNS server listening", "addr", udp.LocalAddr())
+	return nil
+}
+
+// stopLocked closes the listeners. s.mu must be held.
+func (s *Server) stopLocked() {
+	if s.udp == nil {
+		return
+	}
+	s.udp.Close()
+	s.tcp.Close()
+	slog.Info("DNS server stopped", "addr", s.udp.LocalAddr())
+	s.listen, s.udp, s.tcp = "", nil, nil
+}
+
+// serveUDP answers each datagram in its own goroutine until conn is closed
+func (s *Server) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("DNS server", "error", err)
+			continue
+		}
+
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if response := s.handle(query, "udp"); response != nil {
+				conn.WriteTo(response, from)
+			}
+		}()
+	}
+}
+
+// serveTCP serves each connection in its own goroutine until l is closed
+func (s *Server) serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("DNS server", "error", err)
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers length-prefixed queries on a TCP connection until it
+// goes idle
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+		query, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+		response := s.handle(query, "tcp")
+		if response == nil || writeTCPMessage(conn, response) != nil {
+			return
+		}
+	}
+}
+
+// handle answers a query, returning nil if it should be dropped
+func (s *Server) handle(query []byte, network string) []byte {
+	m, err := parseQuery(query)
+	if m == nil || m.Flags&flagResponse != 0 {
+		return nil
+	}
+	if err != nil || len(m.Questions) != 1 {
+		return s.pack(reply(m, RcodeFormatError), network)
+	}
+	if m.Opcode() != 0 {
+		return s.pack(reply(m, RcodeNotImplemented), network)
+	}
+
+	v := s.view.Load()
+	q := m.Questions[0]
+	answer, ok := v.zone.Lookup(q)
+	if !ok {
+		return s.forward(query, m, v.upstreams, network)
+	}
+	if q.Class != ClassINET && q.Class != ClassANY {
+		return s.pack(reply(m, RcodeRefused), network)
+	}
+
+	response := reply(m, answer.Rcode())
+	response.Flags |= flagAuthoritative
+	response.Answers = answer.Answers
+	response.Authority = answer.Authority
+	return s.pack(response, network)
+}
+
+// forward relays a query to the first upstream that answers it
+func (s *Server) forward(query []byte, m *Message, upstreams []string, network string) []byte {
+	if len(upstreams) == 0 {
+		return s.pack(reply(m, RcodeRefused), network)
+	}
+	for _, upstream := range upstreams {
+		response, err := exchange(network, upstream, query)
+		if err == nil && len(response) >= headerLen && binary.BigEndian.Uint16(response) == m.ID {
+			return response
+		}
+		if err == nil {
+			err = errMalformed
+		}
+		slog.Warn("DNS upstream failed", "upstream", upstream, "name", m.Questions[0].Name, "error", err)
+	}
+	return s.pack(reply(m, RcodeServerFailure), network)
+}
+
+// pack encodes a response for network, logging encoding errors
+func (s *Server) pack(m *Message, network string) []byte {
+	var b []byte
+	var err error
+	if network == "udp" {
+		b, err = m.packUDP()
+	} else {
+		b, err = m.pack()
+	}
+	if err != nil {
+		slog.Error("DNS server: encoding response", "error", err)
+		return nil
+	}
+	return b
+}
+
+// exchange sends a query to an upstream resolver and returns its response
+func exchange(network, upstream string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readTCPMessage reads a message with its two-byte length prefix
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeTCPMessage writes a message with its two-byte length prefix
+func writeTCPMessage(w io.Writer, b []byte) error {
+	_, err := w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(b))), b...))
+	return err
+}
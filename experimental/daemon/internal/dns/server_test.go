@@ -0,0 +1,164 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"wild-cloud-central/internal/config"
+)
+
+// startTestServer serves BuildZone(cfg) on a free loopback port
+func startTestServer(t *testing.T, cfg *config.Config) string {
+	t.Helper()
+	s := NewServer()
+	s.SetZone(BuildZone(cfg), nil)
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	return s.Addr()
+}
+
+// query sends a question over network and returns the raw response
+func query(t *testing.T, network, addr, name string, qtype uint16) []byte {
+	t.Helper()
+	q := &Message{ID: 0x1234, Flags: flagRecursionDesired, Questions: []Question{{Name: name, Type: qtype, Class: ClassINET}}}
+	b, err := q.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, b); err != nil {
+			t.Fatal(err)
+		}
+		response, err := readTCPMessage(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	if _, err := conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+// header is the part of a response header the tests check
+type header struct {
+	id            uint16
+	flags         uint16
+	answers       int
+	authority     int
+	authoritative bool
+	truncated     bool
+}
+
+func parseHeader(t *testing.T, b []byte) header {
+	t.Helper()
+	if len(b) < headerLen {
+		t.Fatalf("response of %d bytes is too short", len(b))
+	}
+	flags := binary.BigEndian.Uint16(b[2:])
+	return header{
+		id:            binary.BigEndian.Uint16(b),
+		flags:         flags,
+		answers:       int(binary.BigEndian.Uint16(b[6:])),
+		authority:     int(binary.BigEndian.Uint16(b[8:])),
+		authoritative: flags&flagAuthoritative != 0,
+		truncated:     flags&flagTruncated != 0,
+	}
+}
+
+func TestServerAnswersOverUDPAndTCP(t *testing.T) {
+	addr := startTestServer(t, testZoneConfig())
+
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			h := parseHeader(t, query(t, network, addr, "www.cloud.example.com.", TypeA))
+			if h.id != 0x1234 {
+				t.Errorf("id = %#x, want the query's", h.id)
+			}
+			if h.flags&flagResponse == 0 || !h.authoritative {
+				t.Errorf("flags = %#x, want an authoritative response", h.flags)
+			}
+			if h.flags&flagRecursionDesired == 0 {
+				t.Error("recursion desired bit was not copied")
+			}
+			if rcode := int(h.flags & 0xf); rcode != RcodeSuccess {
+				t.Errorf("rcode = %d, want %d", rcode, RcodeSuccess)
+			}
+			// Two CNAMEs and the address they lead to
+			if h.answers != 3 {
+				t.Errorf("answers = %d, want 3", h.answers)
+			}
+		})
+	}
+}
+
+func TestServerNegativeAnswers(t *testing.T) {
+	cfg := testZoneConfig()
+	cfg.Cluster.EndpointIP = ""
+	addr := startTestServer(t, cfg)
+
+	h := parseHeader(t, query(t, "udp", addr, "nothing.cloud.example.com.", TypeA))
+	if rcode := int(h.flags & 0xf); rcode != RcodeNameError {
+		t.Errorf("NXDOMAIN rcode = %d, want %d", rcode, RcodeNameError)
+	}
+	if h.answers != 0 || h.authority != 1 {
+		t.Errorf("NXDOMAIN has %d answers and %d authority records, want 0 and 1", h.answers, h.authority)
+	}
+
+	h = parseHeader(t, query(t, "udp", addr, "api.cloud.example.com.", TypeAAAA))
+	if rcode := int(h.flags & 0xf); rcode != RcodeSuccess {
+		t.Errorf("NODATA rcode = %d, want %d", rcode, RcodeSuccess)
+	}
+	if h.answers != 0 || h.authority != 1 {
+		t.Errorf("NODATA has %d answers and %d authority records, want 0 and 1", h.answers, h.authority)
+	}
+}
+
+func TestServerRefusesOutsideZoneWithoutUpstreams(t *testing.T) {
+	addr := startTestServer(t, testZoneConfig())
+	h := parseHeader(t, query(t, "udp", addr, "example.org.", TypeA))
+	if rcode := int(h.flags & 0xf); rcode != RcodeRefused {
+		t.Errorf("rcode = %d, want %d", rcode, RcodeRefused)
+	}
+}
+
+func TestServerTruncatesLargeUDPResponses(t *testing.T) {
+	cfg := testZoneConfig()
+	for i := 0; i < 4; i++ {
+		cfg.Cloud.DNS.Records = append(cfg.Cloud.DNS.Records, config.DNSRecord{
+			Name:  "big.cloud.example.com",
+			Type:  "TXT",
+			Value: strings.Repeat(string(rune('a'+i)), 200),
+		})
+	}
+	addr := startTestServer(t, cfg)
+
+	h := parseHeader(t, query(t, "udp", addr, "big.cloud.example.com.", TypeTXT))
+	if !h.truncated || h.answers != 0 {
+		t.Errorf("UDP: truncated = %v with %d answers, want a truncated empty response", h.truncated, h.answers)
+	}
+
+	h = parseHeader(t, query(t, "tcp", addr, "big.cloud.example.com.", TypeTXT))
+	if h.truncated || h.answers != 4 {
+		t.Errorf("TCP: truncated = %v with %d answers, want all 4 answers", h.truncated, h.answers)
+	}
+}
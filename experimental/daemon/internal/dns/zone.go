@@ -0,0 +1,273 @@
+package dns
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"wild-cloud-central/internal/config"
+)
+
+// maxCNAMEChain bounds how many CNAMEs are followed inside the zone
+const maxCNAMEChain = 8
+
+// Zone holds the records the server is authoritative for. A zone is never
+// modified once built; the server swaps in a new one when the config changes.
+type Zone struct {
+	// origins are the domains served, longest first
+	origins []string
+	records map[string][]Resource
+	serial  uint32
+	ttl     uint32
+}
+
+// NewZone creates an empty zone authoritative for origins
+func NewZone(ttl uint32, origins ...string) *Zone {
+	z := &Zone{records: make(map[string][]Resource), serial: uint32(time.Now().Unix()), ttl: ttl}
+	for _, origin := range origins {
+		if origin = Fqdn(origin); origin != "." && !contains(z.origins, origin) {
+			z.origins = append(z.origins, origin)
+		}
+	}
+	sort.Slice(z.origins, func(i, j int) bool { return len(z.origins[i]) > len(z.origins[j]) })
+	return z
+}
+
+// BuildZone creates the zone for a config. Both cloud domains and every name
+// under them resolve to the cluster endpoint, as with dnsmasq's address=
+// lines, named nodes get their own records in the internal domain, and the
+// custom records from cloud.dns.records are added as they are.
+func BuildZone(cfg *config.Config) *Zone {
+	ttl := cfg.DNSTTL()
+	z := NewZone(ttl, cfg.Cloud.Domain, cfg.Cloud.InternalDomain)
+
+	if endpoint := net.ParseIP(cfg.Cluster.EndpointIP); endpoint != nil {
+		for _, origin := range z.origins {
+			z.Add(AddressRecord(origin, endpoint, ttl))
+			z.Add(AddressRecord("*."+origin, endpoint, ttl))
+		}
+	}
+	for _, record := range cfg.Cloud.DNS.Records {
+		if rr, ok := configRecord(record, ttl); ok {
+			z.Add(rr)
+		}
+	}
+
+	if cfg.Cloud.InternalDomain == "" {
+		return z
+	}
+	for _, r := range cfg.Cluster.Nodes.Reservations {
+		z.addHost(cfg.Cloud.InternalDomain, r.Hostname, r.IP)
+	}
+	for _, node := range cfg.ActiveNodes() {
+		z.addHost(cfg.Cloud.InternalDomain, node.Hostname, node.IP)
+	}
+	return z
+}
+
+// configRecord converts a custom record from the config. Invalid records,
+// which validation keeps out of saved configs, are skipped.
+func configRecord(record config.DNSRecord, ttl uint32) (Resource, bool) {
+	record = config.NormalizeDNSRecord(record)
+	switch record.Type {
+	case "A", "AAAA":
+		if ip := net.ParseIP(record.Value); ip != nil {
+			return AddressRecord(record.Name, ip, ttl), true
+		}
+	case "CNAME":
+		return CNAMERecord(record.Name, record.Value, ttl), true
+	case "TXT":
+		return TXTRecord(record.Name, record.Value, ttl), true
+	case "SRV":
+		return SRVRecord(record.Name, uint16(record.Priority), uint16(record.Weight), uint16(record.Port), record.Value, ttl), true
+	}
+	return Resource{}, false
+}
+
+// addHost adds an address record for a host in domain
+func (z *Zone) addHost(domain, hostname, ip string) {
+	addr := net.ParseIP(ip)
+	if hostname == "" || addr == nil {
+		return
+	}
+	name := Fqdn(hostname)
+	if !strings.Contains(strings.TrimSuffix(name, "."), ".") {
+		name = Fqdn(hostname + "." + domain)
+	}
+	z.Add(AddressRecord(name, addr, z.ttl))
+}
+
+// Add adds a record to the zone, ignoring records outside its domains and
+// exact duplicates
+func (z *Zone) Add(rr Resource) {
+	rr.Name = Fqdn(rr.Name)
+	if rr.Class == 0 {
+		rr.Class = ClassINET
+	}
+	if z.origin(rr.Name) == "" {
+		return
+	}
+	for _, existing := range z.records[rr.Name] {
+		if existing.Type == rr.Type && string(existing.Data) == string(rr.Data) {
+			return
+		}
+	}
+	z.records[rr.Name] = append(z.records[rr.Name], rr)
+}
+
+// Origins returns the domains the zone is authoritative for
+func (z *Zone) Origins() []string {
+	return append([]string(nil), z.origins...)
+}
+
+// Records returns every record in the zone sorted by name and type
+func (z *Zone) Records() []Resource {
+	var all []Resource
+	for _, rrs := range z.records {
+		all = append(all, rrs...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Type < all[j].Type
+	})
+	return all
+}
+
+// serves reports whether name is one of the zone's origins or below one
+func (z *Zone) serves(name string) bool {
+	return z.origin(name) != ""
+}
+
+// origin returns the closest origin containing name, or "" if there is none
+func (z *Zone) origin(name string) string {
+	for _, origin := range z.origins {
+		if name == origin || strings.HasSuffix(name, "."+origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// Lookup answers a question from the zone. It returns false if the name is
+// outside the zone and the query should be forwarded.
+func (z *Zone) Lookup(q Question) (*Message, bool) {
+	origin := z.origin(q.Name)
+	if origin == "" {
+		return nil, false
+	}
+
+	m := &Message{}
+	name := q.Name
+	for hops := 0; hops <= maxCNAMEChain; hops++ {
+		rrs, found := z.match(name, q.Type)
+		if !found {
+			// The rcode describes the last name in the chain
+			m.Flags = RcodeNameError
+			break
+		}
+
+		var answered bool
+		if name == origin && (q.Type == TypeSOA || q.Type == TypeANY) {
+			m.Answers = append(m.Answers, soaRecord(origin, z.serial, z.ttl))
+			answered = true
+		}
+		for _, rr := range rrs {
+			if rr.Type == q.Type || q.Type == TypeANY {
+				m.Answers = append(m.Answers, rr)
+				answered = true
+			}
+		}
+		if answered || q.Type == TypeCNAME {
+			return m, true
+		}
+
+		// Follow a CNAME as long as it stays inside the zone
+		cname := findType(rrs, TypeCNAME)
+		if cname == nil {
+			break
+		}
+		m.Answers = append(m.Answers, *cname)
+		target, _, err := readName(cname.Data, 0)
+		if err != nil || !z.serves(target) {
+			return m, true
+		}
+		name = target
+	}
+
+	// A negative answer, possibly after some CNAMEs, carries the SOA so it
+	// can be cached
+	m.Authority = []Resource{soaRecord(origin, z.serial, z.ttl)}
+	return m, true
+}
+
+// match returns the records for name, adding those synthesized from the
+// closest wildcard when name has no address or CNAME records of its own. As
+// with dnsmasq, a custom TXT or SRV record does not hide the domain
+// mapping's address.
+func (z *Zone) match(name string, qtype uint16) ([]Resource, bool) {
+	rrs, exists := z.records[name]
+	if exists && (qtype == TypeANY || findType(rrs, qtype) != nil || hasAddress(rrs)) {
+		return rrs, true
+	}
+	if z.origin(name) == name {
+		// The apex exists even without records, and no wildcard covers it
+		return rrs, true
+	}
+
+	wildcard := z.wildcard(name)
+	if wildcard == nil {
+		return rrs, exists
+	}
+	return append(append([]Resource(nil), rrs...), wildcard...), true
+}
+
+// wildcard returns the records of the closest wildcard above name, renamed
+// to name, or nil if no wildcard covers it
+func (z *Zone) wildcard(name string) []Resource {
+	for parent := name; ; {
+		i := strings.IndexByte(parent, '.')
+		if i < 0 || i == len(parent)-1 {
+			return nil
+		}
+		parent = parent[i+1:]
+		if wildcard, ok := z.records["*."+parent]; ok {
+			synthesized := make([]Resource, len(wildcard))
+			for i, rr := range wildcard {
+				rr.Name = name
+				synthesized[i] = rr
+			}
+			return synthesized
+		}
+		if z.origin(parent) == parent {
+			return nil
+		}
+	}
+}
+
+// hasAddress reports whether rrs hold an A, AAAA or CNAME record
+func hasAddress(rrs []Resource) bool {
+	return findType(rrs, TypeA) != nil || findType(rrs, TypeAAAA) != nil || findType(rrs, TypeCNAME) != nil
+}
+
+// findType returns the first record of type t
+func findType(rrs []Resource, t uint16) *Resource {
+	for i := range rrs {
+		if rrs[i].Type == t {
+			return &rrs[i]
+		}
+	}
+	return nil
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
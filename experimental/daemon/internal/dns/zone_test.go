@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+
+	"wild-cloud-central/internal/config"
+)
+
+// testZoneConfig returns a config with a wildcard domain mapping, custom
+// records and a reserved node
+func testZoneConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Cloud.Domain = "cloud.example.com"
+	cfg.Cloud.InternalDomain = "internal.cloud.example.com"
+	cfg.Cluster.EndpointIP = "192.168.8.60"
+	cfg.Cloud.DNS.Records = []config.DNSRecord{
+		{Name: "api.cloud.example.com", Type: "A", Value: "192.168.8.70"},
+		{Name: "v6.cloud.example.com", Type: "AAAA", Value: "fd00::1"},
+		{Name: "www.cloud.example.com", Type: "CNAME", Value: "web.cloud.example.com"},
+		{Name: "web.cloud.example.com", Type: "CNAME", Value: "api.cloud.example.com"},
+		{Name: "ext.cloud.example.com", Type: "CNAME", Value: "example.org"},
+		{Name: "loop1.cloud.example.com", Type: "CNAME", Value: "loop2.cloud.example.com"},
+		{Name: "loop2.cloud.example.com", Type: "CNAME", Value: "loop1.cloud.example.com"},
+		{Name: "txt.cloud.example.com", Type: "TXT", Value: "hello"},
+		{Name: "_http._tcp.cloud.example.com", Type: "SRV", Value: "api.cloud.example.com", Priority: 10, Weight: 5, Port: 80},
+	}
+	cfg.Cluster.Nodes.Reservations = []config.Reservation{
+		{MAC: "52:54:00:aa:bb:01", IP: "192.168.8.21", Hostname: "cp-1"},
+	}
+	return cfg
+}
+
+// answers renders the records of a section as "name TYPE value"
+func answers(rrs []Resource) []string {
+	var out []string
+	for _, rr := range rrs {
+		out = append(out, rr.Name+" "+TypeName(rr.Type)+" "+rr.Value())
+	}
+	return out
+}
+
+func TestZoneLookup(t *testing.T) {
+	zone := BuildZone(testZoneConfig())
+
+	tests := []struct {
+		name    string
+		qname   string
+		qtype   uint16
+		want    []string
+		rcode   int
+		noData  bool
+		outside bool
+	}{
+		{
+			name:  "apex",
+			qname: "cloud.example.com.", qtype: TypeA,
+			want: []string{"cloud.example.com. A 192.168.8.60"},
+		},
+		{
+			name:  "wildcard",
+			qname: "anything.cloud.example.com.", qtype: TypeA,
+			want: []string{"anything.cloud.example.com. A 192.168.8.60"},
+		},
+		{
+			name:  "wildcard several labels deep",
+			qname: "a.b.cloud.example.com.", qtype: TypeA,
+			want: []string{"a.b.cloud.example.com. A 192.168.8.60"},
+		},
+		{
+			name:  "closest wildcard wins",
+			qname: "x.internal.cloud.example.com.", qtype: TypeA,
+			want: []string{"x.internal.cloud.example.com. A 192.168.8.60"},
+		},
+		{
+			name:  "custom record overrides wildcard",
+			qname: "api.cloud.example.com.", qtype: TypeA,
+			want: []string{"api.cloud.example.com. A 192.168.8.70"},
+		},
+		{
+			name:  "reserved node",
+			qname: "cp-1.internal.cloud.example.com.", qtype: TypeA,
+			want: []string{"cp-1.internal.cloud.example.com. A 192.168.8.21"},
+		},
+		{
+			name:  "AAAA-only name hides the wildcard A",
+			qname: "v6.cloud.example.com.", qtype: TypeA,
+			noData: true,
+		},
+		{
+			name:  "AAAA record",
+			qname: "v6.cloud.example.com.", qtype: TypeAAAA,
+			want: []string{"v6.cloud.example.com. AAAA fd00::1"},
+		},
+		{
+			name:  "TXT record keeps the wildcard address",
+			qname: "txt.cloud.example.com.", qtype: TypeA,
+			want: []string{"txt.cloud.example.com. A 192.168.8.60"},
+		},
+		{
+			name:  "TXT record",
+			qname: "txt.cloud.example.com.", qtype: TypeTXT,
+			want: []string{`txt.cloud.example.com. TXT "hello"`},
+		},
+		{
+			name:  "SRV record",
+			qname: "_http._tcp.cloud.example.com.", qtype: TypeSRV,
+			want: []string{"_http._tcp.cloud.example.com. SRV 10 5 80 api.cloud.example.com."},
+		},
+		{
+			name:  "CNAME chain is followed inside the zone",
+			qname: "www.cloud.example.com.", qtype: TypeA,
+			want: []string{
+				"www.cloud.example.com. CNAME web.cloud.example.com.",
+				"web.cloud.example.com. CNAME api.cloud.example.com.",
+				"api.cloud.example.com. A 192.168.8.70",
+			},
+		},
+		{
+			name:  "CNAME query is not followed",
+			qname: "www.cloud.example.com.", qtype: TypeCNAME,
+			want: []string{"www.cloud.example.com. CNAME web.cloud.example.com."},
+		},
+		{
+			name:  "CNAME leaving the zone stops the chain",
+			qname: "ext.cloud.example.com.", qtype: TypeA,
+			want: []string{"ext.cloud.example.com. CNAME example.org."},
+		},
+		{
+			name:  "name with only a wildcard address has no TXT",
+			qname: "anything.cloud.example.com.", qtype: TypeTXT,
+			noData: true,
+		},
+		{
+			name:  "outside the zone",
+			qname: "example.org.", qtype: TypeA,
+			outside: true,
+		},
+		{
+			name:  "suffix that is not a subdomain",
+			qname: "notcloud.example.com.", qtype: TypeA,
+			outside: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := zone.Lookup(Question{Name: tt.qname, Type: tt.qtype, Class: ClassINET})
+			if ok == tt.outside {
+				t.Fatalf("Lookup in zone = %v, want %v", ok, !tt.outside)
+			}
+			if tt.outside {
+				return
+			}
+			if m.Rcode() != tt.rcode {
+				t.Errorf("rcode = %d, want %d", m.Rcode(), tt.rcode)
+			}
+			if got := answers(m.Answers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answers = %q, want %q", got, tt.want)
+			}
+			if tt.noData && (len(m.Authority) != 1 || m.Authority[0].Type != TypeSOA) {
+				t.Errorf("authority = %q, want the SOA record", answers(m.Authority))
+			}
+		})
+	}
+}
+
+func TestZoneLookupCNAMELoop(t *testing.T) {
+	zone := BuildZone(testZoneConfig())
+	m, ok := zone.Lookup(Question{Name: "loop1.cloud.example.com.", Type: TypeA, Class: ClassINET})
+	if !ok {
+		t.Fatal("name is outside the zone")
+	}
+	if len(m.Answers) == 0 || len(m.Answers) > maxCNAMEChain+1 {
+		t.Errorf("got %d answers, want between 1 and %d", len(m.Answers), maxCNAMEChain+1)
+	}
+	for _, rr := range m.Answers {
+		if rr.Type != TypeCNAME {
+			t.Errorf("unexpected %s record in a CNAME loop", TypeName(rr.Type))
+		}
+	}
+}
+
+func TestZoneLookupWithoutWildcard(t *testing.T) {
+	cfg := testZoneConfig()
+	cfg.Cluster.EndpointIP = ""
+	cfg.Cloud.DNS.Records = append(cfg.Cloud.DNS.Records,
+		config.DNSRecord{Name: "dangling.cloud.example.com", Type: "CNAME", Value: "missing.cloud.example.com"},
+		config.DNSRecord{Name: "alias.cloud.example.com", Type: "CNAME", Value: "txt.cloud.example.com"},
+	)
+	zone := BuildZone(cfg)
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype uint16
+		rcode int
+		want  []string
+	}{
+		{name: "unknown name is NXDOMAIN", qname: "nothing.cloud.example.com.", qtype: TypeA, rcode: RcodeNameError},
+		{name: "unknown name of any type is NXDOMAIN", qname: "nothing.cloud.example.com.", qtype: TypeTXT, rcode: RcodeNameError},
+		{name: "apex without records is NODATA", qname: "cloud.example.com.", qtype: TypeA},
+		{name: "existing name without the type is NODATA", qname: "api.cloud.example.com.", qtype: TypeAAAA},
+		{name: "TXT-only name has no address", qname: "txt.cloud.example.com.", qtype: TypeA},
+		{
+			name:  "CNAME to a missing name is NXDOMAIN with the CNAME",
+			qname: "dangling.cloud.example.com.", qtype: TypeA,
+			rcode: RcodeNameError,
+			want:  []string{"dangling.cloud.example.com. CNAME missing.cloud.example.com."},
+		},
+		{
+			name:  "CNAME to a name without the type is NODATA with the CNAME",
+			qname: "alias.cloud.example.com.", qtype: TypeA,
+			want: []string{"alias.cloud.example.com. CNAME txt.cloud.example.com."},
+		},
+		{
+			name:  "apex SOA",
+			qname: "cloud.example.com.", qtype: TypeSOA,
+			want: []string{"cloud.example.com. SOA " + soaRecord("cloud.example.com.", zone.serial, zone.ttl).Value()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := zone.Lookup(Question{Name: tt.qname, Type: tt.qtype, Class: ClassINET})
+			if !ok {
+				t.Fatal("name is outside the zone")
+			}
+			if m.Rcode() != tt.rcode {
+				t.Errorf("rcode = %d, want %d", m.Rcode(), tt.rcode)
+			}
+			if got := answers(m.Answers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answers = %q, want %q", got, tt.want)
+			}
+			if tt.qtype != TypeSOA && (len(m.Authority) != 1 || m.Authority[0].Type != TypeSOA) {
+				t.Errorf("authority = %q, want the SOA record", answers(m.Authority))
+			}
+		})
+	}
+}
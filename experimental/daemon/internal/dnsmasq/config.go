@@ -1,97 +1,306 @@
 package dnsmasq
 
 import (
+	"context"
+	_ "embed"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"wild-cloud-central/internal/command"
 	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/service"
 )
 
+// defaultTemplate is used unless the operator provides a template file
+//
+//go:embed dnsmasq.conf.tmpl
+var defaultTemplate string
+
+// BackupSuffix is appended to the config path for the copy of the last
+// config dnsmasq was known to run with
+const BackupSuffix = ".bak"
+
+// commandTimeout bounds each dnsmasq and service manager invocation
+const commandTimeout = 30 * time.Second
+
+// restartSettle is how long dnsmasq gets to fail on a bad config before its
+// status is checked
+var restartSettle = time.Second
+
+// TestError is returned when dnsmasq rejects a generated config
+type TestError struct {
+	Output string
+}
+
+// Error implements the error interface
+func (e *TestError) Error() string {
+	return "dnsmasq rejected the generated config: " + e.Output
+}
+
+// RestartError is returned when dnsmasq does not come back after a restart
+type RestartError struct {
+	Err error
+
+	// RolledBack is true when the previous config was restored and dnsmasq
+	// restarted with it
+	RolledBack  bool
+	RollbackErr error
+}
+
+// Error implements the error interface
+func (e *RestartError) Error() string {
+	if e.RolledBack {
+		return e.Err.Error() + "; the previous config was restored"
+	}
+	return e.Err.Error() + "; restoring the previous config failed: " + e.RollbackErr.Error()
+}
+
+// Unwrap returns the restart failure
+func (e *RestartError) Unwrap() error {
+	return e.Err
+}
+
 // ConfigGenerator handles dnsmasq configuration generation
-type ConfigGenerator struct{}
+type ConfigGenerator struct {
+	// TemplateFile replaces the built-in template when the file exists
+	TemplateFile string
+
+	// SnippetsDir holds *.conf snippets appended to the generated config
+	SnippetsDir string
+
+	// Runner runs dnsmasq --test
+	Runner command.Runner
+
+	// Services restarts dnsmasq
+	Services service.Manager
+
+	// mu serializes writes and restarts of the live config
+	mu sync.Mutex
+}
+
+// TemplateData is what the dnsmasq template is executed with. The config's
+// fields are available directly, e.g. {{.Cloud.Domain}}.
+type TemplateData struct {
+	*config.Config
+	Snippets []Snippet
+}
 
 // NewConfigGenerator creates a new dnsmasq config generator
 func NewConfigGenerator() *ConfigGenerator {
-	return &ConfigGenerator{}
+	return &ConfigGenerator{Runner: command.ExecRunner{}}
 }
 
 // Generate creates a dnsmasq configuration from the app config
-func (g *ConfigGenerator) Generate(cfg *config.Config) string {
-	template := `# Configuration file for dnsmasq.
-
-# Basic Settings
-interface=%s
-listen-address=%s
-domain-needed
-bogus-priv
-no-resolv
-
-# DNS Local Resolution - Central server handles these domains authoritatively
-local=/%s/
-address=/%s/%s
-local=/%s/
-address=/%s/%s
-server=1.1.1.1
-server=8.8.8.8
-
-# --- DHCP Settings ---
-dhcp-range=%s,12h
-dhcp-option=3,%s
-dhcp-option=6,%s
-
-# --- PXE Booting ---
-enable-tftp
-tftp-root=/var/ftpd
-
-dhcp-match=set:efi-x86_64,option:client-arch,7
-dhcp-boot=tag:efi-x86_64,ipxe.efi
-dhcp-boot=tag:!efi-x86_64,undionly.kpxe
-
-dhcp-match=set:efi-arm64,option:client-arch,11
-dhcp-boot=tag:efi-arm64,ipxe-arm64.efi
-
-dhcp-userclass=set:ipxe,iPXE
-dhcp-boot=tag:ipxe,http://%s/boot.ipxe
-
-log-queries
-log-dhcp
-`
-
-	return fmt.Sprintf(template,
-		cfg.Cloud.Dnsmasq.Interface,
-		cfg.Cloud.DNS.IP,
-		cfg.Cloud.Domain,
-		cfg.Cloud.Domain,
-		cfg.Cluster.EndpointIP,
-		cfg.Cloud.InternalDomain,
-		cfg.Cloud.InternalDomain,
-		cfg.Cluster.EndpointIP,
-		cfg.Cloud.DHCPRange,
-		cfg.Cloud.Router.IP,
-		cfg.Cloud.DNS.IP,
-		cfg.Cloud.DNS.IP,
-	)
-}
-
-// WriteConfig writes the dnsmasq configuration to the specified path
+func (g *ConfigGenerator) Generate(cfg *config.Config) (string, error) {
+	tmpl, err := g.template()
+	if err != nil {
+		return "", err
+	}
+	snippets, err := LoadSnippets(g.SnippetsDir)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, TemplateData{Config: cfg, Snippets: snippets}); err != nil {
+		return "", fmt.Errorf("rendering dnsmasq template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// TemplateSource returns the template file in use, or "embedded" for the
+// built-in template
+func (g *ConfigGenerator) TemplateSource() string {
+	if g.TemplateFile != "" {
+		if _, err := os.Stat(g.TemplateFile); err == nil {
+			return g.TemplateFile
+		}
+	}
+	return "embedded"
+}
+
+// template parses the override template if there is one, otherwise the
+// built-in template
+func (g *ConfigGenerator) template() (*template.Template, error) {
+	text, name := defaultTemplate, "dnsmasq.conf.tmpl"
+	if g.TemplateFile != "" {
+		content, err := os.ReadFile(g.TemplateFile)
+		if err == nil {
+			text, name = string(content), filepath.Base(g.TemplateFile)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading dnsmasq template: %w", err)
+		}
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dnsmasq template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// WriteConfig writes the dnsmasq configuration to the specified path. The
+// new config is written to a temporary file, checked with dnsmasq --test and
+// only then renamed over the old one. The first write keeps the config it
+// replaces as the backup RestartService falls back to, since that is what
+// dnsmasq was started with; after that only a healthy restart updates it.
 func (g *ConfigGenerator) WriteConfig(cfg *config.Config, configPath string) error {
-	configContent := g.Generate(cfg)
+	configContent, err := g.Generate(cfg)
+	if err != nil {
+		return err
+	}
 
-	log.Printf("Writing dnsmasq config to: %s", configPath)
-	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(configPath), ".dnsmasq-*.conf")
+	if err != nil {
+		return fmt.Errorf("writing dnsmasq config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(configContent); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing dnsmasq config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
 		return fmt.Errorf("writing dnsmasq config: %w", err)
 	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("writing dnsmasq config: %w", err)
+	}
+
+	if err := g.test(tmp.Name()); err != nil {
+		return err
+	}
+
+	if err := seedBackup(configPath); err != nil {
+		return err
+	}
+	slog.Debug("Writing dnsmasq config", "path", configPath)
+	if err := os.Rename(tmp.Name(), configPath); err != nil {
+		return fmt.Errorf("writing dnsmasq config: %w", err)
+	}
+	return nil
+}
+
+// RestartService restarts the dnsmasq service and checks that it came back.
+// If it did, the config becomes the backup. If it did not, the backup of the
+// last config dnsmasq ran with is restored and the service restarted again;
+// the returned *RestartError says whether that worked.
+func (g *ConfigGenerator) RestartService(configPath string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
+	err := g.restart()
+	if err == nil {
+		if err := backup(configPath); err != nil {
+			slog.Warn("Failed to keep a copy of the running dnsmasq config", "error", err)
+		}
+		return nil
+	}
+
+	restartErr := &RestartError{Err: err}
+	backupPath := configPath + BackupSuffix
+	if _, statErr := os.Stat(backupPath); statErr != nil {
+		restartErr.RollbackErr = fmt.Errorf("no previous config to restore")
+		return restartErr
+	}
+
+	slog.Warn("dnsmasq failed to restart, restoring previous config", "backup", backupPath)
+	if err := copyFile(backupPath, configPath); err != nil {
+		restartErr.RollbackErr = err
+		return restartErr
+	}
+	if err := g.restart(); err != nil {
+		restartErr.RollbackErr = fmt.Errorf("restarting with the previous config: %w", err)
+		return restartErr
+	}
+	restartErr.RolledBack = true
+	return restartErr
+}
+
+// test checks a config file with dnsmasq --test. Machines without dnsmasq,
+// such as development setups, skip the check.
+func (g *ConfigGenerator) test(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	output, err := g.Runner.Run(ctx, "dnsmasq", "--test", "-C", path)
+	if errors.Is(err, exec.ErrNotFound) {
+		slog.Warn("dnsmasq is not installed, skipping config test")
+		return nil
+	}
+	if err != nil {
+		return &TestError{Output: strings.TrimSpace(string(output))}
+	}
 	return nil
 }
 
-// RestartService restarts the dnsmasq service
-func (g *ConfigGenerator) RestartService() error {
-	cmd := exec.Command("sudo", "/usr/bin/systemctl", "restart", "dnsmasq.service")
-	if err := cmd.Run(); err != nil {
+// restart restarts the dnsmasq service and checks that it is still up
+// shortly afterwards
+func (g *ConfigGenerator) restart() error {
+	if g.Services == nil {
+		return fmt.Errorf("failed to restart dnsmasq: no service manager configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	if err := g.Services.Restart(ctx, service.Dnsmasq); err != nil {
 		return fmt.Errorf("failed to restart dnsmasq: %w", err)
 	}
+	time.Sleep(restartSettle)
+	status, err := g.Services.Status(ctx, service.Dnsmasq)
+	if err != nil {
+		return fmt.Errorf("checking dnsmasq after restart: %w", err)
+	}
+	if !service.Healthy(status) {
+		return fmt.Errorf("dnsmasq is %s after restart: %s", status.State, status.Detail)
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// seedBackup backs up the current config unless there already is a backup
+func seedBackup(configPath string) error {
+	if _, err := os.Stat(configPath + BackupSuffix); err == nil {
+		return nil
+	}
+	return backup(configPath)
+}
+
+// backup copies the current config, if any, next to it
+func backup(configPath string) error {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil
+	}
+	if err := copyFile(configPath, configPath+BackupSuffix); err != nil {
+		return fmt.Errorf("backing up dnsmasq config: %w", err)
+	}
+	return nil
+}
+
+// copyFile replaces dst with the contents of src via a rename, so readers
+// never see a partial file
+func copyFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
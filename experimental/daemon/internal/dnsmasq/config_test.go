@@ -0,0 +1,425 @@
+package dnsmasq
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/service"
+)
+
+// fakeDnsmasq stands in for dnsmasq and systemctl. dnsmasq runs whatever
+// config is on disk when it is restarted and dies if that config mentions
+// "crash".
+type fakeDnsmasq struct {
+	configPath string
+
+	// rejectTest makes dnsmasq --test fail
+	rejectTest bool
+
+	// failRestart makes systemctl restart fail
+	failRestart bool
+
+	tests    int
+	restarts int
+	running  bool
+}
+
+func (f *fakeDnsmasq) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if name == "sudo" {
+		name, args = args[0], args[1:]
+	}
+	switch {
+	case name == "dnsmasq":
+		f.tests++
+		if f.rejectTest {
+			return []byte("dnsmasq: bad option at line 4"), errors.New("exit status 1")
+		}
+		return nil, nil
+	case len(args) > 0 && args[0] == "restart":
+		f.restarts++
+		if f.failRestart {
+			f.running = false
+			return nil, errors.New("exit status 1")
+		}
+		content, err := os.ReadFile(f.configPath)
+		f.running = err == nil && !strings.Contains(string(content), "crash")
+		return nil, nil
+	case len(args) > 0 && args[0] == "is-active":
+		if f.running {
+			return []byte("active\n"), nil
+		}
+		return []byte("failed\n"), errors.New("exit status 3")
+	}
+	return nil, errors.New("unexpected command " + name)
+}
+
+// newTestGenerator returns a generator that runs commands through a
+// fakeDnsmasq, and the config path they share
+func newTestGenerator(t *testing.T) (*ConfigGenerator, *fakeDnsmasq, string) {
+	t.Helper()
+	settle := restartSettle
+	restartSettle = 0
+	t.Cleanup(func() { restartSettle = settle })
+
+	configPath := filepath.Join(t.TempDir(), "dnsmasq.conf")
+	fake := &fakeDnsmasq{configPath: configPath}
+	g := &ConfigGenerator{
+		Runner:   fake,
+		Services: service.NewSystemd([]service.Definition{{Name: service.Dnsmasq}}, fake),
+	}
+	return g, fake, configPath
+}
+
+// testConfig returns a config whose generated dnsmasq config contains domain
+func testConfig(domain string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Cloud.Domain = domain
+	cfg.Cloud.InternalDomain = "internal." + domain
+	cfg.Cloud.DNS.IP = "192.168.8.50"
+	cfg.Cloud.Router.IP = "192.168.8.1"
+	cfg.Cloud.DHCPRange = "192.168.8.100,192.168.8.200"
+	cfg.Cluster.EndpointIP = "192.168.8.60"
+	return cfg
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestWriteConfigRejectedByTest(t *testing.T) {
+	g, fake, configPath := newTestGenerator(t)
+	if err := g.WriteConfig(testConfig("good.example.com"), configPath); err != nil {
+		t.Fatalf("WriteConfig: %v", err)
+	}
+	before := readFile(t, configPath)
+
+	fake.rejectTest = true
+	err := g.WriteConfig(testConfig("other.example.com"), configPath)
+	var testErr *TestError
+	if !errors.As(err, &testErr) {
+		t.Fatalf("WriteConfig error = %v, want *TestError", err)
+	}
+	if !strings.Contains(testErr.Output, "bad option") {
+		t.Errorf("TestError output = %q, want dnsmasq's message", testErr.Output)
+	}
+	if got := readFile(t, configPath); got != before {
+		t.Errorf("rejected config replaced the old one:\n%s", got)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(configPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "dnsmasq.conf" {
+			t.Errorf("unexpected file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestWriteConfigKeepsBackupOfRunningConfig(t *testing.T) {
+	g, _, configPath := newTestGenerator(t)
+	backupPath := configPath + BackupSuffix
+	if err := os.WriteFile(configPath, []byte("# started with\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes that are never restarted must not replace the backup of the
+	// config dnsmasq is running
+	for _, domain := range []string{"one.example.com", "two.example.com"} {
+		if err := g.WriteConfig(testConfig(domain), configPath); err != nil {
+			t.Fatalf("WriteConfig %s: %v", domain, err)
+		}
+		if got := readFile(t, backupPath); got != "# started with\n" {
+			t.Fatalf("backup after writing %s = %q, want the original config", domain, got)
+		}
+	}
+
+	if err := g.RestartService(configPath); err != nil {
+		t.Fatalf("RestartService: %v", err)
+	}
+	if got, want := readFile(t, backupPath), readFile(t, configPath); got != want {
+		t.Errorf("backup after a healthy restart = %q, want the running config", got)
+	}
+}
+
+func TestRestartServiceRollsBack(t *testing.T) {
+	g, fake, configPath := newTestGenerator(t)
+	if err := g.WriteConfig(testConfig("good.example.com"), configPath); err != nil {
+		t.Fatalf("WriteConfig: %v", err)
+	}
+	if err := g.RestartService(configPath); err != nil {
+		t.Fatalf("RestartService: %v", err)
+	}
+	good := readFile(t, configPath)
+
+	// An intermediate write must not become the rollback target
+	if err := g.WriteConfig(testConfig("other.crash.example.com"), configPath); err != nil {
+		t.Fatalf("WriteConfig: %v", err)
+	}
+	if err := g.WriteConfig(testConfig("crash.example.com"), configPath); err != nil {
+		t.Fatalf("WriteConfig: %v", err)
+	}
+
+	restarts := fake.restarts
+	err := g.RestartService(configPath)
+	var restartErr *RestartError
+	if !errors.As(err, &restartErr) {
+		t.Fatalf("RestartService error = %v, want *RestartError", err)
+	}
+	if !restartErr.RolledBack {
+		t.Fatalf("RolledBack = false, RollbackErr = %v", restartErr.RollbackErr)
+	}
+	if got := fake.restarts - restarts; got != 2 {
+		t.Errorf("restarted %d times, want 2", got)
+	}
+	if got := readFile(t, configPath); got != good {
+		t.Errorf("config after rollback = %q, want the last running config", got)
+	}
+	if !fake.running {
+		t.Error("dnsmasq is not running after the rollback")
+	}
+}
+
+func TestRestartServiceRollbackFails(t *testing.T) {
+	t.Run("no backup", func(t *testing.T) {
+		g, fake, configPath := newTestGenerator(t)
+		if err := g.WriteConfig(testConfig("crash.example.com"), configPath); err != nil {
+			t.Fatalf("WriteConfig: %v", err)
+		}
+
+		err := g.RestartService(configPath)
+		var restartErr *RestartError
+		if !errors.As(err, &restartErr) {
+			t.Fatalf("RestartService error = %v, want *RestartError", err)
+		}
+		if restartErr.RolledBack || restartErr.RollbackErr == nil {
+			t.Errorf("RolledBack = %v, RollbackErr = %v; want a rollback error", restartErr.RolledBack, restartErr.RollbackErr)
+		}
+		if fake.restarts != 1 {
+			t.Errorf("restarted %d times, want 1", fake.restarts)
+		}
+	})
+
+	t.Run("restart fails", func(t *testing.T) {
+		g, fake, configPath := newTestGenerator(t)
+		if err := g.WriteConfig(testConfig("good.example.com"), configPath); err != nil {
+			t.Fatalf("WriteConfig: %v", err)
+		}
+		if err := g.RestartService(configPath); err != nil {
+			t.Fatalf("RestartService: %v", err)
+		}
+		good := readFile(t, configPath)
+		if err := g.WriteConfig(testConfig("other.example.com"), configPath); err != nil {
+			t.Fatalf("WriteConfig: %v", err)
+		}
+
+		fake.failRestart = true
+		err := g.RestartService(configPath)
+		var restartErr *RestartError
+		if !errors.As(err, &restartErr) {
+			t.Fatalf("RestartService error = %v, want *RestartError", err)
+		}
+		if restartErr.RolledBack || restartErr.RollbackErr == nil {
+			t.Errorf("RolledBack = %v, RollbackErr = %v; want a rollback error", restartErr.RolledBack, restartErr.RollbackErr)
+		}
+		if got := readFile(t, configPath); got != good {
+			t.Errorf("config after failed rollback = %q, want the last running config restored", got)
+		}
+		if got := readFile(t, configPath+BackupSuffix); got != good {
+			t.Errorf("backup = %q, want the last running config", got)
+		}
+	})
+}
+
+func TestGenerateLeavesDHCPOffWithoutRange(t *testing.T) {
+	g := NewConfigGenerator()
+
+	server := testConfig("example.com")
+	server.Cloud.DHCPRange = ""
+	proxy := testConfig("example.com")
+	proxy.Cloud.DHCPMode = config.DHCPModeProxy
+	proxy.Cloud.Router.IP = ""
+	proxy.Cloud.DNS.IP = ""
+
+	for name, cfg := range map[string]*config.Config{"server": server, "proxy": proxy} {
+		out, err := g.Generate(cfg)
+		if err != nil {
+			t.Fatalf("%s: Generate: %v", name, err)
+		}
+		if strings.Contains(out, "dhcp-range=") {
+			t.Errorf("%s: generated a dhcp-range without a range:\n%s", name, out)
+		}
+	}
+
+	out, err := g.Generate(testConfig("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "dhcp-range=192.168.8.100,192.168.8.200,12h\n") {
+		t.Errorf("missing dhcp-range with the default lease time:\n%s", out)
+	}
+}
+
+func TestValidateSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "options", content: "# Local upstream\n\nserver=/corp.example.com/10.0.0.53\n  log-queries  \naddress = /nas.lan/192.168.8.5\n"},
+		{name: "conf-file", content: "log-queries\nconf-file=/etc/other.conf\n", wantErr: "line 2: conf-file is not allowed"},
+		{name: "conf-dir", content: "conf-dir=/etc/dnsmasq.d,*.conf", wantErr: "line 1: conf-dir is not allowed"},
+		{name: "conf-script", content: "conf-script=/bin/gen", wantErr: "conf-script is not allowed"},
+		{name: "servers-file", content: "servers-file=/etc/servers", wantErr: "servers-file is not allowed"},
+		{name: "include with spaces", content: " conf-file = /etc/other.conf", wantErr: "conf-file is not allowed"},
+		{name: "command-line form", content: "--port=5353", wantErr: `"--port" is not a dnsmasq option`},
+		{name: "upper case", content: "Conf-File=/etc/other.conf", wantErr: "is not a dnsmasq option"},
+		{name: "prose", content: "add the NAS here", wantErr: `"add the NAS here" is not a dnsmasq option`},
+		{name: "no option name", content: "=value", wantErr: "is not a dnsmasq option"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSnippet("10-test.conf", tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateSnippet: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateSnippet = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeSnippets creates a snippets directory holding files
+func writeSnippets(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadSnippets(t *testing.T) {
+	dir := writeSnippets(t, map[string]string{
+		"20-nas.conf":      "address=/nas.lan/192.168.8.5\n\n",
+		"10-upstream.conf": "server=10.0.0.53\n",
+		"README.txt":       "not a snippet",
+		"30-old.conf.bak":  "conf-file=/ignored",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "99-dir.conf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	snippets, err := LoadSnippets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Snippet{
+		{Name: "10-upstream.conf", Content: "server=10.0.0.53"},
+		{Name: "20-nas.conf", Content: "address=/nas.lan/192.168.8.5"},
+	}
+	if len(snippets) != len(want) {
+		t.Fatalf("snippets = %+v, want %+v", snippets, want)
+	}
+	for i := range want {
+		if snippets[i] != want[i] {
+			t.Errorf("snippet %d = %+v, want %+v", i, snippets[i], want[i])
+		}
+	}
+
+	for _, dir := range []string{"", filepath.Join(t.TempDir(), "missing")} {
+		if snippets, err := LoadSnippets(dir); err != nil || snippets != nil {
+			t.Errorf("LoadSnippets(%q) = %v, %v; want no snippets", dir, snippets, err)
+		}
+	}
+
+	bad := writeSnippets(t, map[string]string{"10-ok.conf": "log-dhcp", "20-bad.conf": "conf-dir=/tmp"})
+	if _, err := LoadSnippets(bad); err == nil || !strings.Contains(err.Error(), "20-bad.conf") {
+		t.Errorf("LoadSnippets = %v, want an error naming 20-bad.conf", err)
+	}
+}
+
+func TestGenerateAppendsSnippetsInOrder(t *testing.T) {
+	g := NewConfigGenerator()
+	g.SnippetsDir = writeSnippets(t, map[string]string{
+		"20-b.conf": "address=/b.lan/192.168.8.6",
+		"10-a.conf": "address=/a.lan/192.168.8.5",
+	})
+	out, err := g.Generate(testConfig("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := strings.Index(out, "# --- 10-a.conf ---\naddress=/a.lan/192.168.8.5")
+	b := strings.Index(out, "# --- 20-b.conf ---\naddress=/b.lan/192.168.8.6")
+	if a < 0 || b < 0 || a > b {
+		t.Errorf("snippets missing or out of order:\n%s", out)
+	}
+
+	g.SnippetsDir = writeSnippets(t, map[string]string{"10-bad.conf": "conf-file=/etc/passwd"})
+	if _, err := g.Generate(testConfig("example.com")); err == nil {
+		t.Error("generated a config with an include snippet")
+	}
+}
+
+func TestTemplateOverride(t *testing.T) {
+	dir := t.TempDir()
+	g := NewConfigGenerator()
+	g.TemplateFile = filepath.Join(dir, "dnsmasq.conf.tmpl")
+	g.SnippetsDir = writeSnippets(t, map[string]string{"10-a.conf": "log-dhcp"})
+
+	// Without the file the embedded template is used
+	if got := g.TemplateSource(); got != "embedded" {
+		t.Errorf("TemplateSource = %q, want embedded", got)
+	}
+	out, err := g.Generate(testConfig("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "local=/example.com/") {
+		t.Errorf("embedded template output:\n%s", out)
+	}
+
+	override := "domain={{.Cloud.Domain}}\n{{range .Snippets}}{{.Content}}\n{{end}}"
+	if err := os.WriteFile(g.TemplateFile, []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.TemplateSource(); got != g.TemplateFile {
+		t.Errorf("TemplateSource = %q, want %q", got, g.TemplateFile)
+	}
+	out, err = g.Generate(testConfig("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "domain=example.com\nlog-dhcp\n"; out != want {
+		t.Errorf("override output = %q, want %q", out, want)
+	}
+
+	for name, text := range map[string]string{
+		"syntax error":  "{{.Cloud.Domain",
+		"unknown field": "{{.Cloud.Nope}}",
+	} {
+		if err := os.WriteFile(g.TemplateFile, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.Generate(testConfig("example.com")); err == nil {
+			t.Errorf("%s: generated a config from a broken template", name)
+		}
+	}
+}
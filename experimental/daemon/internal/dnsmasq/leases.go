@@ -0,0 +1,90 @@
+package dnsmasq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lease is one DHCP lease from the dnsmasq lease file
+type Lease struct {
+	MAC      string `json:"mac"`
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+
+	// Expires is nil for infinite leases
+	Expires *time.Time `json:"expires"`
+}
+
+// ReadLeases reads the dnsmasq lease file at path. A missing file has no
+// leases, since dnsmasq only creates it once the first lease is handed out.
+func ReadLeases(path string) ([]Lease, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading lease file: %w", err)
+	}
+	defer f.Close()
+	return ParseLeases(f)
+}
+
+// ParseLeases parses the dnsmasq lease file format: one lease per line with
+// the expiry time, MAC address, IP address, hostname and client ID, where an
+// unknown hostname or client ID is written as "*". DHCPv6 entries are
+// skipped.
+func ParseLeases(r io.Reader) ([]Lease, error) {
+	var leases []Lease
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// The server DUID line starts the DHCPv6 section
+		if fields[0] == "duid" {
+			break
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("lease file line %d: expected at least 4 fields", line)
+		}
+
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("lease file line %d: invalid expiry time %q", line, fields[0])
+		}
+		lease := Lease{
+			MAC:      strings.ToLower(fields[1]),
+			IP:       fields[2],
+			Hostname: unknownAsEmpty(fields[3]),
+		}
+		if len(fields) > 4 {
+			lease.ClientID = unknownAsEmpty(fields[4])
+		}
+		if expiry != 0 {
+			expires := time.Unix(expiry, 0).UTC()
+			lease.Expires = &expires
+		}
+		leases = append(leases, lease)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading lease file: %w", err)
+	}
+	return leases, nil
+}
+
+// unknownAsEmpty maps dnsmasq's "*" placeholder to an empty string
+func unknownAsEmpty(field string) string {
+	if field == "*" {
+		return ""
+	}
+	return field
+}
@@ -0,0 +1,68 @@
+package dnsmasq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLeases(t *testing.T) {
+	content := `1760000000 52:54:00:AA:BB:01 192.168.8.101 cp-1 01:52:54:00:aa:bb:01
+
+0 52:54:00:aa:bb:02 192.168.8.102 * *
+1760003600 52:54:00:aa:bb:03 192.168.8.103 *
+duid 00:01:00:01:2c:3d:4e:5f:52:54:00:aa:bb:01
+1760007200 1234567 fd00::103 node-6 00:01:00:01:2c
+`
+	leases, err := ParseLeases(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := func(unix int64) *time.Time {
+		tm := time.Unix(unix, 0).UTC()
+		return &tm
+	}
+	want := []Lease{
+		{MAC: "52:54:00:aa:bb:01", IP: "192.168.8.101", Hostname: "cp-1", ClientID: "01:52:54:00:aa:bb:01", Expires: expires(1760000000)},
+		{MAC: "52:54:00:aa:bb:02", IP: "192.168.8.102"},
+		{MAC: "52:54:00:aa:bb:03", IP: "192.168.8.103", Expires: expires(1760003600)},
+	}
+	if !reflect.DeepEqual(leases, want) {
+		t.Errorf("leases =\n%+v\nwant\n%+v", leases, want)
+	}
+	if leases[1].Expires != nil {
+		t.Error("expiry 0 should be an infinite lease")
+	}
+}
+
+func TestParseLeasesMalformed(t *testing.T) {
+	tests := map[string]string{
+		"too few fields": "1760000000 52:54:00:aa:bb:01 192.168.8.101\n",
+		"bad expiry":     "soon 52:54:00:aa:bb:01 192.168.8.101 cp-1 *\n",
+	}
+	for name, content := range tests {
+		content = "0 52:54:00:aa:bb:02 192.168.8.102 * *\n" + content
+		if _, err := ParseLeases(strings.NewReader(content)); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: ParseLeases = %v, want an error for line 2", name, err)
+		}
+	}
+}
+
+func TestReadLeasesMissingFile(t *testing.T) {
+	leases, err := ReadLeases(filepath.Join(t.TempDir(), "dnsmasq.leases"))
+	if err != nil || leases != nil {
+		t.Errorf("ReadLeases = %v, %v; want no leases", leases, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	if err := os.WriteFile(path, []byte("0 52:54:00:aa:bb:02 192.168.8.102 * *\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if leases, err := ReadLeases(path); err != nil || len(leases) != 1 {
+		t.Errorf("ReadLeases = %v, %v; want one lease", leases, err)
+	}
+}
@@ -0,0 +1,88 @@
+package dnsmasq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SnippetExt is the extension of snippet files in the snippets directory;
+// other files are ignored, like dnsmasq does for its own conf-dir
+const SnippetExt = ".conf"
+
+// optionName matches a dnsmasq long option as written in a config file
+var optionName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// includeOptions pull in further files that would bypass validation
+var includeOptions = map[string]bool{
+	"conf-file":    true,
+	"conf-dir":     true,
+	"conf-script":  true,
+	"servers-file": true,
+}
+
+// Snippet is an operator-supplied piece of dnsmasq config
+type Snippet struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// LoadSnippets reads and validates every snippet in dir, sorted by file name.
+// A missing directory has no snippets.
+func LoadSnippets(dir string) ([]Snippet, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading snippets directory: %w", err)
+	}
+
+	var snippets []Snippet
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != SnippetExt {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading snippet: %w", err)
+		}
+		if err := ValidateSnippet(entry.Name(), string(content)); err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, Snippet{
+			Name:    entry.Name(),
+			Content: strings.TrimRight(string(content), " \t\r\n"),
+		})
+	}
+
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].Name < snippets[j].Name })
+	return snippets, nil
+}
+
+// ValidateSnippet checks that every line of a snippet is blank, a comment or
+// a dnsmasq option, and that it does not include other files
+func ValidateSnippet(name, content string) error {
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		option, _, _ := strings.Cut(line, "=")
+		option = strings.TrimSpace(option)
+		if !optionName.MatchString(option) {
+			return fmt.Errorf("snippet %s line %d: %q is not a dnsmasq option", name, i+1, option)
+		}
+		if includeOptions[option] {
+			return fmt.Errorf("snippet %s line %d: %s is not allowed in snippets", name, i+1, option)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package events provides a small in-process publish/subscribe bus used to
+// tell API clients about changes made outside of their own requests.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the daemon
+const (
+	ConfigReloaded    = "config.reloaded"
+	ConfigInvalid     = "config.invalid"
+	InstanceActivated = "instance.activated"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it
+const subscriberBuffer = 16
+
+// Event is a single notification delivered to subscribers
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Bus fans events out to every current subscriber
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish delivers an event to all subscribers without blocking. Subscribers
+// that are not keeping up miss the event.
+func (b *Bus) Publish(eventType string, data interface{}) {
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. The returned function unsubscribes
+// and closes the channel.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
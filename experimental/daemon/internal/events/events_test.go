@@ -0,0 +1,75 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishReachesEverySubscriber(t *testing.T) {
+	bus := NewBus()
+	first, unsubscribeFirst := bus.Subscribe()
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := bus.Subscribe()
+	defer unsubscribeSecond()
+
+	bus.Publish(ConfigReloaded, map[string]interface{}{"revision": 3})
+
+	for _, ch := range []<-chan Event{first, second} {
+		select {
+		case event := <-ch:
+			if event.Type != ConfigReloaded || event.Time.IsZero() {
+				t.Errorf("event = %+v", event)
+			}
+			if data, _ := event.Data.(map[string]interface{}); data["revision"] != 3 {
+				t.Errorf("event data = %v", event.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscriber did not receive the event")
+		}
+	}
+}
+
+func TestSlowSubscriberMissesEvents(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	// Publishing never blocks, even once the buffer is full
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriberBuffer+5; i++ {
+			bus.Publish(ConfigInvalid, i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full subscriber")
+	}
+
+	if len(ch) != subscriberBuffer {
+		t.Fatalf("buffered %d events, want %d", len(ch), subscriberBuffer)
+	}
+	for i := 0; i < subscriberBuffer; i++ {
+		if event := <-ch; event.Data != i {
+			t.Errorf("event %d data = %v, want the oldest events kept", i, event.Data)
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe()
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after unsubscribing")
+	}
+	// Publishing after the channel closed must not panic
+	bus.Publish(InstanceActivated, nil)
+	if len(bus.subscribers) != 0 {
+		t.Errorf("bus still holds %d subscribers", len(bus.subscribers))
+	}
+}
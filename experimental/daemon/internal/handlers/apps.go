@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+
+	"wild-cloud-central/internal/apps"
+)
+
+// ListAppSecretsHandler reports which secrets required by the app manifests
+// are missing or still hold CHANGE_ME placeholders, across all apps
+func (app *App) ListAppSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	manifests, ok := app.loadAppManifests(w, "")
+	if !ok {
+		return
+	}
+	app.writeAppSecretsReport(w, manifests)
+}
+
+// GetAppSecretsHandler reports the state of the secrets one app requires
+func (app *App) GetAppSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	manifests, ok := app.loadAppManifests(w, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+	app.writeAppSecretsReport(w, manifests)
+}
+
+// GenerateAppSecretsHandler generates random values for every missing or
+// placeholder secret, for one app or, without an app name, for all apps
+func (app *App) GenerateAppSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	manifests, ok := app.loadAppManifests(w, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+
+	generated, err := apps.Generate(manifests, app.Secrets)
+	if len(generated) > 0 {
+		slog.Info("Generated app secrets", "paths", generated)
+	}
+	if err != nil {
+		writeSecretsError(w, err, "Failed to generate secrets")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"generated": generated})
+}
+
+// writeAppSecretsReport writes the secret report for manifests
+func (app *App) writeAppSecretsReport(w http.ResponseWriter, manifests []*apps.Manifest) {
+	report, err := apps.Check(manifests, app.Secrets)
+	if err != nil {
+		writeSecretsError(w, err, "Failed to check app secrets")
+		return
+	}
+
+	unset := 0
+	for _, appSecrets := range report {
+		for _, secret := range appSecrets.Secrets {
+			if secret.Status != apps.StatusSet {
+				unset++
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"apps":  report,
+		"unset": unset,
+	})
+}
+
+// loadAppManifests reads the manifest of the named app, or of every app if
+// name is empty, writing an error response and returning false on failure
+func (app *App) loadAppManifests(w http.ResponseWriter, name string) ([]*apps.Manifest, bool) {
+	appsDir := app.appsDir()
+	if appsDir == "" {
+		http.Error(w, "No apps directory configured. Set wildcloud.repository or -apps-dir.", http.StatusConflict)
+		return nil, false
+	}
+
+	if name == "" {
+		manifests, err := apps.LoadManifests(appsDir)
+		if err != nil {
+			slog.Error("Failed to load app manifests", "error", err)
+			http.Error(w, "Failed to load app manifests: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		return manifests, true
+	}
+
+	if filepath.Base(name) != name || name == "." || name == ".." {
+		http.Error(w, "Invalid app name", http.StatusBadRequest)
+		return nil, false
+	}
+	manifest, err := apps.LoadManifest(filepath.Join(appsDir, name))
+	if os.IsNotExist(err) {
+		http.Error(w, "App '"+name+"' not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to load app manifest", "app", name, "error", err)
+		http.Error(w, "Failed to load app manifest: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return []*apps.Manifest{manifest}, true
+}
+
+// appsDir returns the directory holding app manifests: the apps-dir setting
+// if given, otherwise the apps directory of the wild-cloud repository
+func (app *App) appsDir() string {
+	if app.Settings != nil && app.Settings.AppsDir.Value != "" {
+		return app.Settings.AppsDir.Value
+	}
+	if cfg := app.CurrentConfig(); cfg != nil && cfg.Wildcloud.Repository != "" {
+		return filepath.Join(cfg.Wildcloud.Repository, "apps")
+	}
+	return ""
+}
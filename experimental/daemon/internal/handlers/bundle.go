@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"wild-cloud-central/internal/bundle"
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/data"
+	"wild-cloud-central/internal/secrets"
+)
+
+// bundlePassphraseHeader carries the passphrase that seals the secrets in a
+// bundle; a header keeps it out of URLs and access logs
+const bundlePassphraseHeader = "X-Bundle-Passphrase"
+
+// maxBundleSize bounds uploaded bundles; assets are not included so real
+// bundles are small
+const maxBundleSize = 64 << 20
+
+// ExportBundleHandler streams a tar.gz bundle of the config, encrypted
+// secrets, revision history, dnsmasq config and an asset manifest.
+// Pass ?secrets=false to leave the secrets out.
+func (app *App) ExportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	passphrase := r.Header.Get(bundlePassphraseHeader)
+	includeSecrets := r.URL.Query().Get("secrets") != "false"
+
+	// Hold the config lock so the bundle is a consistent snapshot
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+
+	if includeSecrets && app.Secrets.State().Locked {
+		writeSecretsError(w, secrets.ErrLocked, "Failed to read secrets")
+		return
+	}
+	if includeSecrets && passphrase == "" {
+		paths, err := app.Secrets.Paths()
+		if err != nil {
+			writeSecretsError(w, err, "Failed to read secrets")
+			return
+		}
+		if len(paths) > 0 {
+			http.Error(w, "A passphrase is required to export secrets. Set the "+bundlePassphraseHeader+" header or pass ?secrets=false.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("wild-cloud-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	paths := app.bundlePaths()
+	if err := bundle.Export(w, paths, app.Secrets, passphrase, includeSecrets); err != nil {
+		// Headers are already sent, so the client sees a truncated archive
+		slog.Error("Failed to export bundle", "error", err)
+	}
+}
+
+// ImportBundleHandler restores a bundle produced by ExportBundleHandler.
+// With ?dryRun=true it only reports what would change.
+func (app *App) ImportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+
+	b, err := bundle.Read(http.MaxBytesReader(w, r.Body, maxBundleSize), r.Header.Get(bundlePassphraseHeader))
+	if errors.Is(err, bundle.ErrPassphraseRequired) {
+		http.Error(w, "The bundle contains secrets. Set the "+bundlePassphraseHeader+" header to the export passphrase.", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, secrets.ErrDecrypt) {
+		http.Error(w, "Failed to decrypt secrets: wrong passphrase or corrupted bundle", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid bundle: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var newConfig *config.Config
+	if b.Config != nil {
+		newConfig, err = config.Parse(b.Config)
+		if err != nil {
+			http.Error(w, "Invalid configuration in bundle: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := newConfig.Validate(); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+	}
+
+	paths := app.bundlePaths()
+	plan, err := b.Plan(paths, app.Secrets)
+	if err != nil {
+		writeSecretsError(w, err, "Failed to compare bundle with current instance")
+		return
+	}
+	if change, err := app.planDnsmasq(newConfig); err != nil {
+		slog.Error("Failed to compare dnsmasq config", "error", err)
+		http.Error(w, "Failed to compare dnsmasq config: "+err.Error(), http.StatusInternalServerError)
+		return
+	} else if change != nil {
+		plan.Changes = append(plan.Changes, *change)
+	}
+
+	dnsmasqUpdated := false
+	if !dryRun {
+		if err := b.Restore(paths, app.Secrets); err != nil {
+			writeSecretsError(w, err, "Failed to restore bundle")
+			return
+		}
+		if newConfig != nil {
+			app.SetConfig(newConfig)
+			app.recordRevision(r, "restored from bundle")
+			app.setConfigETag(w)
+
+			// The bundle's dnsmasq.conf is not trusted; the restored config
+			// generates one that is tested before dnsmasq sees it
+			if !newConfig.IsEmpty() {
+				if dnsmasqUpdated, err = app.writeDnsmasqConfig(newConfig); err != nil {
+					writeDnsmasqError(w, err)
+					return
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dryRun":         dryRun,
+		"manifest":       b.Manifest,
+		"changes":        plan.Changes,
+		"assets":         plan.Assets,
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
+
+// planDnsmasq describes how restoring cfg would change the dnsmasq config
+// on disk, or returns nil if there is no config to restore or this instance
+// does not own dnsmasq
+func (app *App) planDnsmasq(cfg *config.Config) (*bundle.Change, error) {
+	if cfg == nil || cfg.IsEmpty() || !app.OwnsDnsmasq() {
+		return nil, nil
+	}
+	generated, err := app.DnsmasqManager.Generate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	path := app.DataManager.GetPaths().DnsmasqConf
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	change := bundle.CompareFile("dnsmasq", path, current, []byte(generated))
+	change.Detail = "generated from the restored config"
+	return &change, nil
+}
+
+// bundlePaths returns the files a bundle covers. Only the active instance
+// exports the shared dnsmasq config.
+func (app *App) bundlePaths() data.Paths {
+	paths := app.DataManager.GetPaths()
+	if !app.OwnsDnsmasq() {
+		paths.DnsmasqConf = ""
+	}
+	return paths
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/dnsmasq"
+	"wild-cloud-central/internal/yamlpath"
+)
+
+// reservationsPath is where DHCP reservations live in the config
+const reservationsPath = "cluster.nodes.reservations"
+
+// ListReservationsHandler returns the static DHCP reservations
+func (app *App) ListReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	reservations := []config.Reservation{}
+	if cfg := app.CurrentConfig(); cfg != nil && cfg.Cluster.Nodes.Reservations != nil {
+		reservations = cfg.Cluster.Nodes.Reservations
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"reservations": reservations})
+}
+
+// GetReservationHandler returns the reservation for one MAC address
+func (app *App) GetReservationHandler(w http.ResponseWriter, r *http.Request) {
+	mac := mux.Vars(r)["mac"]
+	cfg := app.CurrentConfig()
+	i := -1
+	if cfg != nil {
+		i = config.FindReservation(cfg.Cluster.Nodes.Reservations, mac)
+	}
+	if i < 0 {
+		http.Error(w, "No reservation for '"+mac+"'", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg.Cluster.Nodes.Reservations[i])
+}
+
+// CreateReservationHandler adds a reservation. The MAC address must not
+// already have one.
+func (app *App) CreateReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := decodeReservation(w, r)
+	if !ok {
+		return
+	}
+
+	app.updateReservations(w, r, http.StatusCreated, func(reservations []config.Reservation) ([]config.Reservation, bool) {
+		if config.FindReservation(reservations, reservation.MAC) >= 0 {
+			http.Error(w, "A reservation for '"+reservation.MAC+"' already exists", http.StatusConflict)
+			return nil, false
+		}
+		return append(reservations, reservation), true
+	})
+}
+
+// UpdateReservationHandler replaces the reservation for a MAC address. The
+// body may change the MAC address too.
+func (app *App) UpdateReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := decodeReservation(w, r)
+	if !ok {
+		return
+	}
+
+	mac := mux.Vars(r)["mac"]
+	app.updateReservations(w, r, http.StatusOK, func(reservations []config.Reservation) ([]config.Reservation, bool) {
+		i := config.FindReservation(reservations, mac)
+		if i < 0 {
+			http.Error(w, "No reservation for '"+mac+"'", http.StatusNotFound)
+			return nil, false
+		}
+		reservations[i] = reservation
+		return reservations, true
+	})
+}
+
+// DeleteReservationHandler removes the reservation for a MAC address
+func (app *App) DeleteReservationHandler(w http.ResponseWriter, r *http.Request) {
+	mac := mux.Vars(r)["mac"]
+	app.updateReservations(w, r, http.StatusOK, func(reservations []config.Reservation) ([]config.Reservation, bool) {
+		i := config.FindReservation(reservations, mac)
+		if i < 0 {
+			http.Error(w, "No reservation for '"+mac+"'", http.StatusNotFound)
+			return nil, false
+		}
+		return append(reservations[:i], reservations[i+1:]...), true
+	})
+}
+
+// updateReservations applies edit to the reservations in the config file and
+// commits the result. Validation rejects duplicate MAC addresses and
+// addresses outside the subnet or inside the dynamic range. edit writes its
+// own error response and returns false to abort.
+func (app *App) updateReservations(w http.ResponseWriter, r *http.Request, status int, edit func([]config.Reservation) ([]config.Reservation, bool)) {
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
+	doc, ok := app.loadConfigDocument(w)
+	if !ok {
+		return
+	}
+	var reservations []config.Reservation
+	if node, _, err := yamlpath.Get(doc, reservationsPath); err == nil {
+		if err := node.Decode(&reservations); err != nil {
+			http.Error(w, "Invalid reservations in configuration: "+err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	reservations, ok = edit(reservations)
+	if !ok {
+		return
+	}
+
+	if len(reservations) == 0 {
+		if _, err := yamlpath.Delete(doc, reservationsPath); err != nil && !errors.Is(err, yamlpath.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var node yaml.Node
+		if err := node.Encode(reservations); err != nil {
+			slog.Error("Failed to encode reservations", "error", err)
+			http.Error(w, "Failed to encode reservations", http.StatusInternalServerError)
+			return
+		}
+		if _, err := yamlpath.Set(doc, reservationsPath, &node); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dnsmasqUpdated, ok := app.commitConfigDocument(w, r, doc)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reservations":   reservations,
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
+
+// decodeReservation reads a reservation from the request body, normalizing
+// its MAC address
+func decodeReservation(w http.ResponseWriter, r *http.Request) (config.Reservation, bool) {
+	var reservation config.Reservation
+	if err := json.NewDecoder(r.Body).Decode(&reservation); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return reservation, false
+	}
+	mac, err := config.NormalizeMAC(reservation.MAC)
+	if err != nil {
+		writeValidationError(w, &config.ValidationError{Errors: []config.FieldError{{Field: "mac", Message: err.Error()}}})
+		return reservation, false
+	}
+	reservation.MAC = mac
+	return reservation, true
+}
+
+// leaseInfo is a DHCP lease annotated with what the config knows about it
+type leaseInfo struct {
+	dnsmasq.Lease
+
+	// Node is the hostname of the cluster.nodes.active entry using the
+	// lease's address, or its IP if it has no hostname
+	Node string `json:"node,omitempty"`
+
+	// Reserved is true when the lease's MAC address has a reservation
+	Reserved bool `json:"reserved"`
+}
+
+// ListLeasesHandler returns the current DHCP leases from the dnsmasq lease
+// file, marking those that belong to known nodes or reservations
+func (app *App) ListLeasesHandler(w http.ResponseWriter, r *http.Request) {
+	leases, err := dnsmasq.ReadLeases(app.DataManager.GetPaths().DnsmasqLeases)
+	if err != nil {
+		slog.Error("Failed to read DHCP leases", "error", err)
+		http.Error(w, "Failed to read DHCP leases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cfg := app.CurrentConfig()
+	nodes := make(map[string]string)
+	var reservations []config.Reservation
+	if cfg != nil {
+		for _, node := range cfg.ActiveNodes() {
+			// Nodes without a hostname are known by their address
+			name := node.Hostname
+			if name == "" {
+				name = node.IP
+			}
+			nodes[node.IP] = name
+			if node.MaintenanceIP != "" {
+				nodes[node.MaintenanceIP] = name
+			}
+		}
+		reservations = cfg.Cluster.Nodes.Reservations
+	}
+
+	infos := make([]leaseInfo, 0, len(leases))
+	for _, lease := range leases {
+		infos = append(infos, leaseInfo{
+			Lease:    lease,
+			Node:     nodes[lease.IP],
+			Reserved: config.FindReservation(reservations, lease.MAC) >= 0,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"leases": infos})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"wild-cloud-central/internal/dns"
+)
+
+// dnsRecord is a record served by the embedded DNS server
+type dnsRecord struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	TTL   uint32 `json:"ttl"`
+	Value string `json:"value"`
+}
+
+// dnsResponse describes the embedded DNS server and what it serves
+type dnsResponse struct {
+	Listening string      `json:"listening"`
+	Instance  string      `json:"instance"`
+	Domains   []string    `json:"domains"`
+	Records   []dnsRecord `json:"records"`
+}
+
+// GetDNSHandler handles requests for the records the embedded DNS server
+// answers with. Listening is empty when the server is disabled.
+func (app *App) GetDNSHandler(w http.ResponseWriter, r *http.Request) {
+	zone := app.DNS.Zone()
+	response := dnsResponse{
+		Listening: app.DNS.Addr(),
+		Instance:  app.Instances.ActiveName(),
+		Domains:   zone.Origins(),
+		Records:   []dnsRecord{},
+	}
+	for _, rr := range zone.Records() {
+		response.Records = append(response.Records, dnsRecord{
+			Name:  rr.Name,
+			Type:  dns.TypeName(rr.Type),
+			TTL:   rr.TTL,
+			Value: rr.Value(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,44 +2,173 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/diff"
+	"wild-cloud-central/internal/dnsmasq"
 )
 
 // GetDnsmasqConfigHandler handles requests to view the dnsmasq configuration
 func (app *App) GetDnsmasqConfigHandler(w http.ResponseWriter, r *http.Request) {
-	if app.Config == nil || app.Config.IsEmpty() {
+	cfg := app.CurrentConfig()
+	if cfg.IsEmpty() {
 		http.Error(w, "No configuration available. Please configure the system first.", http.StatusPreconditionFailed)
 		return
 	}
 	
-	config := app.DnsmasqManager.Generate(app.Config)
+	config, err := app.DnsmasqManager.Generate(cfg)
+	if err != nil {
+		slog.Error("Failed to render dnsmasq config", "error", err)
+		http.Error(w, "Failed to render dnsmasq config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(config))
 }
 
 // RestartDnsmasqHandler handles requests to restart the dnsmasq service
 func (app *App) RestartDnsmasqHandler(w http.ResponseWriter, r *http.Request) {
-	if app.Config == nil || app.Config.IsEmpty() {
+	cfg := app.CurrentConfig()
+	if cfg.IsEmpty() {
 		http.Error(w, "No configuration available. Please configure the system first.", http.StatusPreconditionFailed)
 		return
 	}
 
+	// A hand-edited config file may not have been validated yet
+	if err := cfg.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Only the active instance may touch dnsmasq
+	if !app.OwnsDnsmasq() {
+		http.Error(w, "Instance '"+app.Name+"' is not active. Activate it before restarting dnsmasq.", http.StatusConflict)
+		return
+	}
+
 	// Update dnsmasq config first
 	paths := app.DataManager.GetPaths()
-	if err := app.DnsmasqManager.WriteConfig(app.Config, paths.DnsmasqConf); err != nil {
-		log.Printf("Failed to update dnsmasq config: %v", err)
-		http.Error(w, "Failed to update dnsmasq config", http.StatusInternalServerError)
+	if err := app.DnsmasqManager.WriteConfig(cfg, paths.DnsmasqConf); err != nil {
+		writeDnsmasqError(w, err)
 		return
 	}
 
 	// Restart dnsmasq service
-	if err := app.DnsmasqManager.RestartService(); err != nil {
-		log.Printf("Failed to restart dnsmasq: %v", err)
-		http.Error(w, "Failed to restart dnsmasq service", http.StatusInternalServerError)
+	if err := app.DnsmasqManager.RestartService(paths.DnsmasqConf); err != nil {
+		slog.Error("Failed to restart dnsmasq", "error", err)
+		http.Error(w, "Failed to restart dnsmasq service: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "restarted"})
-}
\ No newline at end of file
+}
+
+// DiffDnsmasqConfigHandler shows, as a unified diff, how the dnsmasq config
+// on disk would change if it were regenerated from the current config. An
+// empty response means nothing would change.
+func (app *App) DiffDnsmasqConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.CurrentConfig()
+	if cfg.IsEmpty() {
+		http.Error(w, "No configuration available. Please configure the system first.", http.StatusPreconditionFailed)
+		return
+	}
+
+	generated, err := app.DnsmasqManager.Generate(cfg)
+	if err != nil {
+		slog.Error("Failed to render dnsmasq config", "error", err)
+		http.Error(w, "Failed to render dnsmasq config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	path := app.DataManager.GetPaths().DnsmasqConf
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		slog.Error("Failed to read dnsmasq config", "error", err)
+		http.Error(w, "Failed to read dnsmasq config", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(diff.Unified(path, path+" (generated)", string(current), generated)))
+}
+
+// ApplyDnsmasqConfigHandler writes the dnsmasq config generated from the
+// current config, for changes saved with applyDnsmasq=false. dnsmasq is not
+// restarted.
+func (app *App) ApplyDnsmasqConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.CurrentConfig()
+	if cfg.IsEmpty() {
+		http.Error(w, "No configuration available. Please configure the system first.", http.StatusPreconditionFailed)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if !app.OwnsDnsmasq() {
+		http.Error(w, "Instance '"+app.Name+"' is not active. Activate it before applying its dnsmasq config.", http.StatusConflict)
+		return
+	}
+
+	if _, err := app.writeDnsmasqConfig(cfg); err != nil {
+		writeDnsmasqError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "applied"})
+}
+
+// GetDnsmasqSnippetsHandler lists the dnsmasq snippets and the template in
+// use, reporting why they cannot be rendered if they are invalid
+func (app *App) GetDnsmasqSnippetsHandler(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"template":    app.DnsmasqManager.TemplateSource(),
+		"snippetsDir": app.DnsmasqManager.SnippetsDir,
+		"valid":       true,
+	}
+	snippets, err := dnsmasq.LoadSnippets(app.DnsmasqManager.SnippetsDir)
+	if err != nil {
+		response["valid"] = false
+		response["error"] = err.Error()
+	}
+	if snippets == nil {
+		snippets = []dnsmasq.Snippet{}
+	}
+	response["snippets"] = snippets
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// dnsmasqChanged reports whether the dnsmasq config generated for newConfig
+// differs from the one for oldConfig. A config that fails to render counts as
+// changed so the error surfaces when it is written.
+func (app *App) dnsmasqChanged(oldConfig, newConfig *config.Config) bool {
+	if oldConfig == nil {
+		return true
+	}
+	before, err := app.DnsmasqManager.Generate(oldConfig)
+	if err != nil {
+		return true
+	}
+	after, err := app.DnsmasqManager.Generate(newConfig)
+	return err != nil || before != after
+}
+
+// writeDnsmasqError reports a failed dnsmasq config write. A config dnsmasq
+// rejects is the caller's to fix, so its output is passed on.
+func writeDnsmasqError(w http.ResponseWriter, err error) {
+	var testErr *dnsmasq.TestError
+	if errors.As(err, &testErr) {
+		http.Error(w, testErr.Error()+". dnsmasq keeps its previous config.", http.StatusUnprocessableEntity)
+		return
+	}
+	slog.Error("Failed to update dnsmasq config", "error", err)
+	http.Error(w, "Failed to update dnsmasq config", http.StatusInternalServerError)
+}
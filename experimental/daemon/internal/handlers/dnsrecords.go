@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/yamlpath"
+)
+
+// dnsRecordsPath is where custom DNS records live in the config
+const dnsRecordsPath = "cloud.dns.records"
+
+// dnsRecordInfo is a custom DNS record annotated with the wildcard mapping
+// it takes its name out of
+type dnsRecordInfo struct {
+	config.DNSRecord
+
+	// Overrides is the wildcard mapping, like *.cloud.example.com, that
+	// would otherwise answer for the record's name
+	Overrides string `json:"overrides,omitempty"`
+}
+
+// ListDNSRecordsHandler returns the custom DNS records
+func (app *App) ListDNSRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	records := []dnsRecordInfo{}
+	if cfg := app.CurrentConfig(); cfg != nil {
+		records = describeDNSRecords(cfg, cfg.Cloud.DNS.Records, nil)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"records": records})
+}
+
+// GetDNSRecordsHandler returns the custom DNS records for one name
+func (app *App) GetDNSRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	cfg := app.CurrentConfig()
+	var found []int
+	if cfg != nil {
+		found = config.FindDNSRecords(cfg.Cloud.DNS.Records, name, r.URL.Query().Get("type"))
+	}
+	if len(found) == 0 {
+		http.Error(w, "No DNS records for '"+name+"'", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"records": describeDNSRecords(cfg, cfg.Cloud.DNS.Records, found)})
+}
+
+// CreateDNSRecordHandler adds a custom DNS record. Validation rejects
+// duplicates and records that clash with a CNAME or a wildcard mapping.
+func (app *App) CreateDNSRecordHandler(w http.ResponseWriter, r *http.Request) {
+	var record config.DNSRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	record = config.NormalizeDNSRecord(record)
+
+	app.updateDNSRecords(w, r, http.StatusCreated, func(records []config.DNSRecord) ([]config.DNSRecord, bool) {
+		return append(records, record), true
+	})
+}
+
+// ReplaceDNSRecordsHandler replaces every custom record for a name with the
+// records in the body, which take the name from the URL
+func (app *App) ReplaceDNSRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Records []config.DNSRecord `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(body.Records) == 0 {
+		http.Error(w, "At least one record is required; use DELETE to remove a name", http.StatusBadRequest)
+		return
+	}
+
+	name := config.NormalizeDNSName(mux.Vars(r)["name"])
+	for i := range body.Records {
+		body.Records[i].Name = name
+		body.Records[i] = config.NormalizeDNSRecord(body.Records[i])
+	}
+
+	app.updateDNSRecords(w, r, http.StatusOK, func(records []config.DNSRecord) ([]config.DNSRecord, bool) {
+		found := config.FindDNSRecords(records, name, "")
+		if len(found) == 0 {
+			http.Error(w, "No DNS records for '"+name+"'", http.StatusNotFound)
+			return nil, false
+		}
+		// The new records take the place of the first old one
+		kept := removeDNSRecords(records, found)
+		at := found[0]
+		return append(kept[:at], append(body.Records, kept[at:]...)...), true
+	})
+}
+
+// DeleteDNSRecordsHandler removes the custom records for a name, or only
+// those of the type given by the type query parameter
+func (app *App) DeleteDNSRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	recordType := r.URL.Query().Get("type")
+	app.updateDNSRecords(w, r, http.StatusOK, func(records []config.DNSRecord) ([]config.DNSRecord, bool) {
+		found := config.FindDNSRecords(records, name, recordType)
+		if len(found) == 0 {
+			message := "No DNS records for '" + name + "'"
+			if recordType != "" {
+				message = "No " + strings.ToUpper(recordType) + " records for '" + name + "'"
+			}
+			http.Error(w, message, http.StatusNotFound)
+			return nil, false
+		}
+		return removeDNSRecords(records, found), true
+	})
+}
+
+// updateDNSRecords applies edit to the custom DNS records in the config file
+// and commits the result. edit writes its own error response and returns
+// false to abort.
+func (app *App) updateDNSRecords(w http.ResponseWriter, r *http.Request, status int, edit func([]config.DNSRecord) ([]config.DNSRecord, bool)) {
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
+	doc, ok := app.loadConfigDocument(w)
+	if !ok {
+		return
+	}
+	var records []config.DNSRecord
+	if node, _, err := yamlpath.Get(doc, dnsRecordsPath); err == nil {
+		if err := node.Decode(&records); err != nil {
+			http.Error(w, "Invalid DNS records in configuration: "+err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	records, ok = edit(records)
+	if !ok {
+		return
+	}
+
+	if len(records) == 0 {
+		if _, err := yamlpath.Delete(doc, dnsRecordsPath); err != nil && !errors.Is(err, yamlpath.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var node yaml.Node
+		if err := node.Encode(records); err != nil {
+			slog.Error("Failed to encode DNS records", "error", err)
+			http.Error(w, "Failed to encode DNS records", http.StatusInternalServerError)
+			return
+		}
+		if _, err := yamlpath.Set(doc, dnsRecordsPath, &node); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dnsmasqUpdated, ok := app.commitConfigDocument(w, r, doc)
+	if !ok {
+		return
+	}
+
+	infos := []dnsRecordInfo{}
+	if cfg := app.CurrentConfig(); cfg != nil {
+		infos = describeDNSRecords(cfg, records, nil)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"records":        infos,
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
+
+// describeDNSRecords annotates the records at indexes, or all records if
+// indexes is nil
+func describeDNSRecords(cfg *config.Config, records []config.DNSRecord, indexes []int) []dnsRecordInfo {
+	if indexes == nil {
+		for i := range records {
+			indexes = append(indexes, i)
+		}
+	}
+	infos := make([]dnsRecordInfo, 0, len(indexes))
+	for _, i := range indexes {
+		infos = append(infos, dnsRecordInfo{DNSRecord: records[i], Overrides: cfg.DNSRecordOverrides(records[i])})
+	}
+	return infos
+}
+
+// removeDNSRecords returns records without those at the ascending indexes
+func removeDNSRecords(records []config.DNSRecord, indexes []int) []config.DNSRecord {
+	kept := make([]config.DNSRecord, 0, len(records))
+	for i, record := range records {
+		if len(indexes) > 0 && indexes[0] == i {
+			indexes = indexes[1:]
+			continue
+		}
+		kept = append(kept, record)
+	}
+	return kept
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// configETag derives a strong ETag from the raw config file contents
+func configETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// readConfigFile returns the raw config file and its ETag. A missing file
+// yields nil content and an empty ETag.
+func (app *App) readConfigFile() ([]byte, string, error) {
+	content, err := os.ReadFile(app.DataManager.GetPaths().ConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	return content, configETag(content), nil
+}
+
+// setConfigETag advertises the ETag of the config file as it is now on disk
+func (app *App) setConfigETag(w http.ResponseWriter) {
+	if _, etag, err := app.readConfigFile(); err == nil && etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
+
+// checkIfMatch enforces an If-Match precondition against the config file.
+// If the file changed since the caller read it, a 412 response carrying the
+// current ETag and (redacted) YAML is written and false is returned. Callers
+// must hold app.configMu so the check and the following write are atomic.
+func (app *App) checkIfMatch(w http.ResponseWriter, r *http.Request) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+
+	content, etag, err := app.readConfigFile()
+	if err != nil {
+		slog.Error("Failed to read config file", "error", err)
+		http.Error(w, "Failed to read configuration file", http.StatusInternalServerError)
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if etag != "" && (candidate == "*" || candidate == etag) {
+			return true
+		}
+	}
+
+	response := map[string]interface{}{
+		"error": "Configuration was modified by someone else. Reload and try again.",
+		"etag":  etag,
+	}
+	if content != nil {
+		// The current YAML is left out when it cannot be redacted, for
+		// example while the secrets are locked
+		if redacted, err := app.redactYAML(content); err == nil {
+			response["yaml"] = string(redacted)
+		}
+		w.Header().Set("ETag", etag)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(response)
+	return false
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/data"
+	"wild-cloud-central/internal/dnsmasq"
+	"wild-cloud-central/internal/events"
+	"wild-cloud-central/internal/secrets"
+)
+
+const testConfig = `cloud:
+  domain: example.com
+  dns:
+    ip: 192.168.8.50
+  dhcpRange: 192.168.8.100,192.168.8.200
+operator:
+  email: admin@example.com
+cluster:
+  nodes:
+    talos:
+      version: v1.10.4
+  certManager:
+    cloudflare:
+      apiToken: s3cr3t-token
+`
+
+// newTestApp returns an App serving a fresh data directory that holds
+// testConfig and a secret whose value appears in it
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	manager := data.NewManager()
+	manager.SetOverrides(data.Overrides{DataDir: t.TempDir()})
+	if err := manager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	paths := manager.GetPaths()
+	if err := os.WriteFile(paths.ConfigFile, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{
+		DataManager:    manager,
+		DnsmasqManager: dnsmasq.NewConfigGenerator(),
+		Secrets:        secrets.NewStore(filepath.Join(paths.DataDir, "secrets.yaml")),
+		Events:         events.NewBus(),
+	}
+	if err := app.Secrets.Set("cloudflare.token", "s3cr3t-token"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.current.Store(cfg)
+	return app
+}
+
+func (app *App) testRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/config", app.GetConfigHandler).Methods("GET")
+	r.HandleFunc("/config/values/{path}", app.SetConfigValueHandler).Methods("PUT")
+	r.HandleFunc("/config/values/{path}", app.DeleteConfigValueHandler).Methods("DELETE")
+	return r
+}
+
+func serve(t *testing.T, handler http.Handler, method, target, ifMatch, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestIfMatch(t *testing.T) {
+	app := newTestApp(t)
+	router := app.testRouter()
+
+	got := serve(t, router, "GET", "/config", "", "")
+	etag := got.Header().Get("ETag")
+	if got.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET /config = %d with ETag %q", got.Code, etag)
+	}
+
+	// A write with the current ETag succeeds and changes the ETag
+	got = serve(t, router, "PUT", "/config/values/operator.email", etag, `{"value":"ops@example.com"}`)
+	if got.Code != http.StatusOK {
+		t.Fatalf("PUT with the current ETag = %d: %s", got.Code, got.Body)
+	}
+	newETag := got.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Fatalf("ETag after the write = %q, want a new one (was %q)", newETag, etag)
+	}
+
+	// A write with the stale ETag is refused with the current state
+	for _, method := range []string{"PUT", "DELETE"} {
+		got = serve(t, router, method, "/config/values/operator.email", etag, `{"value":"lost@example.com"}`)
+		if got.Code != http.StatusPreconditionFailed {
+			t.Fatalf("%s with a stale ETag = %d, want 412", method, got.Code)
+		}
+		if header := got.Header().Get("ETag"); header != newETag {
+			t.Errorf("412 ETag header = %q, want %q", header, newETag)
+		}
+		var body struct {
+			ETag string `json:"etag"`
+			YAML string `json:"yaml"`
+		}
+		if err := json.Unmarshal(got.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.ETag != newETag {
+			t.Errorf("412 etag = %q, want %q", body.ETag, newETag)
+		}
+		if !strings.Contains(body.YAML, "ops@example.com") {
+			t.Errorf("412 yaml does not hold the current config:\n%s", body.YAML)
+		}
+		if strings.Contains(body.YAML, "s3cr3t-token") || !strings.Contains(body.YAML, secrets.Placeholder) {
+			t.Errorf("412 yaml is not redacted:\n%s", body.YAML)
+		}
+	}
+	content, err := os.ReadFile(app.DataManager.GetPaths().ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "lost@example.com") || !strings.Contains(string(content), "email: ops@example.com") {
+		t.Errorf("config file changed by a refused write:\n%s", content)
+	}
+
+	// Wildcards, lists and requests without If-Match go through
+	for _, ifMatch := range []string{`"stale", ` + newETag, "*", ""} {
+		got = serve(t, router, "PUT", "/config/values/operator.name", ifMatch, `{"value":"ops"}`)
+		if got.Code != http.StatusOK {
+			t.Errorf("PUT with If-Match %q = %d: %s", ifMatch, got.Code, got.Body)
+		}
+	}
+}
+
+func TestIfMatchWithoutConfigFile(t *testing.T) {
+	app := newTestApp(t)
+	if err := os.Remove(app.DataManager.GetPaths().ConfigFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// There is no representation for * to match
+	got := serve(t, app.testRouter(), "PUT", "/config/values/operator.email", "*", `{"value":"ops@example.com"}`)
+	if got.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT with If-Match * = %d, want 412", got.Code)
+	}
+	if header := got.Header().Get("ETag"); header != "" {
+		t.Errorf("412 ETag header = %q, want none", header)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(got.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["yaml"]; ok || body["etag"] != "" {
+		t.Errorf("412 body = %v, want an empty etag and no yaml", body)
+	}
+	if _, err := os.Stat(app.DataManager.GetPaths().ConfigFile); !os.IsNotExist(err) {
+		t.Error("refused write created the config file")
+	}
+}
+
+func TestIfMatchWithLockedSecrets(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.Secrets.Rotate("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Secrets.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The current YAML is withheld rather than shown unredacted
+	got := serve(t, app.testRouter(), "DELETE", "/config/values/operator.email", `"stale"`, "")
+	if got.Code != http.StatusPreconditionFailed {
+		t.Fatalf("DELETE with a stale ETag = %d, want 412", got.Code)
+	}
+	if strings.Contains(got.Body.String(), "s3cr3t-token") || strings.Contains(got.Body.String(), `"yaml"`) {
+		t.Errorf("412 body while locked = %s", got.Body)
+	}
+	if got.Header().Get("ETag") == "" {
+		t.Error("412 response has no ETag")
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/events"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a comment so
+// proxies do not close it
+const eventsKeepAlive = 30 * time.Second
+
+// EventsHandler streams daemon events to the client as server-sent events
+func (app *App) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := app.Events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.Error("Failed to encode event", "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// ReloadConfig activates a config that was changed on disk outside the API.
+// It is called by the config watcher with app.configMu held.
+func (app *App) ReloadConfig(newConfig *config.Config, content []byte) {
+	oldConfig := app.CurrentConfig()
+	app.SetConfig(newConfig)
+	app.RecordRevision("file watcher", "")
+
+	// Only touch dnsmasq when the generated config actually differs
+	dnsmasqUpdated := false
+	if !newConfig.IsEmpty() && app.dnsmasqChanged(oldConfig, newConfig) {
+		updated, err := app.writeDnsmasqConfig(newConfig)
+		if err != nil {
+			app.logger().Error("Failed to update dnsmasq config after reload", "error", err)
+		}
+		dnsmasqUpdated = updated
+	}
+
+	app.publish(events.ConfigReloaded, map[string]interface{}{
+		"etag":           configETag(content),
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
+
+// RejectConfig reports a config file change that failed to parse or
+// validate; the previous config stays active
+func (app *App) RejectConfig(err error) {
+	data := map[string]interface{}{"error": err.Error()}
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		data["error"] = "Configuration is invalid"
+		data["fields"] = validationErr.Errors
+	}
+	app.publish(events.ConfigInvalid, data)
+}
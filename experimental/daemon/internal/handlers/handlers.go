@@ -1,24 +1,72 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"gopkg.in/yaml.v3"
+
 	"wild-cloud-central/internal/config"
 	"wild-cloud-central/internal/data"
+	"wild-cloud-central/internal/dns"
 	"wild-cloud-central/internal/dnsmasq"
+	"wild-cloud-central/internal/events"
+	"wild-cloud-central/internal/patch"
+	"wild-cloud-central/internal/secrets"
+	"wild-cloud-central/internal/service"
+	"wild-cloud-central/internal/settings"
+	"wild-cloud-central/internal/tftp"
+	"wild-cloud-central/internal/yamlpath"
 )
 
 // App represents the application with its dependencies
 type App struct {
-	Config         *config.Config
+	// Name identifies the instance this App serves
+	Name      string
+	Instances *Instances
+
 	StartTime      time.Time
 	DataManager    *data.Manager
 	DnsmasqManager *dnsmasq.ConfigGenerator
+	Secrets        *secrets.Store
+	Revisions      *config.RevisionStore
+	Events         *events.Bus
+	Watcher        *config.Watcher
+	Settings       *settings.Settings
+
+	// DNS is the embedded DNS server shared by all instances; it serves
+	// the active one
+	DNS *dns.Server
+
+	// TFTP is the embedded TFTP server shared by all instances; it serves
+	// the active one's tftp assets
+	TFTP *tftp.Server
+
+	// Services controls dnsmasq and the helper services; it is daemon-wide
+	// and only set on the default instance
+	Services service.Manager
+
+	// Migrations lists the schema migrations applied to the config at startup
+	Migrations []config.AppliedMigration
+
+	// current holds the active config; it is swapped atomically on reload
+	current atomic.Pointer[config.Config]
+
+	// configMu serializes writes to the config file
+	configMu sync.Mutex
+
+	// stop ends the config watcher of a deleted instance
+	stop context.CancelFunc
 }
 
 // NewApp creates a new application instance
@@ -27,9 +75,30 @@ func NewApp() *App {
 		StartTime:      time.Now(),
 		DataManager:    data.NewManager(),
 		DnsmasqManager: dnsmasq.NewConfigGenerator(),
+		Events:         events.NewBus(),
+		DNS:            dns.NewServer(),
+		TFTP:           tftp.NewServer(),
 	}
 }
 
+// CurrentConfig returns the active configuration, or nil if none is loaded
+func (app *App) CurrentConfig() *config.Config {
+	return app.current.Load()
+}
+
+// SetConfig atomically replaces the active configuration, logs its
+// warnings and refreshes the DNS and TFTP servers for it
+func (app *App) SetConfig(cfg *config.Config) {
+	app.current.Store(cfg)
+	app.logConfigWarnings(cfg)
+	app.updateServers(cfg)
+}
+
+// ConfigLock returns the lock that serializes config file writes
+func (app *App) ConfigLock() sync.Locker {
+	return &app.configMu
+}
+
 // HealthHandler handles health check requests
 func (app *App) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{
@@ -50,6 +119,12 @@ func (app *App) StatusHandler(w http.ResponseWriter, r *http.Request) {
 		"uptime":    uptime.String(),
 		"timestamp": time.Now().UnixMilli(),
 	}
+	if app.Secrets != nil {
+		response["secrets"] = app.Secrets.State()
+	}
+	if app.Name != "" {
+		response["instance"] = app.Name
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -60,10 +135,17 @@ func (app *App) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Always reload config from file on each request
-	paths := app.DataManager.GetPaths()
-	cfg, err := config.Load(paths.ConfigFile)
+	content, etag, err := app.readConfigFile()
+	var cfg *config.Config
+	if err == nil {
+		if content == nil {
+			err = os.ErrNotExist
+		} else {
+			cfg, err = config.Parse(content)
+		}
+	}
 	if err != nil {
-		log.Printf("Failed to load config from file: %v", err)
+		slog.Error("Failed to load config from file", "error", err)
 		response := map[string]interface{}{
 			"configured": false,
 			"message":    "No configuration found. Please POST a configuration to /api/v1/config to get started.",
@@ -72,9 +154,6 @@ func (app *App) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update the cached config with fresh data
-	app.Config = cfg
-
 	// Check if config is empty/uninitialized
 	if cfg.IsEmpty() {
 		response := map[string]interface{}{
@@ -85,17 +164,28 @@ func (app *App) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Never hand secret values to the UI
+	redacted, err := app.redactConfig(cfg)
+	if err != nil {
+		writeSecretsError(w, err, "Failed to read secrets")
+		return
+	}
+
 	response := map[string]interface{}{
 		"configured": true,
-		"config":     cfg,
+		"config":     redacted,
 	}
+	w.Header().Set("ETag", etag)
 	json.NewEncoder(w).Encode(response)
 }
 
 // CreateConfigHandler handles configuration creation requests
 func (app *App) CreateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+
 	// Only allow config creation if no config exists
-	if app.Config != nil && !app.Config.IsEmpty() {
+	if app.CurrentConfig() != nil && !app.CurrentConfig().IsEmpty() {
 		http.Error(w, "Configuration already exists. Use PUT to update.", http.StatusConflict)
 		return
 	}
@@ -114,15 +204,22 @@ func (app *App) CreateConfigHandler(w http.ResponseWriter, r *http.Request) {
 		newConfig.Server.Host = "0.0.0.0"
 	}
 
-	app.Config = &newConfig
+	if err := newConfig.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	// Persist config to file
+	// Persist config to file before it takes effect
 	paths := app.DataManager.GetPaths()
-	if err := config.Save(app.Config, paths.ConfigFile); err != nil {
-		log.Printf("Failed to save config: %v", err)
+	if err := config.Save(&newConfig, paths.ConfigFile); err != nil {
+		slog.Error("Failed to save config", "error", err)
 		http.Error(w, "Failed to save config", http.StatusInternalServerError)
 		return
 	}
+	app.recordRevision(r, "")
+	app.setConfigETag(w)
+
+	app.SetConfig(&newConfig)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
@@ -130,8 +227,14 @@ func (app *App) CreateConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdateConfigHandler handles configuration update requests
 func (app *App) UpdateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
 	// Check if config exists
-	if app.Config == nil || app.Config.IsEmpty() {
+	if app.CurrentConfig() == nil || app.CurrentConfig().IsEmpty() {
 		http.Error(w, "No configuration exists. Use POST to create initial configuration.", http.StatusNotFound)
 		return
 	}
@@ -142,20 +245,33 @@ func (app *App) UpdateConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.Config = &newConfig
+	// Keep secret values the client only saw as placeholders
+	if err := restoreRedactedConfig(&newConfig, app.CurrentConfig()); err != nil {
+		slog.Error("Failed to restore redacted values", "error", err)
+		http.Error(w, "Invalid configuration", http.StatusBadRequest)
+		return
+	}
+
+	if err := newConfig.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	// Persist config to file
+	// Persist config to file before it takes effect
 	paths := app.DataManager.GetPaths()
-	if err := config.Save(app.Config, paths.ConfigFile); err != nil {
-		log.Printf("Failed to save config: %v", err)
+	if err := config.Save(&newConfig, paths.ConfigFile); err != nil {
+		slog.Error("Failed to save config", "error", err)
 		http.Error(w, "Failed to save config", http.StatusInternalServerError)
 		return
 	}
+	app.recordRevision(r, "")
+	app.setConfigETag(w)
+
+	app.SetConfig(&newConfig)
 
 	// Regenerate and apply dnsmasq config
-	if err := app.DnsmasqManager.WriteConfig(app.Config, paths.DnsmasqConf); err != nil {
-		log.Printf("Failed to update dnsmasq config: %v", err)
-		http.Error(w, "Failed to update dnsmasq config", http.StatusInternalServerError)
+	if _, err := app.updateDnsmasq(r, app.CurrentConfig()); err != nil {
+		writeDnsmasqError(w, err)
 		return
 	}
 
@@ -163,6 +279,95 @@ func (app *App) UpdateConfigHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
 }
 
+// PatchConfigHandler applies a JSON Merge Patch or JSON Patch to the config
+// file. Patches address the whole document, including sections the daemon
+// does not model. dnsmasq is only regenerated when the patch changes its
+// output.
+func (app *App) PatchConfigHandler(w http.ResponseWriter, r *http.Request) {
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
+	if app.CurrentConfig() == nil || app.CurrentConfig().IsEmpty() {
+		http.Error(w, "No configuration exists. Use POST to create initial configuration.", http.StatusNotFound)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != patch.MergePatchType && contentType != patch.JSONPatchType {
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		http.Error(w, "Unsupported patch type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patchDoc, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("Failed to read request body", "error", err)
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	// Patch the config document rather than the modelled config, so keys
+	// the daemon does not model and the file's comments survive
+	doc, ok := app.loadConfigDocument(w)
+	if !ok {
+		return
+	}
+	previous, err := yamlpath.ToValue(doc)
+	if err != nil {
+		slog.Error("Failed to decode config file", "error", err)
+		http.Error(w, "Failed to read current config", http.StatusInternalServerError)
+		return
+	}
+	current, err := json.Marshal(previous)
+	if err != nil {
+		slog.Error("Failed to marshal current config", "error", err)
+		http.Error(w, "Failed to read current config", http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := patch.Apply(contentType, current, patchDoc)
+	if errors.Is(err, patch.ErrTestFailed) {
+		http.Error(w, "Patch test failed: "+err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid patch: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(patched, &value); err != nil {
+		http.Error(w, "Invalid patch: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		http.Error(w, "Patch produces an invalid configuration: the config must be an object", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Keep secret values the client only saw as placeholders
+	value = secrets.RestoreValue(value, previous)
+
+	if err := yamlpath.Update(doc, value); err != nil {
+		http.Error(w, "Patch produces an invalid configuration: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	dnsmasqUpdated, ok := app.commitConfigDocument(w, r, doc)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "updated",
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
+
 // GetConfigYamlHandler handles raw YAML config file retrieval
 func (app *App) GetConfigYamlHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -179,12 +384,21 @@ func (app *App) GetConfigYamlHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Configuration file not found", http.StatusNotFound)
 			return
 		}
-		log.Printf("Failed to read config file: %v", err)
+		slog.Error("Failed to read config file", "error", err)
 		http.Error(w, "Failed to read configuration file", http.StatusInternalServerError)
 		return
 	}
 
+	// Never hand secret values to the UI
+	rawContent := yamlContent
+	yamlContent, err = app.redactYAML(yamlContent)
+	if err != nil {
+		writeSecretsError(w, err, "Failed to read configuration file")
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", configETag(rawContent))
 	w.Write(yamlContent)
 }
 
@@ -195,43 +409,57 @@ func (app *App) UpdateConfigYamlHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
 	// Read the raw YAML content from request body
 	yamlContent, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Failed to read request body: %v", err)
+		slog.Error("Failed to read request body", "error", err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
 
 	paths := app.DataManager.GetPaths()
 
-	// Write the raw YAML content to file
-	if err := os.WriteFile(paths.ConfigFile, yamlContent, 0644); err != nil {
-		log.Printf("Failed to write config file: %v", err)
-		http.Error(w, "Failed to write configuration file", http.StatusInternalServerError)
-		return
+	// Keep secret values the client only saw as placeholders
+	if bytes.Contains(yamlContent, []byte(secrets.Placeholder)) {
+		yamlContent, err = restoreRedactedYAML(yamlContent, paths.ConfigFile)
+		if err != nil {
+			slog.Error("Failed to restore redacted values", "error", err)
+			http.Error(w, "Invalid YAML: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Try to reload the config to validate it and update the in-memory config
-	newConfig, err := config.Load(paths.ConfigFile)
+	// Parse and validate before anything touches the disk
+	newConfig, err := config.Parse(yamlContent)
 	if err != nil {
-		log.Printf("Warning: Saved YAML config but failed to parse it: %v", err)
-		// File was written but parsing failed - this is a validation warning
-		w.Header().Set("Content-Type", "application/json")
-		response := map[string]interface{}{
-			"status":  "saved_with_warnings",
-			"warning": "Configuration saved but contains validation errors: " + err.Error(),
-		}
-		json.NewEncoder(w).Encode(response)
+		http.Error(w, "Invalid YAML: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := newConfig.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Write the raw YAML content to file
+	if err := config.WriteFile(paths.ConfigFile, yamlContent); err != nil {
+		slog.Error("Failed to write config file", "error", err)
+		http.Error(w, "Failed to write configuration file", http.StatusInternalServerError)
 		return
 	}
+	app.recordRevision(r, "")
+	app.setConfigETag(w)
 
-	// Update in-memory config if parsing succeeded
-	app.Config = newConfig
+	app.SetConfig(newConfig)
 
 	// Try to regenerate dnsmasq config if the new config is valid
-	if err := app.DnsmasqManager.WriteConfig(app.Config, paths.DnsmasqConf); err != nil {
-		log.Printf("Warning: Failed to update dnsmasq config: %v", err)
+	if _, err := app.updateDnsmasq(r, app.CurrentConfig()); err != nil {
+		slog.Warn("Failed to update dnsmasq config", "error", err)
 		// Config was saved but dnsmasq update failed
 		w.Header().Set("Content-Type", "application/json")
 		response := map[string]interface{}{
@@ -246,12 +474,54 @@ func (app *App) UpdateConfigYamlHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
 }
 
+// writeValidationError reports a failed config validation, listing every
+// invalid field when the error carries them
+func writeValidationError(w http.ResponseWriter, err error) {
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Configuration is invalid",
+		"fields": validationErr.Errors,
+	})
+}
+
+// restoreRedactedYAML puts back secret values from the file at configPath
+// that a client echoed as placeholders from a redacted response
+func restoreRedactedYAML(content []byte, configPath string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	existing, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return content, nil
+		}
+		return nil, err
+	}
+	var previous yaml.Node
+	if err := yaml.Unmarshal(existing, &previous); err != nil {
+		return content, nil
+	}
+
+	secrets.RestoreNode(&doc, &previous)
+	return config.EncodeDocument(&doc)
+}
+
 // CORSMiddleware adds CORS headers to responses
 func (app *App) CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, X-Bundle-Passphrase")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/dnsmasq"
+	"wild-cloud-central/internal/events"
+	"wild-cloud-central/internal/secrets"
+)
+
+// DefaultInstance is the instance that uses the original single-instance
+// data layout
+const DefaultInstance = "default"
+
+// activeFile records the active instance inside the instances directory
+const activeFile = "active"
+
+// instanceName restricts names to something safe to use as a directory
+var instanceName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+var (
+	// ErrInstanceNotFound is returned for unknown instance names
+	ErrInstanceNotFound = errors.New("instance not found")
+
+	// ErrInstanceExists is returned when creating a name that is taken
+	ErrInstanceExists = errors.New("instance already exists")
+)
+
+// Instances holds every wild-cloud instance managed by the daemon. Each
+// instance is an App with its own config, secrets, assets and revisions; the
+// active instance is the only one that writes the dnsmasq config.
+type Instances struct {
+	mu     sync.RWMutex
+	root   *App
+	apps   map[string]*App
+	active string
+
+	// activateMu serializes activations, which restart dnsmasq
+	activateMu sync.Mutex
+
+	// Setup runs on each instance after it is opened, before it serves requests
+	Setup func(*App)
+}
+
+// NewInstances creates a registry whose default instance is root. The
+// root app's data manager must already be initialized.
+func NewInstances(root *App) *Instances {
+	root.Name = DefaultInstance
+	in := &Instances{
+		root:   root,
+		apps:   map[string]*App{},
+		active: DefaultInstance,
+	}
+	root.Instances = in
+	return in
+}
+
+// Open opens the default instance and every named instance found under the
+// data directory, and restores the active instance from the last run
+func (in *Instances) Open() error {
+	in.open(in.root)
+
+	dir := in.root.DataManager.InstancesDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading instances directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || name == DefaultInstance || !instanceName.MatchString(name) {
+			continue
+		}
+		app, err := in.newInstance(name)
+		if err != nil {
+			return err
+		}
+		in.open(app)
+	}
+
+	if content, err := os.ReadFile(filepath.Join(dir, activeFile)); err == nil {
+		name := strings.TrimSpace(string(content))
+		if _, ok := in.apps[name]; ok {
+			in.active = name
+			slog.Info("Active instance", "name", name)
+		} else {
+			slog.Warn("Active instance no longer exists", "name", name, "using", DefaultInstance)
+		}
+	}
+
+	// The DNS and TFTP servers serve the active instance
+	active := in.Active()
+	active.updateServers(active.CurrentConfig())
+	return nil
+}
+
+// Get returns the named instance
+func (in *Instances) Get(name string) (*App, bool) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	app, ok := in.apps[name]
+	return app, ok
+}
+
+// Active returns the instance that owns dnsmasq
+func (in *Instances) Active() *App {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return in.apps[in.active]
+}
+
+// ActiveName returns the name of the instance that owns dnsmasq
+func (in *Instances) ActiveName() string {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return in.active
+}
+
+// List returns every instance sorted by name
+func (in *Instances) List() []*App {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	apps := make([]*App, 0, len(in.apps))
+	for _, app := range in.apps {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+	return apps
+}
+
+// Create adds a new, empty instance
+func (in *Instances) Create(name string) (*App, error) {
+	if !instanceName.MatchString(name) {
+		return nil, fmt.Errorf("invalid instance name %q: use lowercase letters, digits and dashes", name)
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if _, ok := in.apps[name]; ok {
+		return nil, ErrInstanceExists
+	}
+	app, err := in.newInstance(name)
+	if err != nil {
+		return nil, err
+	}
+	in.openLocked(app)
+	slog.Info("Created instance", "name", name, "dataDir", app.DataManager.GetPaths().DataDir)
+	return app, nil
+}
+
+// Delete stops the named instance and removes its data. The default and the
+// active instance cannot be deleted.
+func (in *Instances) Delete(name string) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	app, ok := in.apps[name]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	if name == DefaultInstance {
+		return errors.New("the default instance cannot be deleted")
+	}
+	if name == in.active {
+		return errors.New("the active instance cannot be deleted; activate another instance first")
+	}
+
+	app.stop()
+	delete(in.apps, name)
+	if err := os.RemoveAll(app.DataManager.GetPaths().DataDir); err != nil {
+		return fmt.Errorf("removing instance data: %w", err)
+	}
+	slog.Info("Deleted instance", "name", name)
+	return nil
+}
+
+// Activate makes the named instance the owner of dnsmasq. Its config is
+// validated, written and dnsmasq restarted with it before the choice is
+// recorded, so a failure at any step leaves the previous instance active.
+// It reports whether the dnsmasq config was written.
+func (in *Instances) Activate(name string) (bool, error) {
+	in.activateMu.Lock()
+	defer in.activateMu.Unlock()
+
+	in.mu.RLock()
+	app, ok := in.apps[name]
+	previous := in.apps[in.active]
+	in.mu.RUnlock()
+	if !ok {
+		return false, ErrInstanceNotFound
+	}
+
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	cfg := app.CurrentConfig()
+	paths := app.DataManager.GetPaths()
+
+	written := false
+	if !cfg.IsEmpty() {
+		if err := cfg.Validate(); err != nil {
+			return false, err
+		}
+		if err := app.DnsmasqManager.WriteConfig(cfg, paths.DnsmasqConf); err != nil {
+			return false, fmt.Errorf("writing dnsmasq config: %w", err)
+		}
+		written = true
+		// A failed restart normally puts back the config dnsmasq last ran
+		// with; regenerate the previous instance's if even that failed
+		if err := app.DnsmasqManager.RestartService(paths.DnsmasqConf); err != nil {
+			var restartErr *dnsmasq.RestartError
+			if !errors.As(err, &restartErr) || !restartErr.RolledBack {
+				in.restoreDnsmasq(previous, app)
+			}
+			return false, fmt.Errorf("restarting dnsmasq: %w", err)
+		}
+	}
+
+	if err := in.recordActive(name); err != nil {
+		if written {
+			in.restoreDnsmasq(previous, app)
+		}
+		return false, err
+	}
+
+	in.mu.Lock()
+	in.active = name
+	in.mu.Unlock()
+	slog.Info("Active instance", "name", name)
+	app.updateServers(cfg)
+	return written, nil
+}
+
+// recordActive persists the name of the active instance
+func (in *Instances) recordActive(name string) error {
+	dir := in.root.DataManager.InstancesDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating instances directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, activeFile), []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("recording active instance: %w", err)
+	}
+	return nil
+}
+
+// restoreDnsmasq hands dnsmasq back to the previous active instance when
+// activating failed went wrong part way. The caller holds the config lock
+// of failed.
+func (in *Instances) restoreDnsmasq(previous, failed *App) {
+	if previous == nil || previous == failed {
+		return
+	}
+	previous.configMu.Lock()
+	defer previous.configMu.Unlock()
+	cfg := previous.CurrentConfig()
+	if cfg.IsEmpty() {
+		return
+	}
+
+	conf := previous.DataManager.GetPaths().DnsmasqConf
+	err := previous.DnsmasqManager.WriteConfig(cfg, conf)
+	if err == nil {
+		err = previous.DnsmasqManager.RestartService(conf)
+	}
+	if err != nil {
+		slog.Error("Failed to restore the dnsmasq config of the active instance", "name", previous.Name, "error", err)
+	}
+}
+
+// newInstance creates the App for a named instance, sharing the daemon-wide
+// dependencies of the default instance
+func (in *Instances) newInstance(name string) (*App, error) {
+	manager := in.root.DataManager.ForInstance(name)
+	if err := manager.CreateDirs(); err != nil {
+		return nil, err
+	}
+	return &App{
+		Name:           name,
+		Instances:      in,
+		StartTime:      in.root.StartTime,
+		DataManager:    manager,
+		DnsmasqManager: in.root.DnsmasqManager,
+		Events:         in.root.Events,
+		Settings:       in.root.Settings,
+		DNS:            in.root.DNS,
+		TFTP:           in.root.TFTP,
+	}, nil
+}
+
+// open registers and starts an instance
+func (in *Instances) open(app *App) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.openLocked(app)
+}
+
+// openLocked is open with in.mu held
+func (in *Instances) openLocked(app *App) {
+	app.open()
+	if in.Setup != nil {
+		in.Setup(app)
+	}
+	in.apps[app.Name] = app
+}
+
+// open loads the instance's config and secrets and starts watching its
+// config file for outside edits
+func (app *App) open() {
+	paths := app.DataManager.GetPaths()
+	if cfg, err := config.Load(paths.ConfigFile); err != nil {
+		app.logger().Info("No configuration found, starting with empty config", "error", err)
+	} else {
+		// Stored directly: the DNS and TFTP servers are updated once the
+		// active instance is known
+		app.current.Store(cfg)
+		app.Migrations = cfg.AppliedMigrations()
+		for _, m := range app.Migrations {
+			app.logger().Info("Migrated config", "from", m.From, "to", m.To, "description", m.Description, "backup", m.Backup)
+		}
+		app.logger().Info("Configuration loaded successfully")
+		app.logConfigWarnings(cfg)
+	}
+
+	// Secrets live alongside the config but are never returned with it
+	app.Secrets = secrets.NewStore(paths.SecretsFile)
+
+	// Reload the config when it is edited outside the API
+	app.Watcher = config.NewWatcher(paths.ConfigFile, config.DefaultWatchInterval, app.ConfigLock())
+	app.Watcher.OnChange = app.ReloadConfig
+	app.Watcher.OnInvalid = app.RejectConfig
+
+	// Capture the config as found on disk so later edits can be rolled back
+	app.Revisions = config.NewRevisionStore(paths.RevisionsDir)
+	app.RecordRevision("startup", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.stop = cancel
+	go app.Watcher.Start(ctx)
+}
+
+// logger returns the default logger, tagged with the instance name for
+// named instances
+func (app *App) logger() *slog.Logger {
+	if app.Name != "" && app.Name != DefaultInstance {
+		return slog.With("instance", app.Name)
+	}
+	return slog.Default()
+}
+
+// OwnsDnsmasq reports whether this instance may write the dnsmasq config
+func (app *App) OwnsDnsmasq() bool {
+	return app.Instances == nil || app.Instances.ActiveName() == app.Name
+}
+
+// updateDnsmasq regenerates the dnsmasq config after a config change made by
+// r, unless the request asked to leave dnsmasq alone with applyDnsmasq=false
+func (app *App) updateDnsmasq(r *http.Request, cfg *config.Config) (bool, error) {
+	if r.URL.Query().Get("applyDnsmasq") == "false" {
+		return false, nil
+	}
+	return app.writeDnsmasqConfig(cfg)
+}
+
+// writeDnsmasqConfig regenerates the dnsmasq config from cfg when this is
+// the active instance. It reports whether the config was written.
+func (app *App) writeDnsmasqConfig(cfg *config.Config) (bool, error) {
+	if !app.OwnsDnsmasq() {
+		return false, nil
+	}
+	if err := app.DnsmasqManager.WriteConfig(cfg, app.DataManager.GetPaths().DnsmasqConf); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// updateServers refreshes the embedded DNS and TFTP servers from cfg when
+// this is the active instance
+func (app *App) updateServers(cfg *config.Config) {
+	if cfg == nil || !app.OwnsDnsmasq() {
+		return
+	}
+	if app.DNS != nil {
+		if err := app.DNS.Update(cfg); err != nil {
+			app.logger().Error("Failed to update DNS server", "error", err)
+		}
+	}
+	if app.TFTP != nil {
+		root := filepath.Join(app.DataManager.GetPaths().AssetsDir, "tftp")
+		if err := app.TFTP.Update(cfg, root); err != nil {
+			app.logger().Error("Failed to update TFTP server", "error", err)
+		}
+	}
+}
+
+// publish sends an event tagged with the instance it concerns
+func (app *App) publish(eventType string, data map[string]interface{}) {
+	if app.Name != "" {
+		data["instance"] = app.Name
+	}
+	app.Events.Publish(eventType, data)
+}
+
+// instanceInfo is the summary of an instance returned by the API
+type instanceInfo struct {
+	Name       string `json:"name"`
+	Active     bool   `json:"active"`
+	Configured bool   `json:"configured"`
+	DataDir    string `json:"dataDir"`
+}
+
+// info summarizes the instance
+func (app *App) info() instanceInfo {
+	return instanceInfo{
+		Name:       app.Name,
+		Active:     app.OwnsDnsmasq(),
+		Configured: !app.CurrentConfig().IsEmpty(),
+		DataDir:    app.DataManager.GetPaths().DataDir,
+	}
+}
+
+// ResolveActive returns the active instance; it serves the unprefixed routes
+func (in *Instances) ResolveActive(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	return in.Active(), true
+}
+
+// ResolveNamed returns the instance named in the request path, writing a 404
+// if it does not exist
+func (in *Instances) ResolveNamed(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	name := mux.Vars(r)["instance"]
+	app, ok := in.Get(name)
+	if !ok {
+		http.Error(w, "Instance '"+name+"' not found", http.StatusNotFound)
+	}
+	return app, ok
+}
+
+// ListInstancesHandler lists every instance and which one is active
+func (app *App) ListInstancesHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.Instances.List()
+	infos := make([]instanceInfo, 0, len(list))
+	for _, instance := range list {
+		infos = append(infos, instance.info())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":    app.Instances.ActiveName(),
+		"instances": infos,
+	})
+}
+
+// CreateInstanceHandler creates a new, empty instance
+func (app *App) CreateInstanceHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	instance, err := app.Instances.Create(request.Name)
+	if errors.Is(err, ErrInstanceExists) {
+		http.Error(w, "Instance '"+request.Name+"' already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create instance", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(instance.info())
+}
+
+// DeleteInstanceHandler removes an instance and all of its data
+func (app *App) DeleteInstanceHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["instance"]
+	err := app.Instances.Delete(name)
+	if errors.Is(err, ErrInstanceNotFound) {
+		http.Error(w, "Instance '"+name+"' not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete instance", "name", name, "error", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// ActivateInstanceHandler hands dnsmasq over to an instance. The previous
+// instance stays active if the new one's config is invalid or dnsmasq does
+// not come back with it.
+func (app *App) ActivateInstanceHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["instance"]
+	dnsmasqUpdated, err := app.Instances.Activate(name)
+	if errors.Is(err, ErrInstanceNotFound) {
+		http.Error(w, "Instance '"+name+"' not found", http.StatusNotFound)
+		return
+	}
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		writeValidationError(w, err)
+		return
+	}
+	var testErr *dnsmasq.TestError
+	if errors.As(err, &testErr) {
+		writeDnsmasqError(w, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to activate instance", "name", name, "error", err)
+		http.Error(w, "Failed to activate instance: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	app.Events.Publish(events.InstanceActivated, map[string]interface{}{
+		"instance":       name,
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "activated",
+		"active":         name,
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
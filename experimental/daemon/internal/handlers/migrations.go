@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"wild-cloud-central/internal/config"
+)
+
+// GetMigrationsHandler reports the config schema version on disk, the version
+// this daemon writes, and the migrations applied when the daemon started
+func (app *App) GetMigrationsHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := app.readConfigDocument()
+	if err != nil {
+		slog.Error("Failed to load config file", "error", err)
+		http.Error(w, "Configuration file cannot be read: "+err.Error(), http.StatusConflict)
+		return
+	}
+	fileVersion, err := config.DocumentVersion(doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	applied := app.Migrations
+	if applied == nil {
+		applied = []config.AppliedMigration{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"fileVersion":    fileVersion,
+		"currentVersion": config.CurrentVersion(),
+		"migrations":     config.Migrations(),
+		"applied":        applied,
+	})
+}
@@ -5,21 +5,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+
+	"wild-cloud-central/internal/config"
 )
 
 // DownloadPXEAssetsHandler handles requests to download PXE boot assets
 func (app *App) DownloadPXEAssetsHandler(w http.ResponseWriter, r *http.Request) {
-	if app.Config == nil || app.Config.IsEmpty() {
+	cfg := app.CurrentConfig()
+	if cfg.IsEmpty() {
 		http.Error(w, "No configuration available. Please configure the system first.", http.StatusPreconditionFailed)
 		return
 	}
 
-	if err := app.downloadTalosAssets(); err != nil {
-		log.Printf("Failed to download PXE assets: %v", err)
+	if err := app.downloadTalosAssets(cfg); err != nil {
+		slog.Error("Failed to download PXE assets", "error", err)
 		http.Error(w, "Failed to download PXE assets", http.StatusInternalServerError)
 		return
 	}
@@ -29,12 +32,12 @@ func (app *App) DownloadPXEAssetsHandler(w http.ResponseWriter, r *http.Request)
 }
 
 // downloadTalosAssets downloads Talos Linux PXE assets
-func (app *App) downloadTalosAssets() error {
+func (app *App) downloadTalosAssets(cfg *config.Config) error {
 	// Get assets directory from data paths
 	paths := app.DataManager.GetPaths()
 	assetsDir := filepath.Join(paths.AssetsDir, "talos")
 	
-	log.Printf("Downloading Talos assets to: %s", assetsDir)
+	slog.Info("Downloading Talos assets", "dir", assetsDir)
 	if err := os.MkdirAll(filepath.Join(assetsDir, "amd64"), 0755); err != nil {
 		return fmt.Errorf("creating assets directory: %w", err)
 	}
@@ -65,18 +68,18 @@ func (app *App) downloadTalosAssets() error {
 		return fmt.Errorf("decoding schematic response: %w", err)
 	}
 
-	log.Printf("Created Talos schematic with ID: %s", schematic.ID)
+	slog.Info("Created Talos schematic", "id", schematic.ID)
 
 	// Download kernel
 	kernelURL := fmt.Sprintf("https://pxe.factory.talos.dev/image/%s/%s/kernel-amd64",
-		schematic.ID, app.Config.Cluster.Nodes.Talos.Version)
+		schematic.ID, cfg.Cluster.Nodes.Talos.Version)
 	if err := downloadFile(kernelURL, filepath.Join(assetsDir, "amd64", "vmlinuz")); err != nil {
 		return fmt.Errorf("downloading kernel: %w", err)
 	}
 
 	// Download initramfs
 	initramfsURL := fmt.Sprintf("https://pxe.factory.talos.dev/image/%s/%s/initramfs-amd64.xz",
-		schematic.ID, app.Config.Cluster.Nodes.Talos.Version)
+		schematic.ID, cfg.Cluster.Nodes.Talos.Version)
 	if err := downloadFile(initramfsURL, filepath.Join(assetsDir, "amd64", "initramfs.xz")); err != nil {
 		return fmt.Errorf("downloading initramfs: %w", err)
 	}
@@ -87,7 +90,7 @@ imgfree
 kernel http://%s/amd64/vmlinuz talos.platform=metal console=tty0 init_on_alloc=1 slab_nomerge pti=on consoleblank=0 nvme_core.io_timeout=4294967295 printk.devkmsg=on ima_template=ima-ng ima_appraise=fix ima_hash=sha512 selinux=1 net.ifnames=0
 initrd http://%s/amd64/initramfs.xz
 boot
-`, app.Config.Cloud.DNS.IP, app.Config.Cloud.DNS.IP)
+`, cfg.Cloud.DNS.IP, cfg.Cloud.DNS.IP)
 
 	if err := os.WriteFile(filepath.Join(assetsDir, "boot.ipxe"), []byte(bootScript), 0644); err != nil {
 		return fmt.Errorf("writing boot script: %w", err)
@@ -111,7 +114,7 @@ boot
 		}
 	}
 
-	log.Printf("Successfully downloaded PXE assets")
+	slog.Info("Successfully downloaded PXE assets")
 	return nil
 }
 
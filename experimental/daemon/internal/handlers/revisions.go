@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/diff"
+)
+
+// ListRevisionsHandler lists all recorded config revisions
+func (app *App) ListRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	revisions, err := app.Revisions.List()
+	if err != nil {
+		slog.Error("Failed to list config revisions", "error", err)
+		http.Error(w, "Failed to list config revisions", http.StatusInternalServerError)
+		return
+	}
+	if revisions == nil {
+		revisions = []config.Revision{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revisions": revisions})
+}
+
+// GetRevisionHandler returns a single revision with its config content
+func (app *App) GetRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	revision, content, ok := app.loadRevision(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	content, err := app.redactYAML(content)
+	if err != nil {
+		writeSecretsError(w, err, "Failed to read revision")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"revision": revision,
+		"content":  string(content),
+	})
+}
+
+// DiffRevisionsHandler returns a unified diff between two revisions. The
+// "to" revision defaults to the latest one.
+func (app *App) DiffRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	toID := query.Get("to")
+	if toID == "" {
+		revisions, err := app.Revisions.List()
+		if err != nil {
+			slog.Error("Failed to list config revisions", "error", err)
+			http.Error(w, "Failed to list config revisions", http.StatusInternalServerError)
+			return
+		}
+		if len(revisions) == 0 {
+			http.Error(w, "No revisions recorded", http.StatusNotFound)
+			return
+		}
+		toID = strconv.Itoa(revisions[len(revisions)-1].ID)
+	}
+
+	from, fromContent, ok := app.loadRevision(w, query.Get("from"))
+	if !ok {
+		return
+	}
+	to, toContent, ok := app.loadRevision(w, toID)
+	if !ok {
+		return
+	}
+
+	// Secrets must not leak through diffs either
+	fromContent, err := app.redactYAML(fromContent)
+	if err == nil {
+		toContent, err = app.redactYAML(toContent)
+	}
+	if err != nil {
+		writeSecretsError(w, err, "Failed to read revisions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(diff.Unified(
+		fmt.Sprintf("revision %d", from.ID),
+		fmt.Sprintf("revision %d", to.ID),
+		string(fromContent),
+		string(toContent),
+	)))
+}
+
+// RollbackRevisionHandler restores the config file from a revision and
+// regenerates the dnsmasq config
+func (app *App) RollbackRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
+	revision, content, ok := app.loadRevision(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	newConfig, err := config.Parse(content)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Revision %d cannot be parsed: %v", revision.ID, err), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := newConfig.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	paths := app.DataManager.GetPaths()
+	if err := config.WriteFile(paths.ConfigFile, content); err != nil {
+		slog.Error("Failed to write config file", "error", err)
+		http.Error(w, "Failed to write configuration file", http.StatusInternalServerError)
+		return
+	}
+	app.recordRevision(r, fmt.Sprintf("rollback to revision %d", revision.ID))
+	app.setConfigETag(w)
+
+	app.SetConfig(newConfig)
+
+	if _, err := app.updateDnsmasq(r, app.CurrentConfig()); err != nil {
+		writeDnsmasqError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "rolled_back", "revision": revision.ID})
+}
+
+// loadRevision looks up a revision by its textual ID, writing an error
+// response and returning false if it cannot be loaded
+func (app *App) loadRevision(w http.ResponseWriter, idParam string) (*config.Revision, []byte, bool) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	revision, content, err := app.Revisions.Get(id)
+	if errors.Is(err, config.ErrRevisionNotFound) {
+		http.Error(w, fmt.Sprintf("Revision %d not found", id), http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to read revision", "revision", id, "error", err)
+		http.Error(w, "Failed to read revision", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return revision, content, true
+}
+
+// recordRevision stores the config file as it is now on disk, attributing
+// the change to the endpoint that handled r
+func (app *App) recordRevision(r *http.Request, summary string) {
+	app.RecordRevision(r.Method+" "+r.URL.Path, summary)
+}
+
+// RecordRevision stores the config file as it is now on disk. Failures are
+// logged rather than returned because the change itself already succeeded.
+func (app *App) RecordRevision(source, summary string) {
+	content, err := os.ReadFile(app.DataManager.GetPaths().ConfigFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			app.logger().Error("Failed to read config for revision history", "error", err)
+		}
+		return
+	}
+
+	// Our own writes are not external changes for the watcher to reload
+	if app.Watcher != nil {
+		app.Watcher.Acknowledge(content)
+	}
+	if app.Revisions == nil {
+		return
+	}
+
+	revision, err := app.Revisions.Record(content, source, summary)
+	if err != nil {
+		app.logger().Error("Failed to record config revision", "error", err)
+		return
+	}
+	app.logger().Info("Config revision recorded", "revision", revision.ID, "source", revision.Source, "summary", revision.Summary)
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/secrets"
+)
+
+// ListSecretsHandler lists the paths of all stored secrets without their values
+func (app *App) ListSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	paths, err := app.Secrets.Paths()
+	if err != nil {
+		writeSecretsError(w, err, "Failed to read secrets")
+		return
+	}
+	if paths == nil {
+		paths = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"paths": paths})
+}
+
+// GetSecretHandler returns the value stored at a dotted secret path
+func (app *App) GetSecretHandler(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+
+	value, err := app.Secrets.Get(path)
+	if errors.Is(err, secrets.ErrNotFound) {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeSecretsError(w, err, "Failed to read secret "+path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"path": path, "value": value})
+}
+
+// SetSecretHandler stores a value at a dotted secret path
+func (app *App) SetSecretHandler(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+
+	var body struct {
+		Value interface{} `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if body.Value == nil {
+		http.Error(w, "A value is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Secrets.Set(path, body.Value); err != nil {
+		writeSecretsError(w, err, "Failed to save secret "+path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "updated", "path": path})
+}
+
+// DeleteSecretHandler removes the value stored at a dotted secret path
+func (app *App) DeleteSecretHandler(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+
+	err := app.Secrets.Delete(path)
+	if errors.Is(err, secrets.ErrNotFound) {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeSecretsError(w, err, "Failed to delete secret "+path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "path": path})
+}
+
+// UnlockSecretsHandler unlocks encrypted secrets with a passphrase. With an
+// empty passphrase the configured key file is used.
+func (app *App) UnlockSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	passphrase := body.Passphrase
+	if passphrase == "" {
+		keyFile := ""
+		if app.Settings != nil {
+			keyFile = app.Settings.SecretsKeyFile.Value
+		}
+		if keyFile == "" {
+			http.Error(w, "A passphrase is required", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if passphrase, err = secrets.ReadKeyFile(keyFile); err != nil {
+			slog.Error("Failed to read secrets key file", "error", err)
+			http.Error(w, "Failed to read secrets key file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := app.Secrets.Unlock(passphrase)
+	if errors.Is(err, secrets.ErrNotEncrypted) {
+		http.Error(w, "Secrets are not encrypted", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, secrets.ErrDecrypt) {
+		http.Error(w, "Wrong passphrase", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to unlock secrets", "error", err)
+		http.Error(w, "Failed to unlock secrets", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Secrets unlocked")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.Secrets.State())
+}
+
+// LockSecretsHandler forgets the secrets key until they are unlocked again
+func (app *App) LockSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.Secrets.Lock(); errors.Is(err, secrets.ErrNotEncrypted) {
+		http.Error(w, "Secrets are not encrypted", http.StatusConflict)
+		return
+	}
+
+	slog.Info("Secrets locked")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.Secrets.State())
+}
+
+// RotateSecretsKeyHandler re-encrypts all secrets with a new passphrase.
+// On plaintext secrets this turns encryption on.
+func (app *App) RotateSecretsKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		NewPassphrase string `json:"newPassphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if body.NewPassphrase == "" {
+		http.Error(w, "newPassphrase is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Secrets.Rotate(body.NewPassphrase); err != nil {
+		writeSecretsError(w, err, "Failed to rotate secrets key")
+		return
+	}
+
+	slog.Info("Secrets re-encrypted with a new key")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.Secrets.State())
+}
+
+// writeSecretsError reports a failed secrets operation, telling the client
+// to unlock the secrets if that is why it failed
+func writeSecretsError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, secrets.ErrLocked) {
+		http.Error(w, "Secrets are locked. Unlock them with POST /api/v1/secrets/unlock.", http.StatusLocked)
+		return
+	}
+	slog.Error(message, "error", err)
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// redactConfig converts cfg into a generic value with all secrets hidden
+func (app *App) redactConfig(cfg *config.Config) (interface{}, error) {
+	redactor, err := app.Secrets.Redactor()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := toGeneric(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return redactor.RedactValue(value), nil
+}
+
+// redactYAML hides all secrets in a raw YAML document
+func (app *App) redactYAML(content []byte) ([]byte, error) {
+	redactor, err := app.Secrets.Redactor()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if !redactor.RedactNode(&doc) {
+		return content, nil
+	}
+	return config.EncodeDocument(&doc)
+}
+
+// restoreRedactedConfig puts back secret values in newConfig that a client
+// echoed as placeholders from a redacted response
+func restoreRedactedConfig(newConfig, current *config.Config) error {
+	if current == nil {
+		return nil
+	}
+
+	value, err := toGeneric(newConfig)
+	if err != nil {
+		return err
+	}
+	previous, err := toGeneric(current)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(secrets.RestoreValue(value, previous))
+	if err != nil {
+		return err
+	}
+	*newConfig = config.Config{}
+	return json.Unmarshal(data, newConfig)
+}
+
+// toGeneric round-trips v through JSON into maps and slices
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
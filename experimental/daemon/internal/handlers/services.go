@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wild-cloud-central/internal/service"
+)
+
+// serviceTimeout bounds a single service manager action
+const serviceTimeout = 30 * time.Second
+
+// servicesResponse lists the managed services and their states
+type servicesResponse struct {
+	Manager  string           `json:"manager"`
+	Services []service.Status `json:"services"`
+}
+
+// ListServicesHandler handles requests for the state of every managed service
+func (app *App) ListServicesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), serviceTimeout)
+	defer cancel()
+
+	response := servicesResponse{Manager: app.Services.Kind(), Services: []service.Status{}}
+	for _, name := range app.Services.Services() {
+		status, err := app.Services.Status(ctx, name)
+		if err != nil {
+			slog.Error("Failed to get service status", "service", name, "error", err)
+			status = service.Status{Name: name, State: service.StateUnknown, Detail: err.Error()}
+		}
+		response.Services = append(response.Services, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetServiceHandler handles requests for the state of one service
+func (app *App) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), serviceTimeout)
+	defer cancel()
+
+	status, err := app.Services.Status(ctx, mux.Vars(r)["name"])
+	if err != nil {
+		writeServiceError(w, "get status of", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// ServiceActionHandler handles requests to start, stop or restart a service.
+// Restarting dnsmasq goes through the dnsmasq manager so a config it fails
+// to start with is rolled back.
+func (app *App) ServiceActionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name, action := vars["name"], vars["action"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), serviceTimeout)
+	defer cancel()
+
+	var err error
+	switch action {
+	case "start":
+		err = app.Services.Start(ctx, name)
+	case "stop":
+		err = app.Services.Stop(ctx, name)
+	case "restart":
+		if name == service.Dnsmasq {
+			// Check that dnsmasq comes back and roll back its config if not,
+			// as /dnsmasq/restart does
+			err = app.DnsmasqManager.RestartService(app.DataManager.GetPaths().DnsmasqConf)
+			break
+		}
+		err = app.Services.Restart(ctx, name)
+	default:
+		http.Error(w, "Unknown action: "+action, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, action, err)
+		return
+	}
+
+	status, err := app.Services.Status(ctx, name)
+	if err != nil {
+		writeServiceError(w, "get status of", err)
+		return
+	}
+	slog.Info("Service "+action, "service", name, "state", status.State)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// writeServiceError responds to a failed service manager call
+func writeServiceError(w http.ResponseWriter, action string, err error) {
+	if errors.Is(err, service.ErrUnknownService) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	slog.Error("Failed to "+action+" service", "error", err)
+	http.Error(w, "Failed to "+action+" service: "+err.Error(), http.StatusInternalServerError)
+}
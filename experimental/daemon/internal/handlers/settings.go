@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"wild-cloud-central/internal/settings"
+)
+
+// GetSettingsHandler reports the effective daemon settings and where each
+// value came from
+func (app *App) GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var list []settings.Setting
+	if app.Settings != nil {
+		list = app.Settings.List()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"precedence": settings.Precedence,
+		"settings":   list,
+	})
+}
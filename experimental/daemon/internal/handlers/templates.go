@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wild-cloud-central/internal/templates"
+	"wild-cloud-central/internal/yamlpath"
+)
+
+// RenderTemplateRequest is the body of a template render request. Either
+// Template or SourceDir must be set. SourceDir and DestDir must lie inside
+// the wild-cloud repository or the data directory; relative paths are taken
+// from the repository if one is configured. Clean is only allowed with the
+// default destination, <sourceDir>_compiled.
+type RenderTemplateRequest struct {
+	Name      string `json:"name"`
+	Template  string `json:"template"`
+	SourceDir string `json:"sourceDir"`
+	DestDir   string `json:"destDir"`
+	Clean     bool   `json:"clean"`
+}
+
+// RenderTemplateHandler renders a template string, or a whole directory of
+// templates, against the current config and secrets
+func (app *App) RenderTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var req RenderTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if (req.Template == "") == (req.SourceDir == "") {
+		http.Error(w, "Exactly one of template or sourceDir is required", http.StatusBadRequest)
+		return
+	}
+
+	renderer, err := app.templateRenderer()
+	if err != nil {
+		writeSecretsError(w, err, "Failed to load config and secrets")
+		return
+	}
+
+	var response map[string]interface{}
+	if req.Template != "" {
+		name := req.Name
+		if name == "" {
+			name = "template"
+		}
+		output, err := renderer.Render(name, req.Template)
+		if err != nil {
+			writeRenderError(w, err)
+			return
+		}
+		response = map[string]interface{}{"output": output}
+	} else {
+		roots := app.templateRoots()
+		sourceDir, err := resolveTemplateDir(req.SourceDir, roots)
+		if err != nil {
+			http.Error(w, "Invalid sourceDir: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defaultDest := sourceDir + "_compiled"
+		destDir := defaultDest
+		if req.DestDir != "" {
+			if destDir, err = resolveTemplateDir(req.DestDir, roots); err != nil {
+				http.Error(w, "Invalid destDir: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Clean && destDir != defaultDest {
+			http.Error(w, "clean is only allowed with the default destination "+defaultDest, http.StatusBadRequest)
+			return
+		}
+		if destDir == sourceDir || isWithin(sourceDir, destDir) || isWithin(destDir, sourceDir) {
+			http.Error(w, "destDir must not overlap sourceDir", http.StatusBadRequest)
+			return
+		}
+
+		files, err := renderer.RenderDir(sourceDir, destDir, req.Clean)
+		if err != nil {
+			writeRenderError(w, err)
+			return
+		}
+		response = map[string]interface{}{"destDir": destDir, "files": files}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// templateRoots returns the directories templates may be read from and
+// rendered into: the wild-cloud repository, if configured, and the data
+// directory
+func (app *App) templateRoots() []string {
+	var roots []string
+	if cfg := app.CurrentConfig(); cfg != nil && cfg.Wildcloud.Repository != "" {
+		roots = append(roots, cfg.Wildcloud.Repository)
+	}
+	return append(roots, app.DataManager.GetPaths().DataDir)
+}
+
+// resolveTemplateDir resolves dir, relative to the first root unless it is
+// absolute, following symlinks. The result must lie strictly inside one of
+// roots so a request can neither read nor write anywhere else.
+func resolveTemplateDir(dir string, roots []string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(roots[0], dir)
+	}
+	resolved, err := evalExisting(filepath.Clean(dir))
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		root, err := evalExisting(filepath.Clean(root))
+		if err == nil && isWithin(root, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the wild-cloud repository and the data directory", dir)
+}
+
+// evalExisting resolves the symlinks in path. Components that do not exist
+// yet are appended unchanged to the resolved existing part.
+func evalExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// isWithin reports whether path lies strictly inside dir
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// templateRenderer builds a renderer from the full config file, including
+// keys the daemon does not model, and the secrets
+func (app *App) templateRenderer() (*templates.Renderer, error) {
+	doc, err := app.readConfigDocument()
+	if err != nil {
+		return nil, err
+	}
+	value, err := yamlpath.ToValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _ := value.(map[string]interface{})
+
+	secretValues, err := app.Secrets.Load()
+	if err != nil {
+		return nil, err
+	}
+	return templates.NewRenderer(cfg, secretValues), nil
+}
+
+// writeRenderError reports a template failure, with its location when known
+func writeRenderError(w http.ResponseWriter, err error) {
+	var renderErr *templates.RenderError
+	if !errors.As(err, &renderErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   renderErr.Error(),
+		"details": renderErr,
+	})
+}
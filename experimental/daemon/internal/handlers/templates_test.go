@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		dir, path string
+		want      bool
+	}{
+		{"/repo", "/repo/setup", true},
+		{"/repo", "/repo/setup/cluster", true},
+		{"/repo", "/repo", false},
+		{"/repo", "/", false},
+		{"/repo", "/repo-other/setup", false},
+		{"/repo", "/repo/../etc", false},
+		{"/repo", "/repo/..foo", true},
+	}
+	for _, tt := range tests {
+		if got := isWithin(tt.dir, tt.path); got != tt.want {
+			t.Errorf("isWithin(%q, %q) = %v, want %v", tt.dir, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestResolveTemplateDir(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(base, "repo")
+	data := filepath.Join(base, "data")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(repo, "setup"), data, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(repo, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(repo, "setup"), filepath.Join(data, "setup-link")); err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{repo, data}
+
+	allowed := map[string]string{
+		"setup":                                filepath.Join(repo, "setup"),
+		"setup/cluster":                        filepath.Join(repo, "setup", "cluster"),
+		"setup/../setup":                       filepath.Join(repo, "setup"),
+		filepath.Join(data, "apps"):            filepath.Join(data, "apps"),
+		filepath.Join(data, "setup-link"):      filepath.Join(repo, "setup"),
+		filepath.Join(data, "setup-link", "x"): filepath.Join(repo, "setup", "x"),
+	}
+	for dir, want := range allowed {
+		got, err := resolveTemplateDir(dir, roots)
+		if err != nil {
+			t.Errorf("resolveTemplateDir(%q): %v", dir, err)
+		} else if got != want {
+			t.Errorf("resolveTemplateDir(%q) = %q, want %q", dir, got, want)
+		}
+	}
+
+	rejected := []string{
+		"",
+		".",
+		"..",
+		"../outside",
+		"setup/../../outside",
+		"escape",
+		"escape/setup",
+		"escape/missing/dir",
+		data,
+		outside,
+		"/etc",
+	}
+	for _, dir := range rejected {
+		if got, err := resolveTemplateDir(dir, roots); err == nil {
+			t.Errorf("resolveTemplateDir(%q) = %q, want an error", dir, got)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"wild-cloud-central/internal/tftp"
+)
+
+// tftpResponse describes the embedded TFTP server and its recent transfers
+type tftpResponse struct {
+	Listening string          `json:"listening"`
+	Root      string          `json:"root"`
+	Transfers []tftp.Transfer `json:"transfers"`
+}
+
+// GetTFTPHandler handles requests for the state of the embedded TFTP server.
+// Listening is empty when the server is disabled.
+func (app *App) GetTFTPHandler(w http.ResponseWriter, r *http.Request) {
+	response := tftpResponse{
+		Listening: app.TFTP.Addr(),
+		Root:      app.TFTP.Root(),
+		Transfers: app.TFTP.Transfers(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/yamlpath"
+)
+
+// GetConfigValueHandler returns the value at a dotted config path, like
+// wild-config
+func (app *App) GetConfigValueHandler(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+
+	doc, ok := app.loadConfigDocument(w)
+	if !ok {
+		return
+	}
+
+	node, resolved, err := yamlpath.Get(doc, path)
+	if errors.Is(err, yamlpath.ErrNotFound) {
+		http.Error(w, "Key path '"+path+"' not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value, err := yamlpath.ToValue(node)
+	if err != nil {
+		slog.Error("Failed to decode config value", "path", path, "error", err)
+		http.Error(w, "Failed to read config value", http.StatusInternalServerError)
+		return
+	}
+
+	// Never hand secret values to the UI
+	redactor, err := app.Secrets.Redactor()
+	if err != nil {
+		writeSecretsError(w, err, "Failed to read secrets")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":  strings.Join(resolved, "."),
+		"value": redactor.RedactValueAt(value, strings.Join(resolved, ".")),
+	})
+}
+
+// SetConfigValueHandler stores a value at a dotted config path, creating
+// intermediate maps as needed, like wild-config-set
+func (app *App) SetConfigValueHandler(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
+	var body struct {
+		Value interface{} `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if body.Value == nil {
+		http.Error(w, "A value is required. Use DELETE to remove a key.", http.StatusBadRequest)
+		return
+	}
+
+	node, err := yamlpath.FromValue(body.Value)
+	if err != nil {
+		http.Error(w, "Invalid value: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc, ok := app.loadConfigDocument(w)
+	if !ok {
+		return
+	}
+
+	resolved, err := yamlpath.Set(doc, path, node)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dnsmasqUpdated, ok := app.commitConfigDocument(w, r, doc)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "updated",
+		"path":           strings.Join(resolved, "."),
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
+
+// DeleteConfigValueHandler removes the value at a dotted config path
+func (app *App) DeleteConfigValueHandler(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+	if !app.checkIfMatch(w, r) {
+		return
+	}
+
+	doc, ok := app.loadConfigDocument(w)
+	if !ok {
+		return
+	}
+
+	resolved, err := yamlpath.Delete(doc, path)
+	if errors.Is(err, yamlpath.ErrNotFound) {
+		http.Error(w, "Key path '"+path+"' not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dnsmasqUpdated, ok := app.commitConfigDocument(w, r, doc)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "deleted",
+		"path":           strings.Join(resolved, "."),
+		"dnsmasqUpdated": dnsmasqUpdated,
+	})
+}
+
+// loadConfigDocument reads the config file as a YAML document, writing an
+// error response and returning false if it cannot be read
+func (app *App) loadConfigDocument(w http.ResponseWriter) (*yaml.Node, bool) {
+	doc, err := app.readConfigDocument()
+	if err != nil {
+		slog.Error("Failed to load config file", "error", err)
+		http.Error(w, "Configuration file cannot be read: "+err.Error(), http.StatusConflict)
+		return nil, false
+	}
+	return doc, true
+}
+
+// readConfigDocument reads the config file as a YAML document, starting
+// from an empty one if the file does not exist yet
+func (app *App) readConfigDocument() (*yaml.Node, error) {
+	content, err := os.ReadFile(app.DataManager.GetPaths().ConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return config.ParseDocument(content)
+}
+
+// commitConfigDocument validates an edited config document, writes it to
+// disk, records a revision and regenerates dnsmasq if its output changed.
+// It writes an error response and returns false if any step fails.
+func (app *App) commitConfigDocument(w http.ResponseWriter, r *http.Request, doc *yaml.Node) (bool, bool) {
+	content, err := config.EncodeDocument(doc)
+	if err != nil {
+		slog.Error("Failed to encode config", "error", err)
+		http.Error(w, "Failed to encode configuration", http.StatusInternalServerError)
+		return false, false
+	}
+
+	newConfig, err := config.Parse(content)
+	if err != nil {
+		http.Error(w, "Invalid configuration: "+err.Error(), http.StatusUnprocessableEntity)
+		return false, false
+	}
+	if err := newConfig.Validate(); err != nil {
+		writeValidationError(w, err)
+		return false, false
+	}
+
+	paths := app.DataManager.GetPaths()
+	if err := config.WriteFile(paths.ConfigFile, content); err != nil {
+		slog.Error("Failed to write config file", "error", err)
+		http.Error(w, "Failed to write configuration file", http.StatusInternalServerError)
+		return false, false
+	}
+	app.recordRevision(r, "")
+	app.setConfigETag(w)
+
+	oldConfig := app.CurrentConfig()
+	app.SetConfig(newConfig)
+
+	// Only touch dnsmasq when the generated config actually differs
+	if newConfig.IsEmpty() || !app.dnsmasqChanged(oldConfig, newConfig) {
+		return false, true
+	}
+	dnsmasqUpdated, err := app.updateDnsmasq(r, newConfig)
+	if err != nil {
+		writeDnsmasqError(w, err)
+		return false, false
+	}
+	return dnsmasqUpdated, true
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"wild-cloud-central/internal/config"
+)
+
+// GetConfigWarningsHandler lists settings that do not fit together, such as
+// a DHCP range in proxy DHCP mode. Unlike validation errors they do not stop
+// the config from being saved.
+func (app *App) GetConfigWarningsHandler(w http.ResponseWriter, r *http.Request) {
+	warnings := []config.FieldError{}
+	if cfg := app.CurrentConfig(); !cfg.IsEmpty() {
+		warnings = append(warnings, cfg.Warnings()...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"warnings": warnings,
+	})
+}
+
+// logConfigWarnings logs the warnings for cfg
+func (app *App) logConfigWarnings(cfg *config.Config) {
+	if cfg.IsEmpty() {
+		return
+	}
+	for _, warning := range cfg.Warnings() {
+		app.logger().Warn("Config warning", "field", warning.Field, "message", warning.Message)
+	}
+}
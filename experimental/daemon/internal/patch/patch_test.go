@@ -0,0 +1,212 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual reports whether two JSON documents hold the same value
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("parsing %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("parsing %s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"/a","value":2}]`,
+			want:  `{"a":2}`,
+		},
+		{
+			name:  "replace with null",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"/a","value":null}]`,
+			want:  `{"a":null}`,
+		},
+		{
+			name:  "add null",
+			doc:   `{}`,
+			patch: `[{"op":"add","path":"/a","value":null}]`,
+			want:  `{"a":null}`,
+		},
+		{
+			name:  "test null",
+			doc:   `{"a":null}`,
+			patch: `[{"op":"test","path":"/a","value":null},{"op":"add","path":"/b","value":true}]`,
+			want:  `{"a":null,"b":true}`,
+		},
+		{
+			name:  "add to a nested map",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"add","path":"/a/c","value":{"d":[1]}}]`,
+			want:  `{"a":{"b":1,"c":{"d":[1]}}}`,
+		},
+		{
+			name:  "escaped slash and tilde",
+			doc:   `{"a/b":1,"c~d":2}`,
+			patch: `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/c~0d"}]`,
+			want:  `{"a/b":3}`,
+		},
+		{
+			name:  "~01 unescapes to ~1, not /",
+			doc:   `{"~1":1}`,
+			patch: `[{"op":"replace","path":"/~01","value":2}]`,
+			want:  `{"~1":2}`,
+		},
+		{
+			name:  "append with -",
+			doc:   `{"a":[1,2]}`,
+			patch: `[{"op":"add","path":"/a/-","value":3}]`,
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:  "insert into an array",
+			doc:   `{"a":[1,3]}`,
+			patch: `[{"op":"add","path":"/a/1","value":2},{"op":"add","path":"/a/0","value":0}]`,
+			want:  `{"a":[0,1,2,3]}`,
+		},
+		{
+			name:  "remove from an array",
+			doc:   `{"a":[1,2,3]}`,
+			patch: `[{"op":"remove","path":"/a/1"}]`,
+			want:  `{"a":[1,3]}`,
+		},
+		{
+			name:  "move",
+			doc:   `{"a":{"b":1},"c":{}}`,
+			patch: `[{"op":"move","from":"/a/b","path":"/c/d"}]`,
+			want:  `{"a":{},"c":{"d":1}}`,
+		},
+		{
+			name:  "move within an array",
+			doc:   `{"a":[1,2,3]}`,
+			patch: `[{"op":"move","from":"/a/0","path":"/a/-"}]`,
+			want:  `{"a":[2,3,1]}`,
+		},
+		{
+			name:  "copy is independent of its source",
+			doc:   `{"a":{"b":[1]}}`,
+			patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`,
+			want:  `{"a":{"b":[1]},"c":{"b":[1,2]}}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"","value":{"b":2}}]`,
+			want:  `{"b":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("JSONPatch: %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		patch      string
+		testFailed bool
+	}{
+		{name: "test mismatch", doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":2}]`, testFailed: true},
+		{name: "test null against a value", doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":null}]`, testFailed: true},
+		{name: "missing value", doc: `{"a":1}`, patch: `[{"op":"replace","path":"/a"}]`},
+		{name: "replace a missing key", doc: `{}`, patch: `[{"op":"replace","path":"/a","value":1}]`},
+		{name: "remove a missing key", doc: `{}`, patch: `[{"op":"remove","path":"/a"}]`},
+		{name: "add under a missing parent", doc: `{}`, patch: `[{"op":"add","path":"/a/b","value":1}]`},
+		{name: "index past the end", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/2","value":1}]`},
+		{name: "leading zero index", doc: `{"a":[1,2]}`, patch: `[{"op":"remove","path":"/a/01"}]`},
+		{name: "- outside add", doc: `{"a":[1]}`, patch: `[{"op":"remove","path":"/a/-"}]`},
+		{name: "move into a child", doc: `{"a":{"b":{}}}`, patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`},
+		{name: "pointer without slash", doc: `{"a":1}`, patch: `[{"op":"remove","path":"a"}]`},
+		{name: "unknown op", doc: `{}`, patch: `[{"op":"merge","path":"/a","value":1}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := JSONPatch([]byte(tt.doc), []byte(tt.patch))
+			if err == nil {
+				t.Fatal("patch applied, want an error")
+			}
+			if got := errors.Is(err, ErrTestFailed); got != tt.testFailed {
+				t.Errorf("errors.Is(err, ErrTestFailed) = %v, want %v (%v)", got, tt.testFailed, err)
+			}
+		})
+	}
+}
+
+func TestJSONPatchIsAtomic(t *testing.T) {
+	doc := []byte(`{"a":1}`)
+	_, err := JSONPatch(doc, []byte(`[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":3}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("err = %v, want ErrTestFailed", err)
+	}
+	if string(doc) != `{"a":1}` {
+		t.Errorf("document changed to %s", doc)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Cases from RFC 7396 appendix A
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s): %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !jsonEqual(t, got, []byte(tt.want)) {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApplyUnsupportedType(t *testing.T) {
+	if _, err := Apply("application/json", []byte(`{}`), []byte(`{}`)); err == nil {
+		t.Error("applied a patch of an unsupported type")
+	}
+}
@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrDecrypt is returned when sealed data cannot be opened, either because
+// the passphrase is wrong or the data was tampered with
+var ErrDecrypt = errors.New("wrong passphrase or corrupted data")
+
+// sealMagic prefixes every sealed blob so the format can evolve
+var sealMagic = []byte("WCS1")
+
+// scrypt parameters for deriving AES-256 keys from passphrases
+const (
+	saltSize = 16
+	keySize  = 32
+	scryptN  = 1 << 15
+	scryptR  = 8
+	scryptP  = 1
+)
+
+// sealKey is an AES-256-GCM key derived from a passphrase and salt
+type sealKey struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+// Seal encrypts plaintext with AES-256-GCM using a key derived from
+// passphrase with scrypt. The random salt and nonce are stored in the output.
+func Seal(plaintext []byte, passphrase string) ([]byte, error) {
+	key, err := newSealKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return key.seal(plaintext)
+}
+
+// Open decrypts data produced by Seal
+func Open(sealed []byte, passphrase string) ([]byte, error) {
+	salt, err := saltOf(sealed)
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveSealKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return key.open(sealed)
+}
+
+// newSealKey derives a key from passphrase with a fresh random salt
+func newSealKey(passphrase string) (*sealKey, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+	return deriveSealKey(passphrase, salt)
+}
+
+// deriveSealKey stretches a passphrase into an AES-256 key
+func deriveSealKey(passphrase string, salt []byte) (*sealKey, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return &sealKey{salt: salt, aead: aead}, nil
+}
+
+// seal encrypts plaintext with a fresh nonce. The output is the magic, salt
+// and nonce followed by the ciphertext; the header is authenticated too.
+func (k *sealKey) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	header := append(append(append([]byte{}, sealMagic...), k.salt...), nonce...)
+	return k.aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// open decrypts data sealed with this key
+func (k *sealKey) open(sealed []byte) ([]byte, error) {
+	headerLen := len(sealMagic) + saltSize + k.aead.NonceSize()
+	if len(sealed) < headerLen || !bytes.HasPrefix(sealed, sealMagic) {
+		return nil, ErrDecrypt
+	}
+	if !bytes.Equal(sealed[len(sealMagic):len(sealMagic)+saltSize], k.salt) {
+		return nil, ErrDecrypt
+	}
+	nonce := sealed[len(sealMagic)+saltSize : headerLen]
+
+	plaintext, err := k.aead.Open(nil, nonce, sealed[headerLen:], sealed[:headerLen])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// saltOf returns the salt stored in sealed data
+func saltOf(sealed []byte) ([]byte, error) {
+	if len(sealed) < len(sealMagic)+saltSize || !bytes.HasPrefix(sealed, sealMagic) {
+		return nil, ErrDecrypt
+	}
+	return sealed[len(sealMagic) : len(sealMagic)+saltSize], nil
+}
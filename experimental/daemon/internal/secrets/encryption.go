@@ -0,0 +1,137 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ErrLocked is returned when encrypted secrets are used before unlocking
+var ErrLocked = errors.New("secrets are locked")
+
+// ErrNotEncrypted is returned when locking or unlocking plaintext secrets
+var ErrNotEncrypted = errors.New("secrets are not encrypted")
+
+// State describes whether the secrets are encrypted and currently usable
+type State struct {
+	Encrypted bool `json:"encrypted"`
+	Locked    bool `json:"locked"`
+}
+
+// State reports the encryption state of the store
+func (s *Store) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	encrypted := s.encrypted()
+	return State{Encrypted: encrypted, Locked: encrypted && s.key == nil}
+}
+
+// Unlock derives the key from passphrase and keeps it in memory until Lock
+// is called. The passphrase is checked by decrypting the secrets file.
+func (s *Store) Unlock(passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.encrypted() {
+		return ErrNotEncrypted
+	}
+	sealed, err := os.ReadFile(s.encryptedPath)
+	if err != nil {
+		return fmt.Errorf("reading secrets file %s: %w", s.encryptedPath, err)
+	}
+	salt, err := saltOf(sealed)
+	if err != nil {
+		return err
+	}
+	key, err := deriveSealKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	if _, err := key.open(sealed); err != nil {
+		return err
+	}
+	s.key = key
+	return nil
+}
+
+// Lock forgets the key so the secrets cannot be read until unlocked again
+func (s *Store) Lock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.encrypted() {
+		return ErrNotEncrypted
+	}
+	s.key = nil
+	return nil
+}
+
+// Rotate re-encrypts every secret with a key derived from newPassphrase and
+// a fresh salt. Rotating plaintext secrets enables encryption and removes
+// the plaintext file. Encrypted secrets must be unlocked first.
+func (s *Store) Rotate(newPassphrase string) error {
+	if newPassphrase == "" {
+		return fmt.Errorf("the new passphrase must not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load()
+	if err != nil {
+		return err
+	}
+	data, err := encode(doc)
+	if err != nil {
+		return err
+	}
+
+	key, err := newSealKey(newPassphrase)
+	if err != nil {
+		return err
+	}
+	sealed, err := key.seal(data)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(s.encryptedPath, sealed); err != nil {
+		return err
+	}
+	s.key = key
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing plaintext secrets file: %w", err)
+	}
+	return nil
+}
+
+// encrypted reports whether encryption is enabled; callers must hold s.mu
+func (s *Store) encrypted() bool {
+	_, err := os.Stat(s.encryptedPath)
+	return err == nil
+}
+
+// ReadKeyFile reads an unlock passphrase from a key file, ignoring
+// surrounding whitespace
+func ReadKeyFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("reading key file: %w", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		slog.Warn("Secrets key file is accessible by other users", "file", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading key file: %w", err)
+	}
+	passphrase := strings.TrimSpace(string(data))
+	if passphrase == "" {
+		return "", fmt.Errorf("key file %s is empty", path)
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,187 @@
+package secrets
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Placeholder replaces secret values in API responses
+const Placeholder = "[REDACTED]"
+
+// Redactor hides secret values in documents returned to clients
+type Redactor struct {
+	paths  map[string]bool
+	values map[string]bool
+}
+
+// Redactor builds a redactor from the current contents of the store. While
+// encrypted secrets are locked their values are unknown and it returns
+// ErrLocked, so callers refuse to answer instead of showing secrets.
+func (s *Store) Redactor() (*Redactor, error) {
+	r := &Redactor{
+		paths:  map[string]bool{},
+		values: map[string]bool{},
+	}
+
+	s.mu.Lock()
+	doc, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	walkNode(doc, "", func(path string, scalar *yaml.Node) {
+		r.paths[path] = true
+		if scalar.Value != "" && !isBool(scalar) {
+			r.values[scalar.Value] = true
+		}
+	})
+	return r, nil
+}
+
+// redacts reports whether the scalar at path must be hidden. Any value held
+// in the store is hidden wherever it appears, except for booleans, which are
+// only hidden at a secret's own path.
+func (r *Redactor) redacts(path, value string, boolean bool) bool {
+	return r.paths[path] || (!boolean && r.values[value])
+}
+
+// isBool reports whether a YAML scalar is a boolean
+func isBool(scalar *yaml.Node) bool {
+	return scalar.ShortTag() == "!!bool"
+}
+
+// RedactValue returns a copy of a decoded JSON or YAML value with secrets
+// replaced by Placeholder
+func (r *Redactor) RedactValue(value interface{}) interface{} {
+	return r.redactValue(value, "")
+}
+
+func (r *Redactor) redactValue(value interface{}, path string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = r.redactValue(item, joinPath(path, key))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = r.redactValue(item, fmt.Sprintf("%s[%d]", path, i))
+		}
+		return out
+	case nil:
+		return nil
+	default:
+		_, boolean := v.(bool)
+		if r.redacts(path, fmt.Sprint(v), boolean) {
+			return Placeholder
+		}
+		return v
+	}
+}
+
+// RedactValueAt is RedactValue for a value found at the given dotted path
+func (r *Redactor) RedactValueAt(value interface{}, path string) interface{} {
+	return r.redactValue(value, path)
+}
+
+// RedactNode replaces secret scalars in a YAML document in place and
+// reports whether anything was redacted
+func (r *Redactor) RedactNode(node *yaml.Node) bool {
+	redacted := false
+	walkNode(node, "", func(path string, scalar *yaml.Node) {
+		if r.redacts(path, scalar.Value, isBool(scalar)) {
+			scalar.Value = Placeholder
+			scalar.Tag = "!!str"
+			scalar.Style = 0
+			redacted = true
+		}
+	})
+	return redacted
+}
+
+// RestoreNode replaces Placeholder scalars in node with the value found at
+// the same path in previous, so a redacted document can be edited and saved
+// back without wiping the secrets it contained
+func RestoreNode(node, previous *yaml.Node) {
+	if previous == nil {
+		return
+	}
+
+	originals := map[string]*yaml.Node{}
+	walkNode(previous, "", func(path string, scalar *yaml.Node) {
+		originals[path] = scalar
+	})
+
+	walkNode(node, "", func(path string, scalar *yaml.Node) {
+		if scalar.Value != Placeholder {
+			return
+		}
+		if original, ok := originals[path]; ok {
+			scalar.Value = original.Value
+			scalar.Tag = original.Tag
+			scalar.Style = original.Style
+		}
+	})
+}
+
+// RestoreValue is the decoded-value counterpart of RestoreNode
+func RestoreValue(value, previous interface{}) interface{} {
+	if s, ok := value.(string); ok && s == Placeholder {
+		if previous != nil {
+			return previous
+		}
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		prev, _ := previous.(map[string]interface{})
+		for key, item := range v {
+			v[key] = RestoreValue(item, prev[key])
+		}
+	case []interface{}:
+		prev, _ := previous.([]interface{})
+		for i, item := range v {
+			var p interface{}
+			if i < len(prev) {
+				p = prev[i]
+			}
+			v[i] = RestoreValue(item, p)
+		}
+	}
+	return value
+}
+
+// walkNode calls fn for every scalar value in a YAML document with its
+// dotted path
+func walkNode(node *yaml.Node, path string, fn func(path string, scalar *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkNode(child, path, fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkNode(node.Content[i+1], joinPath(path, node.Content[i].Value), fn)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			walkNode(child, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case yaml.ScalarNode:
+		if path != "" {
+			fn(path, node)
+		}
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRedactor(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "secrets.yaml"))
+	secrets := map[string]interface{}{
+		"db.password":   "pw",
+		"smtp.port":     "25",
+		"feature.flag":  true,
+		"empty.value":   "",
+		"cloudflare.id": "abc123",
+	}
+	for path, value := range secrets {
+		if err := s.Set(path, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := s.Redactor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := map[string]interface{}{
+		"app": map[string]interface{}{
+			"password": "pw",
+			"port":     25,
+			"enabled":  true,
+			"name":     "",
+			"list":     []interface{}{"abc123", "public"},
+		},
+		"feature": map[string]interface{}{"flag": true},
+	}
+	want := map[string]interface{}{
+		"app": map[string]interface{}{
+			"password": Placeholder,
+			"port":     Placeholder,
+			"enabled":  true,
+			"name":     "",
+			"list":     []interface{}{Placeholder, "public"},
+		},
+		"feature": map[string]interface{}{"flag": Placeholder},
+	}
+	if got := r.RedactValue(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactValue = %v, want %v", got, want)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte("a: pw\nb: true\nc: \"\"\nd: 25\ne: public\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !r.RedactNode(&doc) {
+		t.Error("RedactNode redacted nothing")
+	}
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDoc := "a: '[REDACTED]'\nb: true\nc: \"\"\nd: '[REDACTED]'\ne: public\n"
+	if string(out) != wantDoc {
+		t.Errorf("RedactNode =\n%s\nwant\n%s", out, wantDoc)
+	}
+}
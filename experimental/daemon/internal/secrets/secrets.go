@@ -0,0 +1,287 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"wild-cloud-central/internal/yamlpath"
+)
+
+// ErrNotFound is returned when a secret path does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// Store manages the secrets.yaml file used by wild-secret and wild-secret-set.
+// Once encryption is enabled the secrets live in an encrypted file next to
+// it instead, and the store must be unlocked before they can be used.
+type Store struct {
+	path          string
+	encryptedPath string
+	mu            sync.Mutex
+
+	// key is set while an encrypted store is unlocked
+	key *sealKey
+}
+
+// NewStore creates a new secrets store backed by the file at path
+func NewStore(path string) *Store {
+	return &Store{path: path, encryptedPath: path + ".enc"}
+}
+
+// Path returns the location of the secrets file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// EncryptedPath returns the location of the encrypted secrets file
+func (s *Store) EncryptedPath() string {
+	return s.encryptedPath
+}
+
+// Load reads all secrets, returning an empty map if the file does not exist
+func (s *Store) Load() (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	secrets := map[string]interface{}{}
+	if err := doc.Decode(&secrets); err != nil {
+		return nil, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	return secrets, nil
+}
+
+// Get returns the value stored at the dotted path
+func (s *Store) Get(path string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	node, _, err := yamlpath.Get(doc, path)
+	if errors.Is(err, yamlpath.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return yamlpath.ToValue(node)
+}
+
+// Set stores value at the dotted path, creating intermediate maps as needed
+func (s *Store) Set(path string, value interface{}) error {
+	node, err := yamlpath.FromValue(value)
+	if err != nil {
+		return fmt.Errorf("encoding secret %s: %w", path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, err := yamlpath.Set(doc, path, node); err != nil {
+		return err
+	}
+	return s.save(doc)
+}
+
+// Delete removes the value stored at the dotted path
+func (s *Store) Delete(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	_, err = yamlpath.Delete(doc, path)
+	if errors.Is(err, yamlpath.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.save(doc)
+}
+
+// Paths returns the sorted dotted paths of every secret value
+func (s *Store) Paths() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	walkNode(doc, "", func(path string, _ *yaml.Node) {
+		paths = append(paths, path)
+	})
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Raw returns all secrets as a YAML document, or nil if there are none
+func (s *Store) Raw() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || len(doc.Content[0].Content) == 0 {
+		return nil, nil
+	}
+	return encode(doc)
+}
+
+// Replace overwrites every secret with the contents of a YAML document
+func (s *Store) Replace(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing secrets: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("secrets must be a YAML mapping")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(&doc)
+}
+
+// load reads the secrets document, returning an empty mapping if the file
+// does not exist; callers must hold s.mu
+func (s *Store) load() (*yaml.Node, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	return &doc, nil
+}
+
+// read returns the plaintext secrets file contents, decrypting them if
+// encryption is enabled; callers must hold s.mu
+func (s *Store) read() ([]byte, error) {
+	if !s.encrypted() {
+		data, err := os.ReadFile(s.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading secrets file %s: %w", s.path, err)
+		}
+		return data, nil
+	}
+
+	if s.key == nil {
+		return nil, ErrLocked
+	}
+	sealed, err := os.ReadFile(s.encryptedPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets file %s: %w", s.encryptedPath, err)
+	}
+	data, err := s.key.open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secrets file: %w", err)
+	}
+	return data, nil
+}
+
+// save writes the secrets document, encrypted if encryption is enabled;
+// callers must hold s.mu
+func (s *Store) save(doc *yaml.Node) error {
+	data, err := encode(doc)
+	if err != nil {
+		return err
+	}
+	if !s.encrypted() {
+		return writeFile(s.path, data)
+	}
+
+	if s.key == nil {
+		return ErrLocked
+	}
+	sealed, err := s.key.seal(data)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.encryptedPath, sealed)
+}
+
+// writeFile writes a secrets file atomically with owner-only permissions
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("creating secrets directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".secrets-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary secrets file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("setting secrets file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing secrets file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing secrets file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing secrets file: %w", err)
+	}
+	return nil
+}
+
+// encode renders the secrets document with a two-space indent
+func encode(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("marshaling secrets: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("marshaling secrets: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,219 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStore returns a plaintext store in a fresh directory holding one
+// secret
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s := NewStore(filepath.Join(t.TempDir(), "secrets.yaml"))
+	if err := s.Set("cloudflare.token", "s3cr3t-token"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	plaintext := []byte("cloudflare:\n  token: s3cr3t-token\n")
+	sealed, err := Seal(plaintext, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("s3cr3t")) {
+		t.Error("sealed data contains the plaintext")
+	}
+
+	opened, err := Open(sealed, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open = %q, want %q", opened, plaintext)
+	}
+
+	// Fresh salt and nonce every time
+	again, err := Seal(plaintext, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, sealed) {
+		t.Error("sealing twice gave the same output")
+	}
+}
+
+func TestOpenRejectsWrongPassphraseAndDamage(t *testing.T) {
+	sealed, err := Seal([]byte("token: s3cr3t-token\n"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Magic, salt and the 12-byte GCM nonce
+	headerLen := len(sealMagic) + saltSize + 12
+
+	flip := func(i int) []byte {
+		b := append([]byte{}, sealed...)
+		b[i] ^= 1
+		return b
+	}
+	tests := []struct {
+		name       string
+		sealed     []byte
+		passphrase string
+	}{
+		{"wrong passphrase", sealed, "wrong"},
+		{"empty", nil, "passphrase"},
+		{"magic only", sealed[:len(sealMagic)], "passphrase"},
+		{"header only", sealed[:headerLen], "passphrase"},
+		{"truncated ciphertext", sealed[:len(sealed)-1], "passphrase"},
+		{"tampered magic", flip(0), "passphrase"},
+		{"tampered salt", flip(len(sealMagic)), "passphrase"},
+		{"tampered nonce", flip(headerLen - 1), "passphrase"},
+		{"tampered ciphertext", flip(headerLen), "passphrase"},
+		{"tampered tag", flip(len(sealed) - 1), "passphrase"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(tt.sealed, tt.passphrase); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Open = %v, want ErrDecrypt", err)
+			}
+		})
+	}
+}
+
+func TestRotateEncryptsPlaintext(t *testing.T) {
+	s := newTestStore(t)
+	if state := s.State(); state.Encrypted || state.Locked {
+		t.Fatalf("new store state = %+v, want plaintext", state)
+	}
+
+	if err := s.Rotate("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if exists(s.Path()) {
+		t.Error("plaintext secrets file still exists")
+	}
+	if !exists(s.EncryptedPath()) {
+		t.Fatal("encrypted secrets file was not written")
+	}
+	if state := s.State(); !state.Encrypted || state.Locked {
+		t.Errorf("state = %+v, want encrypted and unlocked", state)
+	}
+
+	sealed, err := os.ReadFile(s.EncryptedPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("s3cr3t")) {
+		t.Error("encrypted file contains the secret")
+	}
+	if value, err := s.Get("cloudflare.token"); err != nil || value != "s3cr3t-token" {
+		t.Errorf("Get = %v (%v), want the secret", value, err)
+	}
+}
+
+func TestRotateRekeysEncryptedSecrets(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Rotate("first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rotate("second"); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := os.ReadFile(s.EncryptedPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(sealed, "first"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("old passphrase: Open = %v, want ErrDecrypt", err)
+	}
+	if _, err := Open(sealed, "second"); err != nil {
+		t.Errorf("new passphrase: Open = %v", err)
+	}
+
+	// Writes after a rotation use the new key
+	if err := s.Set("other", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unlock("first"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Unlock with the old passphrase = %v, want ErrDecrypt", err)
+	}
+	if err := s.Unlock("second"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if value, err := s.Get("other"); err != nil || value != "value" {
+		t.Errorf("Get = %v (%v), want the value set after rotating", value, err)
+	}
+}
+
+func TestRotateRequiresPassphrase(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Rotate(""); err == nil {
+		t.Error("rotated to an empty passphrase")
+	}
+	if exists(s.EncryptedPath()) {
+		t.Error("failed rotation wrote an encrypted file")
+	}
+}
+
+func TestLockedStore(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Rotate("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if state := s.State(); !state.Encrypted || !state.Locked {
+		t.Errorf("state = %+v, want encrypted and locked", state)
+	}
+
+	operations := map[string]func() error{
+		"Get":      func() error { _, err := s.Get("cloudflare.token"); return err },
+		"Set":      func() error { return s.Set("other", "value") },
+		"Delete":   func() error { return s.Delete("cloudflare.token") },
+		"Load":     func() error { _, err := s.Load(); return err },
+		"Raw":      func() error { _, err := s.Raw(); return err },
+		"Replace":  func() error { return s.Replace([]byte("other: value\n")) },
+		"Redactor": func() error { _, err := s.Redactor(); return err },
+		"Rotate":   func() error { return s.Rotate("new") },
+	}
+	for name, op := range operations {
+		if err := op(); !errors.Is(err, ErrLocked) {
+			t.Errorf("%s on a locked store = %v, want ErrLocked", name, err)
+		}
+	}
+
+	if err := s.Unlock("wrong"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Unlock with the wrong passphrase = %v, want ErrDecrypt", err)
+	}
+	if err := s.Unlock("passphrase"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if value, err := s.Get("cloudflare.token"); err != nil || value != "s3cr3t-token" {
+		t.Errorf("Get after unlocking = %v (%v), want the secret", value, err)
+	}
+}
+
+func TestLockPlaintextStore(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Lock(); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Lock = %v, want ErrNotEncrypted", err)
+	}
+	if err := s.Unlock("passphrase"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Unlock = %v, want ErrNotEncrypted", err)
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+)
+
+// None is a service manager that manages nothing. It suits containers and
+// hosts where something else restarts dnsmasq.
+type None struct {
+	defs definitions
+}
+
+// NewNone creates a service manager that only logs what it would do
+func NewNone(defs []Definition) *None {
+	return &None{defs: index(defs)}
+}
+
+// Kind implements Manager
+func (n *None) Kind() string { return KindNone }
+
+// Services implements Manager
+func (n *None) Services() []string { return n.defs.names() }
+
+// Start implements Manager
+func (n *None) Start(ctx context.Context, name string) error {
+	return n.skip("start", name)
+}
+
+// Stop implements Manager
+func (n *None) Stop(ctx context.Context, name string) error {
+	return n.skip("stop", name)
+}
+
+// Restart implements Manager
+func (n *None) Restart(ctx context.Context, name string) error {
+	return n.skip("restart", name)
+}
+
+// Status implements Manager; the state is never known
+func (n *None) Status(ctx context.Context, name string) (Status, error) {
+	if _, err := n.defs.get(name); err != nil {
+		return Status{}, err
+	}
+	return Status{Name: name, State: StateUnknown, Detail: "service management is disabled"}, nil
+}
+
+// skip logs an action that was not taken
+func (n *None) skip(action, name string) error {
+	if _, err := n.defs.get(name); err != nil {
+		return err
+	}
+	slog.Info("Service management is disabled, not running "+action, "service", name)
+	return nil
+}
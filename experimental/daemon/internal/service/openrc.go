@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"wild-cloud-central/internal/command"
+)
+
+// rcService is the OpenRC control tool
+const rcService = "rc-service"
+
+// OpenRC manages services through OpenRC init scripts
+type OpenRC struct {
+	defs   definitions
+	runner command.Runner
+}
+
+// NewOpenRC creates an OpenRC service manager. A definition without a unit
+// uses the service name as the init script name.
+func NewOpenRC(defs []Definition, runner command.Runner) *OpenRC {
+	return &OpenRC{defs: index(defs), runner: runner}
+}
+
+// Kind implements Manager
+func (o *OpenRC) Kind() string { return KindOpenRC }
+
+// Services implements Manager
+func (o *OpenRC) Services() []string { return o.defs.names() }
+
+// Start implements Manager
+func (o *OpenRC) Start(ctx context.Context, name string) error {
+	return o.control(ctx, "start", name)
+}
+
+// Stop implements Manager
+func (o *OpenRC) Stop(ctx context.Context, name string) error {
+	return o.control(ctx, "stop", name)
+}
+
+// Restart implements Manager
+func (o *OpenRC) Restart(ctx context.Context, name string) error {
+	return o.control(ctx, "restart", name)
+}
+
+// Status implements Manager by reading the status line of rc-service
+func (o *OpenRC) Status(ctx context.Context, name string) (Status, error) {
+	def, err := o.defs.get(name)
+	if err != nil {
+		return Status{}, err
+	}
+
+	// rc-service exits non-zero for stopped services, so read its output
+	output, err := o.runner.Run(ctx, rcService, def.Unit, "status")
+	text := strings.TrimSpace(string(output))
+	status := Status{Name: name, Detail: text}
+	switch {
+	case strings.Contains(text, "crashed"):
+		status.State = StateFailed
+	case strings.Contains(text, "started"):
+		status.State = StateRunning
+	case strings.Contains(text, "stopped"):
+		status.State = StateStopped
+	case text == "" && err != nil:
+		return Status{}, err
+	default:
+		status.State = StateUnknown
+	}
+	return status, nil
+}
+
+// control runs an rc-service action
+func (o *OpenRC) control(ctx context.Context, action, name string) error {
+	def, err := o.defs.get(name)
+	if err != nil {
+		return err
+	}
+	cmd, args := privileged(rcService, def.Unit, action)
+	_, err = o.runner.Run(ctx, cmd, args...)
+	return err
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Restart delays for supervised processes that exit on their own; vars so
+// tests can shorten them. A child that stays up longer than the maximum
+// delay starts again from the minimum the next time it exits.
+var (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+)
+
+// stopTimeout is how long a process gets to exit after SIGTERM
+const stopTimeout = 10 * time.Second
+
+// Process runs services as child processes of the daemon and restarts them
+// when they exit unexpectedly. Each service needs a command that stays in
+// the foreground, e.g. dnsmasq --keep-in-foreground.
+type Process struct {
+	defs     definitions
+	mu       sync.Mutex
+	children map[string]*child
+}
+
+// child is one supervised process
+type child struct {
+	cmd     *exec.Cmd
+	done    chan struct{}
+	want    bool
+	exitErr error
+	delay   time.Duration
+	started time.Time
+}
+
+// NewProcess creates a process supervisor. Every definition needs a command.
+func NewProcess(defs []Definition) (*Process, error) {
+	for _, def := range defs {
+		if len(def.Command) == 0 {
+			return nil, fmt.Errorf("service %s has no command for the process manager", def.Name)
+		}
+	}
+	return &Process{defs: index(defs), children: make(map[string]*child)}, nil
+}
+
+// Kind implements Manager
+func (p *Process) Kind() string { return KindProcess }
+
+// Services implements Manager
+func (p *Process) Services() []string { return p.defs.names() }
+
+// StartAll starts every service, logging the ones that fail
+func (p *Process) StartAll(ctx context.Context) {
+	for _, name := range p.Services() {
+		if err := p.Start(ctx, name); err != nil {
+			slog.Error("Failed to start service", "service", name, "error", err)
+		}
+	}
+}
+
+// Start implements Manager. Starting a running service does nothing.
+func (p *Process) Start(ctx context.Context, name string) error {
+	def, err := p.defs.get(name)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c := p.children[name]; c != nil && c.running() {
+		c.want = true
+		return nil
+	}
+	return p.spawn(def, minRestartDelay)
+}
+
+// Stop implements Manager
+func (p *Process) Stop(ctx context.Context, name string) error {
+	if _, err := p.defs.get(name); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	c := p.children[name]
+	if c == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	// Clear want even if the child already exited, so supervise does not
+	// respawn a service waiting out its restart delay
+	c.want = false
+	if !c.running() {
+		p.mu.Unlock()
+		return nil
+	}
+	c.cmd.Process.Signal(syscall.SIGTERM)
+	p.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return nil
+	case <-time.After(stopTimeout):
+	case <-ctx.Done():
+	}
+	c.cmd.Process.Kill()
+	<-c.done
+	return nil
+}
+
+// Restart implements Manager
+func (p *Process) Restart(ctx context.Context, name string) error {
+	if err := p.Stop(ctx, name); err != nil {
+		return err
+	}
+	return p.Start(ctx, name)
+}
+
+// Status implements Manager
+func (p *Process) Status(ctx context.Context, name string) (Status, error) {
+	if _, err := p.defs.get(name); err != nil {
+		return Status{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := p.children[name]
+	switch {
+	case c == nil:
+		return Status{Name: name, State: StateStopped}, nil
+	case c.running():
+		return Status{Name: name, State: StateRunning, Detail: fmt.Sprintf("pid %d", c.cmd.Process.Pid)}, nil
+	case c.exitErr != nil && c.want:
+		// It exited on its own and is waiting to be restarted
+		return Status{Name: name, State: StateFailed, Detail: c.exitErr.Error()}, nil
+	}
+	return Status{Name: name, State: StateStopped}, nil
+}
+
+// spawn starts a service's command and supervises it. p.mu must be held.
+func (p *Process) spawn(def Definition, delay time.Duration) error {
+	cmd := exec.Command(def.Command[0], def.Command[1:]...)
+	output, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	setParentDeathSignal(cmd)
+	if err := cmd.Start(); err != nil {
+		writer.Close()
+		return fmt.Errorf("starting %s: %w", def.Name, err)
+	}
+	slog.Info("Started service", "service", def.Name, "pid", cmd.Process.Pid)
+
+	c := &child{cmd: cmd, done: make(chan struct{}), want: true, delay: delay, started: time.Now()}
+	p.children[def.Name] = c
+	go logOutput(def.Name, output)
+	go p.supervise(def, c, writer)
+	return nil
+}
+
+// supervise waits for a child to exit and restarts it, with a growing
+// delay, unless it was stopped on purpose. If the command cannot be started
+// again it keeps retrying on the same backoff.
+func (p *Process) supervise(def Definition, c *child, writer *io.PipeWriter) {
+	err := c.cmd.Wait()
+	writer.Close()
+
+	p.mu.Lock()
+	c.exitErr = err
+	close(c.done)
+	want := c.want
+	p.mu.Unlock()
+	if !want {
+		return
+	}
+
+	delay := restartDelay(c.delay, time.Since(c.started))
+	slog.Warn("Service exited unexpectedly, restarting", "service", def.Name, "error", err, "delay", delay)
+	for {
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+
+		p.mu.Lock()
+		// Someone else may have started or stopped it meanwhile
+		if p.children[def.Name] != c || !c.want {
+			p.mu.Unlock()
+			return
+		}
+		err := p.spawn(def, delay)
+		if err == nil {
+			p.mu.Unlock()
+			return
+		}
+		c.exitErr = err
+		p.mu.Unlock()
+		slog.Error("Failed to restart service", "service", def.Name, "error", err, "retry", delay)
+	}
+}
+
+// restartDelay is how long to wait before restarting a child that exited
+// after uptime, given the delay its last restart set
+func restartDelay(delay, uptime time.Duration) time.Duration {
+	if uptime > maxRestartDelay {
+		return minRestartDelay
+	}
+	return delay
+}
+
+// running reports whether the child has not exited yet
+func (c *child) running() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// logOutput copies a child's output to the log line by line
+func logOutput(name string, output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		slog.Info(scanner.Text(), "service", name)
+	}
+}
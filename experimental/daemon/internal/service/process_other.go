@@ -0,0 +1,9 @@
+//go:build !linux
+
+package service
+
+import "os/exec"
+
+// setParentDeathSignal is only supported on Linux; elsewhere children may
+// outlive a daemon that is killed
+func setParentDeathSignal(cmd *exec.Cmd) {}
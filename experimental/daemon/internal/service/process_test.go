@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessStopDuringRestartDelay(t *testing.T) {
+	p, err := NewProcess([]Definition{{Name: "flaky", Command: []string{"sh", "-c", "exit 1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := p.Start(ctx, "flaky"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	p.mu.Lock()
+	c := p.children["flaky"]
+	p.mu.Unlock()
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("child did not exit")
+	}
+
+	// The child is now waiting out its restart delay
+	if err := p.Stop(ctx, "flaky"); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	time.Sleep(minRestartDelay + 500*time.Millisecond)
+
+	p.mu.Lock()
+	respawned := p.children["flaky"] != c
+	p.mu.Unlock()
+	if respawned {
+		t.Error("stopped service was restarted")
+	}
+	status, err := p.Status(ctx, "flaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != StateStopped {
+		t.Errorf("state = %s, want %s", status.State, StateStopped)
+	}
+}
+
+// shortRestartDelays speeds up the supervisor's backoff for a test
+func shortRestartDelays(t *testing.T) {
+	t.Helper()
+	min, max := minRestartDelay, maxRestartDelay
+	minRestartDelay, maxRestartDelay = 50*time.Millisecond, 200*time.Millisecond
+	t.Cleanup(func() { minRestartDelay, maxRestartDelay = min, max })
+}
+
+// waitForState polls the status of a service until it reaches state with
+// a detail containing detail
+func waitForState(t *testing.T, p *Process, name, state, detail string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := p.Status(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State == state && strings.Contains(status.Detail, detail) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %s (%s), want %s (%s)", status.State, status.Detail, state, detail)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRestartDelay(t *testing.T) {
+	tests := []struct {
+		delay, uptime, want time.Duration
+	}{
+		{minRestartDelay, 0, minRestartDelay},
+		{8 * time.Second, time.Second, 8 * time.Second},
+		{maxRestartDelay, maxRestartDelay, maxRestartDelay},
+		{maxRestartDelay, maxRestartDelay + time.Second, minRestartDelay},
+		{8 * time.Second, time.Hour, minRestartDelay},
+	}
+	for _, tt := range tests {
+		if got := restartDelay(tt.delay, tt.uptime); got != tt.want {
+			t.Errorf("restartDelay(%v, %v) = %v, want %v", tt.delay, tt.uptime, got, tt.want)
+		}
+	}
+}
+
+func TestProcessRetriesFailedRestart(t *testing.T) {
+	shortRestartDelays(t)
+
+	// The first run removes its own command, so restarting it fails until
+	// the command is put back
+	script := filepath.Join(t.TempDir(), "flaky")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nrm -f \"$0\"\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProcess([]Definition{{Name: "flaky", Command: []string{script}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := p.Start(ctx, "flaky"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { p.Stop(ctx, "flaky") })
+
+	waitForState(t, p, "flaky", StateFailed, "starting flaky")
+
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, p, "flaky", StateRunning, "pid")
+}
@@ -0,0 +1,132 @@
+// Package service starts, stops and inspects the host services the daemon
+// depends on, such as dnsmasq, through whichever service manager the host
+// uses.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"wild-cloud-central/internal/command"
+)
+
+// Service manager kinds, as named in the config
+const (
+	KindSystemd = "systemd"
+	KindOpenRC  = "openrc"
+	KindProcess = "process"
+	KindNone    = "none"
+)
+
+// Service states reported by Status
+const (
+	StateRunning = "running"
+	StateStopped = "stopped"
+	StateFailed  = "failed"
+	StateUnknown = "unknown"
+)
+
+// Dnsmasq is the name of the dnsmasq service
+const Dnsmasq = "dnsmasq"
+
+// ErrUnknownService is returned for services the manager does not know
+var ErrUnknownService = errors.New("unknown service")
+
+// Status is the state of one service
+type Status struct {
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Definition describes a service to manage
+type Definition struct {
+	Name string
+
+	// Unit is the systemd unit or OpenRC service name
+	Unit string
+
+	// Command runs the service in the foreground under the process manager
+	Command []string
+}
+
+// Manager controls a set of named services
+type Manager interface {
+	// Kind returns the kind of service manager
+	Kind() string
+
+	// Services returns the names of the managed services, sorted
+	Services() []string
+
+	Start(ctx context.Context, name string) error
+	Stop(ctx context.Context, name string) error
+	Restart(ctx context.Context, name string) error
+	Status(ctx context.Context, name string) (Status, error)
+}
+
+// New creates a service manager of the given kind for defs. runner runs the
+// systemd and OpenRC tools.
+func New(kind string, defs []Definition, runner command.Runner) (Manager, error) {
+	switch kind {
+	case KindSystemd, "":
+		return NewSystemd(defs, runner), nil
+	case KindOpenRC:
+		return NewOpenRC(defs, runner), nil
+	case KindProcess:
+		return NewProcess(defs)
+	case KindNone:
+		return NewNone(defs), nil
+	}
+	return nil, fmt.Errorf("unknown service manager %q", kind)
+}
+
+// Healthy reports whether a status shows a service that is up, or one whose
+// state cannot be known
+func Healthy(status Status) bool {
+	return status.State == StateRunning || status.State == StateUnknown
+}
+
+// definitions indexes defs by name
+type definitions map[string]Definition
+
+// index builds a definitions map, defaulting each unit to the service name
+func index(defs []Definition) definitions {
+	byName := make(definitions, len(defs))
+	for _, def := range defs {
+		if def.Unit == "" {
+			def.Unit = def.Name
+		}
+		byName[def.Name] = def
+	}
+	return byName
+}
+
+// get returns the definition of a service
+func (d definitions) get(name string) (Definition, error) {
+	def, ok := d[name]
+	if !ok {
+		return Definition{}, fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	return def, nil
+}
+
+// names returns the service names, sorted
+func (d definitions) names() []string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// privileged prefixes a command with sudo unless the daemon runs as root
+func privileged(name string, args ...string) (string, []string) {
+	if os.Geteuid() == 0 {
+		return name, args
+	}
+	return "sudo", append([]string{name}, args...)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"wild-cloud-central/internal/command"
+)
+
+// systemctl is the systemd control tool
+const systemctl = "/usr/bin/systemctl"
+
+// Systemd manages services as systemd units
+type Systemd struct {
+	defs   definitions
+	runner command.Runner
+}
+
+// NewSystemd creates a systemd service manager. A definition without a unit
+// uses "<name>.service".
+func NewSystemd(defs []Definition, runner command.Runner) *Systemd {
+	units := make([]Definition, len(defs))
+	for i, def := range defs {
+		if def.Unit == "" {
+			def.Unit = def.Name + ".service"
+		}
+		units[i] = def
+	}
+	return &Systemd{defs: index(units), runner: runner}
+}
+
+// Kind implements Manager
+func (s *Systemd) Kind() string { return KindSystemd }
+
+// Services implements Manager
+func (s *Systemd) Services() []string { return s.defs.names() }
+
+// Start implements Manager
+func (s *Systemd) Start(ctx context.Context, name string) error {
+	return s.control(ctx, "start", name)
+}
+
+// Stop implements Manager
+func (s *Systemd) Stop(ctx context.Context, name string) error {
+	return s.control(ctx, "stop", name)
+}
+
+// Restart implements Manager
+func (s *Systemd) Restart(ctx context.Context, name string) error {
+	return s.control(ctx, "restart", name)
+}
+
+// Status implements Manager using systemctl is-active, which needs no
+// privileges
+func (s *Systemd) Status(ctx context.Context, name string) (Status, error) {
+	def, err := s.defs.get(name)
+	if err != nil {
+		return Status{}, err
+	}
+
+	// is-active exits non-zero for anything but active, so its output is
+	// what matters
+	output, err := s.runner.Run(ctx, systemctl, "is-active", def.Unit)
+	state := strings.TrimSpace(string(output))
+	status := Status{Name: name, Detail: state}
+	switch state {
+	case "active", "reloading":
+		status.State = StateRunning
+	case "inactive", "deactivating":
+		status.State = StateStopped
+	case "failed":
+		status.State = StateFailed
+	case "":
+		if err != nil {
+			return Status{}, err
+		}
+		status.State = StateUnknown
+	default:
+		status.State = StateUnknown
+	}
+	return status, nil
+}
+
+// control runs a systemctl action on a unit
+func (s *Systemd) control(ctx context.Context, action, name string) error {
+	def, err := s.defs.get(name)
+	if err != nil {
+		return err
+	}
+	cmd, args := privileged(systemctl, action, def.Unit)
+	_, err = s.runner.Run(ctx, cmd, args...)
+	return err
+}
@@ -0,0 +1,265 @@
+// Package settings resolves the daemon's runtime settings from command-line
+// flags, WILD_* environment variables, the config file and built-in defaults.
+//
+// Each setting is taken from the first of these that provides it:
+//
+//  1. command-line flag
+//  2. environment variable
+//  3. config file (listen address only, from server.host and server.port)
+//  4. built-in default
+package settings
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/data"
+)
+
+// Sources a setting value can come from, in order of precedence
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceConfig  = "config"
+	SourceDefault = "default"
+)
+
+// Precedence lists the setting sources from highest to lowest priority
+var Precedence = []string{SourceFlag, SourceEnv, SourceConfig, SourceDefault}
+
+// Defaults for settings that do not depend on the data directory
+const (
+	DefaultHost      = "0.0.0.0"
+	DefaultPort      = 5055
+	DefaultStaticDir = "./static/"
+	DefaultLogLevel  = "info"
+)
+
+// Setting is one resolved setting and where its value came from
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Flag   string `json:"flag"`
+	Env    string `json:"env"`
+}
+
+// Settings holds the effective daemon settings
+type Settings struct {
+	Listen      Setting
+	DataDir     Setting
+	ConfigFile  Setting
+	AssetsDir   Setting
+	DnsmasqConf Setting
+	StaticDir   Setting
+	LogLevel    Setting
+	AppsDir     Setting
+
+	// SecretsKeyFile holds the passphrase for encrypted secrets
+	SecretsKeyFile Setting
+
+	// DnsmasqTemplate and DnsmasqSnippetsDir customize the dnsmasq config
+	DnsmasqTemplate    Setting
+	DnsmasqSnippetsDir Setting
+	DnsmasqLeases      Setting
+}
+
+// Parse reads flags from args and WILD_* variables via lookupEnv. Settings
+// given by neither are left empty for ResolvePaths and ResolveListen to fill.
+func Parse(args []string, lookupEnv func(string) (string, bool), output io.Writer) (*Settings, error) {
+	s := &Settings{
+		Listen:      Setting{Name: "listen", Flag: "listen", Env: "WILD_LISTEN"},
+		DataDir:     Setting{Name: "dataDir", Flag: "data-dir", Env: "WILD_DATA_DIR"},
+		ConfigFile:  Setting{Name: "configFile", Flag: "config", Env: "WILD_CONFIG"},
+		AssetsDir:   Setting{Name: "assetsDir", Flag: "assets-dir", Env: "WILD_ASSETS_DIR"},
+		DnsmasqConf: Setting{Name: "dnsmasqConf", Flag: "dnsmasq-conf", Env: "WILD_DNSMASQ_CONF"},
+		StaticDir:   Setting{Name: "staticDir", Flag: "static-dir", Env: "WILD_STATIC_DIR"},
+		LogLevel:    Setting{Name: "logLevel", Flag: "log-level", Env: "WILD_LOG_LEVEL"},
+		AppsDir:     Setting{Name: "appsDir", Flag: "apps-dir", Env: "WILD_APPS_DIR"},
+
+		SecretsKeyFile: Setting{Name: "secretsKeyFile", Flag: "secrets-key-file", Env: "WILD_SECRETS_KEY_FILE"},
+
+		DnsmasqTemplate:    Setting{Name: "dnsmasqTemplate", Flag: "dnsmasq-template", Env: "WILD_DNSMASQ_TEMPLATE"},
+		DnsmasqSnippetsDir: Setting{Name: "dnsmasqSnippetsDir", Flag: "dnsmasq-snippets-dir", Env: "WILD_DNSMASQ_SNIPPETS_DIR"},
+		DnsmasqLeases:      Setting{Name: "dnsmasqLeases", Flag: "dnsmasq-leases", Env: "WILD_DNSMASQ_LEASES"},
+	}
+
+	fs := flag.NewFlagSet("wild-cloud-central", flag.ContinueOnError)
+	fs.SetOutput(output)
+	values := make(map[string]*string)
+	usage := map[string]string{
+		"listen":       "address to listen on, as host:port",
+		"data-dir":     "directory for daemon state",
+		"config":       "path to config.yaml",
+		"assets-dir":   "directory for PXE boot assets",
+		"dnsmasq-conf": "path of the generated dnsmasq config",
+		"static-dir":   "directory containing the web UI",
+		"log-level":    "log level: debug, info, warn or error",
+		"apps-dir":     "directory of app manifests (default <wildcloud.repository>/apps)",
+
+		"secrets-key-file": "file holding the passphrase for encrypted secrets",
+
+		"dnsmasq-template":     "template replacing the built-in dnsmasq config template",
+		"dnsmasq-snippets-dir": "directory of *.conf snippets added to the dnsmasq config",
+		"dnsmasq-leases":       "lease file written by dnsmasq",
+	}
+	for _, setting := range s.all() {
+		values[setting.Flag] = fs.String(setting.Flag, "", usage[setting.Flag]+" (env "+setting.Env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, setting := range s.all() {
+		if given[setting.Flag] {
+			setting.Value, setting.Source = *values[setting.Flag], SourceFlag
+		} else if value, ok := lookupEnv(setting.Env); ok && value != "" {
+			setting.Value, setting.Source = value, SourceEnv
+		}
+	}
+
+	if s.StaticDir.Source == "" {
+		s.StaticDir.Value, s.StaticDir.Source = DefaultStaticDir, SourceDefault
+	}
+	if s.LogLevel.Source == "" {
+		s.LogLevel.Value, s.LogLevel.Source = DefaultLogLevel, SourceDefault
+	}
+	if s.SecretsKeyFile.Source == "" {
+		s.SecretsKeyFile.Source = SourceDefault
+	}
+	if s.AppsDir.Source == "" {
+		s.AppsDir.Source = SourceDefault
+	}
+
+	if _, err := parseLevel(s.LogLevel.Value); err != nil {
+		return nil, err
+	}
+	if s.Listen.Value != "" {
+		if err := validateListen(s.Listen.Value); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Overrides returns the path settings to apply to the data manager
+func (s *Settings) Overrides() data.Overrides {
+	return data.Overrides{
+		DataDir:     s.DataDir.Value,
+		ConfigFile:  s.ConfigFile.Value,
+		AssetsDir:   s.AssetsDir.Value,
+		DnsmasqConf: s.DnsmasqConf.Value,
+
+		DnsmasqTemplate:    s.DnsmasqTemplate.Value,
+		DnsmasqSnippetsDir: s.DnsmasqSnippetsDir.Value,
+		DnsmasqLeases:      s.DnsmasqLeases.Value,
+	}
+}
+
+// ResolvePaths fills path settings that were not overridden from the data
+// manager's defaults
+func (s *Settings) ResolvePaths(paths data.Paths) {
+	for _, p := range []struct {
+		setting *Setting
+		value   string
+	}{
+		{&s.DataDir, paths.DataDir},
+		{&s.ConfigFile, paths.ConfigFile},
+		{&s.AssetsDir, paths.AssetsDir},
+		{&s.DnsmasqConf, paths.DnsmasqConf},
+		{&s.DnsmasqTemplate, paths.DnsmasqTemplate},
+		{&s.DnsmasqSnippetsDir, paths.DnsmasqSnippetsDir},
+		{&s.DnsmasqLeases, paths.DnsmasqLeases},
+	} {
+		if p.setting.Source == "" {
+			p.setting.Value, p.setting.Source = p.value, SourceDefault
+		}
+	}
+}
+
+// ResolveListen fills the listen address from the config file's server
+// section if it was not overridden, falling back to the default
+func (s *Settings) ResolveListen(cfg *config.Config) {
+	if s.Listen.Source != "" {
+		return
+	}
+
+	host, port := DefaultHost, DefaultPort
+	source := SourceDefault
+	if cfg != nil && cfg.Server.Host != "" {
+		host, source = cfg.Server.Host, SourceConfig
+	}
+	if cfg != nil && cfg.Server.Port != 0 {
+		port, source = cfg.Server.Port, SourceConfig
+	}
+	s.Listen.Value = net.JoinHostPort(host, strconv.Itoa(port))
+	s.Listen.Source = source
+}
+
+// List returns every setting in a stable order
+func (s *Settings) List() []Setting {
+	all := s.all()
+	list := make([]Setting, len(all))
+	for i, setting := range all {
+		list[i] = *setting
+	}
+	return list
+}
+
+func (s *Settings) all() []*Setting {
+	return []*Setting{
+		&s.Listen, &s.DataDir, &s.ConfigFile, &s.AssetsDir,
+		&s.DnsmasqConf, &s.DnsmasqTemplate, &s.DnsmasqSnippetsDir, &s.DnsmasqLeases,
+		&s.StaticDir, &s.LogLevel, &s.AppsDir, &s.SecretsKeyFile,
+	}
+}
+
+// ConfigureLogging installs a default logger at the configured level. The
+// daemon logs through slog; output from the standard log package, such as
+// net/http server errors, is logged at info level.
+func (s *Settings) ConfigureLogging() {
+	level, _ := parseLevel(s.LogLevel.Value)
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(handler))
+}
+
+// parseLevel converts a level name to a slog level
+func parseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", name)
+}
+
+// validateListen checks a host:port listen address
+func validateListen(addr string) error {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid listen address %q: port must be 1-65535", addr)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package settings
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"wild-cloud-central/internal/config"
+	"wild-cloud-central/internal/data"
+)
+
+// env returns a lookupEnv function backed by a map
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+// serverConfig returns a config with only the server section set
+func serverConfig(host string, port int) *config.Config {
+	cfg := &config.Config{}
+	cfg.Server.Host = host
+	cfg.Server.Port = port
+	return cfg
+}
+
+func TestParsePrecedence(t *testing.T) {
+	s, err := Parse(
+		[]string{"-data-dir", "/flag/data", "-log-level", "debug"},
+		env(map[string]string{
+			"WILD_DATA_DIR":  "/env/data",
+			"WILD_CONFIG":    "/env/config.yaml",
+			"WILD_LOG_LEVEL": "error",
+			"WILD_APPS_DIR":  "",
+		}),
+		io.Discard,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting Setting
+		value   string
+		source  string
+	}{
+		{s.DataDir, "/flag/data", SourceFlag},
+		{s.LogLevel, "debug", SourceFlag},
+		{s.ConfigFile, "/env/config.yaml", SourceEnv},
+		{s.StaticDir, DefaultStaticDir, SourceDefault},
+		// An empty variable counts as unset
+		{s.AppsDir, "", SourceDefault},
+		// Left for ResolvePaths and ResolveListen
+		{s.AssetsDir, "", ""},
+		{s.Listen, "", ""},
+	}
+	for _, tt := range tests {
+		if tt.setting.Value != tt.value || tt.setting.Source != tt.source {
+			t.Errorf("%s = %q from %q, want %q from %q", tt.setting.Name, tt.setting.Value, tt.setting.Source, tt.value, tt.source)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+		env  map[string]string
+	}{
+		"unknown flag":             {args: []string{"-verbose"}},
+		"positional argument":      {args: []string{"serve"}},
+		"invalid log level":        {args: []string{"-log-level", "loud"}},
+		"invalid env log level":    {env: map[string]string{"WILD_LOG_LEVEL": "loud"}},
+		"listen without port":      {args: []string{"-listen", "0.0.0.0"}},
+		"listen port out of range": {env: map[string]string{"WILD_LISTEN": ":70000"}},
+		"listen port zero":         {args: []string{"-listen", "127.0.0.1:0"}},
+	}
+	for name, tt := range tests {
+		if _, err := Parse(tt.args, env(tt.env), io.Discard); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", name)
+		}
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	s, err := Parse([]string{"-config", "/flag/config.yaml"}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Overrides(); !reflect.DeepEqual(got, data.Overrides{ConfigFile: "/flag/config.yaml"}) {
+		t.Errorf("Overrides = %+v", got)
+	}
+
+	s.ResolvePaths(data.Paths{
+		DataDir:     "/var/lib/wild",
+		ConfigFile:  "/var/lib/wild/config.yaml",
+		AssetsDir:   "/var/lib/wild/assets",
+		DnsmasqConf: "/etc/dnsmasq.d/wild-cloud.conf",
+	})
+	if s.ConfigFile.Value != "/flag/config.yaml" || s.ConfigFile.Source != SourceFlag {
+		t.Errorf("configFile = %+v, want the flag kept", s.ConfigFile)
+	}
+	if s.AssetsDir.Value != "/var/lib/wild/assets" || s.AssetsDir.Source != SourceDefault {
+		t.Errorf("assetsDir = %+v, want the data manager default", s.AssetsDir)
+	}
+}
+
+func TestResolveListen(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		cfg    *config.Config
+		value  string
+		source string
+	}{
+		{name: "no config", value: "0.0.0.0:5055", source: SourceDefault},
+		{name: "empty server section", cfg: &config.Config{}, value: "0.0.0.0:5055", source: SourceDefault},
+		{
+			name:   "port from the config",
+			cfg:    serverConfig("", 8080),
+			value:  "0.0.0.0:8080",
+			source: SourceConfig,
+		},
+		{
+			name:   "IPv6 host from the config",
+			cfg:    serverConfig("::1", 0),
+			value:  "[::1]:5055",
+			source: SourceConfig,
+		},
+		{
+			name:   "flag beats the config",
+			args:   []string{"-listen", "127.0.0.1:9000"},
+			cfg:    serverConfig("", 8080),
+			value:  "127.0.0.1:9000",
+			source: SourceFlag,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.args, env(nil), io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.ResolveListen(tt.cfg)
+			if s.Listen.Value != tt.value || s.Listen.Source != tt.source {
+				t.Errorf("listen = %q from %q, want %q from %q", s.Listen.Value, s.Listen.Source, tt.value, tt.source)
+			}
+		})
+	}
+}
+
+func TestListCoversEverySetting(t *testing.T) {
+	s, err := Parse(nil, env(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := s.List()
+	if want := reflect.TypeOf(Settings{}).NumField(); len(list) != want {
+		t.Errorf("List has %d settings, want all %d", len(list), want)
+	}
+	seen := map[string]bool{}
+	for _, setting := range list {
+		if setting.Name == "" || setting.Flag == "" || setting.Env == "" {
+			t.Errorf("setting %+v is missing a name, flag or variable", setting)
+		}
+		if seen[setting.Flag] {
+			t.Errorf("flag -%s is listed twice", setting.Flag)
+		}
+		seen[setting.Flag] = true
+	}
+}
@@ -0,0 +1,211 @@
+package templates
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// funcMap returns the subset of gomplate functions used by the wild-cloud
+// templates, including the strings, data, conv and base64 namespaces
+func funcMap() template.FuncMap {
+	return template.FuncMap{
+		// Namespaces, called as {{ strings.ReplaceAll "." "-" .cloud.domain }}
+		"strings": func() stringsNS { return stringsNS{} },
+		"data":    func() dataNS { return dataNS{} },
+		"conv":    func() convNS { return convNS{} },
+		"base64":  func() base64NS { return base64NS{} },
+
+		// Top-level aliases
+		"default":    defaultValue,
+		"required":   required,
+		"quote":      stringsNS{}.Quote,
+		"squote":     stringsNS{}.Squote,
+		"replaceAll": stringsNS{}.ReplaceAll,
+		"toUpper":    stringsNS{}.ToUpper,
+		"toLower":    stringsNS{}.ToLower,
+		"trimSpace":  stringsNS{}.TrimSpace,
+		"contains":   stringsNS{}.Contains,
+		"hasPrefix":  stringsNS{}.HasPrefix,
+		"hasSuffix":  stringsNS{}.HasSuffix,
+		"split":      stringsNS{}.Split,
+		"indent":     stringsNS{}.Indent,
+		"toYAML":     dataNS{}.ToYAML,
+		"toJSON":     dataNS{}.ToJSON,
+	}
+}
+
+// defaultValue returns def when value is empty, like gomplate's default
+func defaultValue(def, value interface{}) interface{} {
+	if isEmpty(value) {
+		return def
+	}
+	return value
+}
+
+// required fails rendering when value is empty
+func required(message string, value interface{}) (interface{}, error) {
+	if isEmpty(value) {
+		return nil, fmt.Errorf("%s", message)
+	}
+	return value, nil
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func toString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// stringsNS implements gomplate's strings namespace
+type stringsNS struct{}
+
+func (stringsNS) ReplaceAll(old, new string, s interface{}) string {
+	return strings.ReplaceAll(toString(s), old, new)
+}
+
+func (stringsNS) ToUpper(s interface{}) string { return strings.ToUpper(toString(s)) }
+
+func (stringsNS) ToLower(s interface{}) string { return strings.ToLower(toString(s)) }
+
+func (stringsNS) TrimSpace(s interface{}) string { return strings.TrimSpace(toString(s)) }
+
+func (stringsNS) Trim(cutset string, s interface{}) string {
+	return strings.Trim(toString(s), cutset)
+}
+
+func (stringsNS) TrimPrefix(prefix string, s interface{}) string {
+	return strings.TrimPrefix(toString(s), prefix)
+}
+
+func (stringsNS) TrimSuffix(suffix string, s interface{}) string {
+	return strings.TrimSuffix(toString(s), suffix)
+}
+
+func (stringsNS) Contains(substr string, s interface{}) bool {
+	return strings.Contains(toString(s), substr)
+}
+
+func (stringsNS) HasPrefix(prefix string, s interface{}) bool {
+	return strings.HasPrefix(toString(s), prefix)
+}
+
+func (stringsNS) HasSuffix(suffix string, s interface{}) bool {
+	return strings.HasSuffix(toString(s), suffix)
+}
+
+func (stringsNS) Split(sep string, s interface{}) []string {
+	return strings.Split(toString(s), sep)
+}
+
+func (stringsNS) Repeat(count int, s interface{}) string {
+	return strings.Repeat(toString(s), count)
+}
+
+func (stringsNS) Quote(s interface{}) string { return strconv.Quote(toString(s)) }
+
+func (stringsNS) Squote(s interface{}) string {
+	return "'" + strings.ReplaceAll(toString(s), "'", "''") + "'"
+}
+
+// Indent indents every line of the input, accepting gomplate's optional
+// width and indent string arguments: indent [width] [indent] input
+func (stringsNS) Indent(args ...interface{}) (string, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return "", fmt.Errorf("indent: wrong number of arguments")
+	}
+	input := toString(args[len(args)-1])
+	width, pad := 1, " "
+	if len(args) >= 2 {
+		w, err := strconv.Atoi(toString(args[0]))
+		if err != nil {
+			return "", fmt.Errorf("indent: width must be a number")
+		}
+		width = w
+	}
+	if len(args) == 3 {
+		pad = toString(args[1])
+	}
+
+	prefix := strings.Repeat(pad, width)
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// dataNS implements the parts of gomplate's data namespace we use
+type dataNS struct{}
+
+func (dataNS) ToYAML(value interface{}) (string, error) {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (dataNS) ToJSON(value interface{}) (string, error) {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// convNS implements the parts of gomplate's conv namespace we use
+type convNS struct{}
+
+func (convNS) ToString(value interface{}) string { return toString(value) }
+
+func (convNS) ToInt(value interface{}) (int, error) {
+	return strconv.Atoi(strings.TrimSpace(toString(value)))
+}
+
+func (convNS) ToBool(value interface{}) bool {
+	b, _ := strconv.ParseBool(strings.TrimSpace(toString(value)))
+	return b
+}
+
+func (convNS) Default(def, value interface{}) interface{} { return defaultValue(def, value) }
+
+// base64NS implements gomplate's base64 namespace
+type base64NS struct{}
+
+func (base64NS) Encode(value interface{}) string {
+	return base64.StdEncoding.EncodeToString([]byte(toString(value)))
+}
+
+func (base64NS) Decode(value interface{}) (string, error) {
+	out, err := base64.StdEncoding.DecodeString(toString(value))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
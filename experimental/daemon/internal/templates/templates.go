@@ -0,0 +1,236 @@
+// Package templates renders gomplate-style templates against the wild-cloud
+// config and secrets, as wild-compile-template and wild-compile-template-dir
+// do with gomplate -c .=config.yaml -c secrets=secrets.yaml.
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// Render actions reported for each file in a directory
+const (
+	ActionRendered = "rendered"
+	ActionCopied   = "copied"
+)
+
+var (
+	errorPattern   = regexp.MustCompile(`^template: ([^:]*):(\d+)(?::(\d+))?: (.*)$`)
+	executePattern = regexp.MustCompile(`^executing "[^"]*" at <([^>]*)>: (.*)$`)
+	missingPattern = regexp.MustCompile(`^map has no entry for key "([^"]*)"$`)
+)
+
+// RenderError describes where and why a template failed to render
+type RenderError struct {
+	Template string `json:"template"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *RenderError) Error() string {
+	location := e.Template
+	if e.Line > 0 {
+		location += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			location += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	return location + ": " + e.Message
+}
+
+// FileResult reports what happened to one file when rendering a directory
+type FileResult struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+}
+
+// Renderer renders templates against a fixed data context
+type Renderer struct {
+	data map[string]interface{}
+}
+
+// NewRenderer creates a renderer whose root context is the config, with the
+// secrets available as .secrets
+func NewRenderer(config, secrets map[string]interface{}) *Renderer {
+	data := make(map[string]interface{}, len(config)+1)
+	for key, value := range config {
+		data[key] = value
+	}
+	if secrets != nil {
+		data["secrets"] = secrets
+	}
+	return &Renderer{data: data}
+}
+
+// Render renders a single template. Referencing a key that does not exist
+// is an error rather than rendering "<no value>".
+func (r *Renderer) Render(name, text string) (string, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(funcMap()).
+		Parse(text)
+	if err != nil {
+		return "", newRenderError(name, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, r.data); err != nil {
+		return "", newRenderError(name, err)
+	}
+	return out.String(), nil
+}
+
+// RenderDir recursively renders every text file in srcDir into destDir and
+// copies binary files unchanged, like wild-compile-template-dir. If clean is
+// set destDir is removed first. Nothing is written if any template fails,
+// or if a symlink leads out of srcDir.
+func (r *Renderer) RenderDir(srcDir, destDir string, clean bool) ([]FileResult, error) {
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("source %s is not a directory", srcDir)
+	}
+	root, err := filepath.EvalSymlinks(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("source directory: %w", err)
+	}
+
+	type output struct {
+		result  FileResult
+		content []byte
+		mode    os.FileMode
+	}
+	var outputs []output
+
+	// Render everything in memory first so a failure leaves destDir untouched
+	err = filepath.WalkDir(srcDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return err
+			}
+			if up, err := filepath.Rel(root, target); err != nil || up == ".." || strings.HasPrefix(up, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("%s links outside the source directory", rel)
+			}
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		result := FileResult{Path: rel, Action: ActionCopied}
+		if isText(content) {
+			rendered, err := r.Render(rel, string(content))
+			if err != nil {
+				return err
+			}
+			content = []byte(rendered)
+			result.Action = ActionRendered
+		}
+		outputs = append(outputs, output{result: result, content: content, mode: info.Mode().Perm()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if clean {
+		if err := os.RemoveAll(destDir); err != nil {
+			return nil, fmt.Errorf("cleaning destination directory: %w", err)
+		}
+	}
+
+	results := make([]FileResult, 0, len(outputs))
+	for _, out := range outputs {
+		dest := filepath.Join(destDir, out.result.Path)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, fmt.Errorf("creating directory for %s: %w", out.result.Path, err)
+		}
+		if err := os.WriteFile(dest, out.content, out.mode); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", out.result.Path, err)
+		}
+		results = append(results, out.result)
+	}
+	return results, nil
+}
+
+// isText reports whether content looks like a text file
+func isText(content []byte) bool {
+	if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return false
+	}
+	return strings.HasPrefix(http.DetectContentType(content), "text/")
+}
+
+// newRenderError turns a text/template error into a RenderError with the
+// template location and, for undefined keys, the full dotted key path
+func newRenderError(name string, err error) error {
+	var execErr template.ExecError
+	if errors.As(err, &execErr) {
+		err = execErr.Err
+	}
+
+	renderErr := &RenderError{Template: name, Message: err.Error()}
+	match := errorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return renderErr
+	}
+
+	renderErr.Template = match[1]
+	renderErr.Line, _ = strconv.Atoi(match[2])
+	renderErr.Column, _ = strconv.Atoi(match[3])
+	renderErr.Message = match[4]
+
+	exec := executePattern.FindStringSubmatch(match[4])
+	if exec == nil {
+		return renderErr
+	}
+	expr, reason := exec[1], exec[2]
+	renderErr.Message = fmt.Sprintf("%s: %s", expr, reason)
+
+	if missing := missingPattern.FindStringSubmatch(reason); missing != nil {
+		// For <.cloud.nfs.host> with "nfs" missing, report cloud.nfs
+		key := missing[1]
+		if strings.HasPrefix(expr, ".") {
+			fields := strings.Split(strings.TrimPrefix(expr, "."), ".")
+			for i, field := range fields {
+				if field == missing[1] {
+					key = strings.Join(fields[:i+1], ".")
+					break
+				}
+			}
+		}
+		renderErr.Key = key
+		renderErr.Message = fmt.Sprintf("undefined key %q", key)
+	}
+	return renderErr
+}
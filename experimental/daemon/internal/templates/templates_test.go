@@ -0,0 +1,174 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testRenderer() *Renderer {
+	config := map[string]interface{}{
+		"cloud": map[string]interface{}{
+			"domain": "wild.example.com",
+			"dns":    map[string]interface{}{"ip": "192.168.8.50"},
+		},
+		"apps": map[string]interface{}{
+			"ghost": map[string]interface{}{"port": 2368, "tags": []interface{}{"blog", "web"}},
+		},
+	}
+	secrets := map[string]interface{}{
+		"cloudflare": map[string]interface{}{"token": "s3cr3t-token"},
+	}
+	return NewRenderer(config, secrets)
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "strings pipeline",
+			template: `{{ .cloud.domain | strings.ReplaceAll "." "-" | strings.ToUpper }}`,
+			want:     "WILD-EXAMPLE-COM",
+		},
+		{
+			name:     "data pipeline",
+			template: `{{ .apps.ghost | data.ToJSON }}`,
+			want:     `{"port":2368,"tags":["blog","web"]}`,
+		},
+		{
+			name:     "data.ToYAML with indent",
+			template: "dns:\n{{ .cloud.dns | data.ToYAML | indent 2 }}",
+			want:     "dns:\n  ip: 192.168.8.50",
+		},
+		{
+			name:     "base64 pipeline",
+			template: `{{ .secrets.cloudflare.token | base64.Encode }} {{ .secrets.cloudflare.token | base64.Encode | base64.Decode }}`,
+			want:     "czNjcjN0LXRva2Vu s3cr3t-token",
+		},
+		{
+			name:     "default for an empty value",
+			template: `{{ .cloud.dns.ip | default "10.0.0.1" }} {{ "" | default "10.0.0.1" }}`,
+			want:     "192.168.8.50 10.0.0.1",
+		},
+	}
+
+	r := testRenderer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Render(tt.name, tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMissingKey(t *testing.T) {
+	_, err := testRenderer().Render("nfs.yaml", "server: {{ .cloud.domain }}\nhost: {{ .cloud.nfs.host }}\n")
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("err = %v, want a RenderError", err)
+	}
+	want := RenderError{Template: "nfs.yaml", Line: 2, Column: 15, Key: "cloud.nfs", Message: `undefined key "cloud.nfs"`}
+	if *renderErr != want {
+		t.Errorf("err = %+v, want %+v", *renderErr, want)
+	}
+}
+
+func TestRenderDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "setup")
+	dest := src + "_compiled"
+	writeTestFile(t, filepath.Join(src, "dns.yaml"), "domain: {{ .cloud.domain }}\n")
+	writeTestFile(t, filepath.Join(src, "nested", "token.txt"), "{{ .secrets.cloudflare.token }}")
+	binary := "\x00\x01{{ .cloud.domain }}"
+	writeTestFile(t, filepath.Join(src, "logo.bin"), binary)
+	writeTestFile(t, filepath.Join(dest, "stale.yaml"), "old\n")
+
+	results, err := testRenderer().RenderDir(src, dest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileResult{
+		{Path: "dns.yaml", Action: ActionRendered},
+		{Path: "logo.bin", Action: ActionCopied},
+		{Path: filepath.Join("nested", "token.txt"), Action: ActionRendered},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+
+	files := map[string]string{
+		"dns.yaml":         "domain: wild.example.com\n",
+		"nested/token.txt": "s3cr3t-token",
+		"logo.bin":         binary,
+	}
+	for path, content := range files {
+		got, err := os.ReadFile(filepath.Join(dest, path))
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q (%v), want %q", path, got, err, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "stale.yaml")); !os.IsNotExist(err) {
+		t.Error("clean left a stale file in the destination")
+	}
+}
+
+func TestRenderDirWritesNothingOnFailure(t *testing.T) {
+	tests := map[string]func(t *testing.T, src string){
+		"missing key": func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "z.yaml"), "{{ .cloud.missing }}\n")
+		},
+		"symlink out of the source": func(t *testing.T, src string) {
+			outside := filepath.Join(t.TempDir(), "passwd")
+			writeTestFile(t, outside, "root:x:0:0\n")
+			if err := os.Symlink(outside, filepath.Join(src, "z.yaml")); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"symlink through ..": func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(filepath.Dir(src), "sibling.yaml"), "secret\n")
+			if err := os.Symlink(filepath.Join("..", "sibling.yaml"), filepath.Join(src, "z.yaml")); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "setup")
+			dest := src + "_compiled"
+			writeTestFile(t, filepath.Join(src, "a.yaml"), "domain: {{ .cloud.domain }}\n")
+			writeTestFile(t, filepath.Join(dest, "kept.yaml"), "old\n")
+			setup(t, src)
+
+			if _, err := testRenderer().RenderDir(src, dest, true); err == nil {
+				t.Fatal("RenderDir succeeded, want an error")
+			}
+			entries, err := os.ReadDir(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "kept.yaml" {
+				t.Errorf("destination was changed: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Package tftp is a read-only TFTP server (RFC 1350) for the PXE
+// bootloaders, with the blksize, tsize and timeout options (RFC 2347-2349).
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Opcodes
+const (
+	opRRQ   = 1
+	opWRQ   = 2
+	opDATA  = 3
+	opACK   = 4
+	opERROR = 5
+	opOACK  = 6
+)
+
+// Error codes
+const (
+	errNotDefined      = 0
+	errFileNotFound    = 1
+	errAccessViolation = 2
+	errIllegalOp       = 4
+	errUnknownTID      = 5
+)
+
+// Option limits
+const (
+	defaultBlockSize = 512
+	minBlockSize     = 8
+	maxBlockSize     = 65464
+	maxTimeout       = 255
+)
+
+var errMalformed = errors.New("malformed TFTP packet")
+
+// request is a read or write request
+type request struct {
+	opcode   uint16
+	filename string
+	mode     string
+	options  map[string]string
+}
+
+// parseRequest reads an RRQ or WRQ packet. Option names are lowercased.
+func parseRequest(b []byte) (*request, error) {
+	if len(b) < 2 {
+		return nil, errMalformed
+	}
+	req := &request{opcode: binary.BigEndian.Uint16(b), options: map[string]string{}}
+	fields := bytes.Split(b[2:], []byte{0})
+	// A well-formed packet ends with a NUL, leaving an empty last field
+	if len(fields) < 3 || len(fields[len(fields)-1]) != 0 {
+		return nil, errMalformed
+	}
+	fields = fields[:len(fields)-1]
+
+	req.filename = string(fields[0])
+	req.mode = strings.ToLower(string(fields[1]))
+	for i := 2; i+1 < len(fields); i += 2 {
+		req.options[strings.ToLower(string(fields[i]))] = string(fields[i+1])
+	}
+	return req, nil
+}
+
+// negotiate picks the options the server accepts from a request. It
+// returns the accepted options to send in an OACK along with the block size
+// and timeout to use.
+func (req *request) negotiate(size int64) (accepted []string, blockSize, timeout int) {
+	blockSize = defaultBlockSize
+	for _, name := range []string{"blksize", "tsize", "timeout"} {
+		value, ok := req.options[name]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "blksize":
+			if n < minBlockSize {
+				continue
+			}
+			if n > maxBlockSize {
+				n = maxBlockSize
+			}
+			blockSize = n
+			accepted = append(accepted, name, strconv.Itoa(n))
+		case "tsize":
+			// Clients send 0 in a read request and expect the file size back
+			accepted = append(accepted, name, strconv.FormatInt(size, 10))
+		case "timeout":
+			if n < 1 || n > maxTimeout {
+				continue
+			}
+			timeout = n
+			accepted = append(accepted, name, value)
+		}
+	}
+	return accepted, blockSize, timeout
+}
+
+// dataPacket builds a DATA packet
+func dataPacket(block uint16, data []byte) []byte {
+	b := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(b, opDATA)
+	binary.BigEndian.PutUint16(b[2:], block)
+	return append(b, data...)
+}
+
+// oackPacket builds an option acknowledgement from name, value pairs
+func oackPacket(options []string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, opOACK)
+	for _, field := range options {
+		b = append(b, field...)
+		b = append(b, 0)
+	}
+	return b
+}
+
+// errorPacket builds an ERROR packet
+func errorPacket(code uint16, message string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, opERROR)
+	b = binary.BigEndian.AppendUint16(b, code)
+	b = append(b, message...)
+	return append(b, 0)
+}
+
+// parseAck reads the block number of an ACK packet. ok is false for any
+// other packet; an ERROR packet's message is returned as err.
+func parseAck(b []byte) (block uint16, ok bool, err error) {
+	if len(b) < 4 {
+		return 0, false, nil
+	}
+	switch binary.BigEndian.Uint16(b) {
+	case opACK:
+		return binary.BigEndian.Uint16(b[2:]), true, nil
+	case opERROR:
+		message := strings.TrimRight(string(b[4:]), "\x00")
+		return 0, false, errors.New("client error: " + message)
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,112 @@
+package tftp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// rrq builds a read request with name, value option pairs
+func rrq(filename, mode string, options ...string) []byte {
+	b := []byte{0, opRRQ}
+	for _, field := range append([]string{filename, mode}, options...) {
+		b = append(append(b, field...), 0)
+	}
+	return b
+}
+
+func TestParseRequest(t *testing.T) {
+	req, err := parseRequest(rrq("pxe/ipxe.efi", "OCTET", "BLKSIZE", "1428", "tsize", "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.opcode != opRRQ || req.filename != "pxe/ipxe.efi" || req.mode != "octet" {
+		t.Errorf("request = %+v", req)
+	}
+	want := map[string]string{"blksize": "1428", "tsize": "0"}
+	if !reflect.DeepEqual(req.options, want) {
+		t.Errorf("options = %v, want %v", req.options, want)
+	}
+
+	for name, packet := range map[string][]byte{
+		"empty":           {},
+		"opcode only":     {0, opRRQ},
+		"no mode":         append([]byte{0, opRRQ}, "file\x00"...),
+		"unterminated":    append([]byte{0, opRRQ}, "file\x00octet"...),
+		"no filename NUL": append([]byte{0, opRRQ}, "file"...),
+	} {
+		if _, err := parseRequest(packet); err == nil {
+			t.Errorf("%s: parsed a malformed request", name)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]string
+		accepted  []string
+		blockSize int
+		timeout   int
+	}{
+		{
+			name:      "no options",
+			blockSize: defaultBlockSize,
+		},
+		{
+			name:      "blksize and tsize",
+			options:   map[string]string{"blksize": "1428", "tsize": "0"},
+			accepted:  []string{"blksize", "1428", "tsize", "3000"},
+			blockSize: 1428,
+		},
+		{
+			name:      "blksize above the maximum is lowered",
+			options:   map[string]string{"blksize": "70000"},
+			accepted:  []string{"blksize", "65464"},
+			blockSize: maxBlockSize,
+		},
+		{
+			name:      "blksize below the minimum is ignored",
+			options:   map[string]string{"blksize": "4"},
+			blockSize: defaultBlockSize,
+		},
+		{
+			name:      "non-numeric values are ignored",
+			options:   map[string]string{"blksize": "big", "tsize": "?"},
+			blockSize: defaultBlockSize,
+		},
+		{
+			name:      "timeout",
+			options:   map[string]string{"timeout": "3"},
+			accepted:  []string{"timeout", "3"},
+			blockSize: defaultBlockSize,
+			timeout:   3,
+		},
+		{
+			name:      "timeout out of range is ignored",
+			options:   map[string]string{"timeout": "300"},
+			blockSize: defaultBlockSize,
+		},
+		{
+			name:      "unknown options are ignored",
+			options:   map[string]string{"windowsize": "4", "tsize": "0"},
+			accepted:  []string{"tsize", "3000"},
+			blockSize: defaultBlockSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &request{opcode: opRRQ, options: tt.options}
+			accepted, blockSize, timeout := req.negotiate(3000)
+			if !reflect.DeepEqual(accepted, tt.accepted) {
+				t.Errorf("accepted = %q, want %q", accepted, tt.accepted)
+			}
+			if blockSize != tt.blockSize {
+				t.Errorf("block size = %d, want %d", blockSize, tt.blockSize)
+			}
+			if timeout != tt.timeout {
+				t.Errorf("timeout = %d, want %d", timeout, tt.timeout)
+			}
+		})
+	}
+}
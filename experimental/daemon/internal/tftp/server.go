@@ -0,0 +1,248 @@
+package tftp
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wild-cloud-central/internal/config"
+)
+
+const (
+	// defaultTimeout is how long to wait for an ACK before resending
+	defaultTimeout = time.Second
+
+	// maxRetries is how often a packet is resent before giving up
+	maxRetries = 5
+
+	// maxTransfers is how many finished transfers Transfers remembers
+	maxTransfers = 100
+)
+
+// Transfer records one file sent, or not sent, to a client
+type Transfer struct {
+	Client    string    `json:"client"`
+	File      string    `json:"file"`
+	Bytes     int64     `json:"bytes"`
+	BlockSize int       `json:"blockSize"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Server serves the files under a root directory over TFTP. Writes are
+// refused. The root can be changed at any time; transfers in progress keep
+// the file they opened.
+type Server struct {
+	root atomic.Pointer[string]
+
+	mu     sync.Mutex
+	listen string
+	conn   *net.UDPConn
+
+	transfersMu sync.Mutex
+	transfers   []Transfer
+}
+
+// NewServer creates a stopped server
+func NewServer() *Server {
+	s := &Server{}
+	s.SetRoot("")
+	return s
+}
+
+// SetRoot changes the directory files are served from
+func (s *Server) SetRoot(root string) {
+	s.root.Store(&root)
+}
+
+// Root returns the directory files are served from
+func (s *Server) Root() string {
+	return *s.root.Load()
+}
+
+// Update serves root and starts, stops or moves the listener to match the
+// cloud.tftp.server settings of cfg
+func (s *Server) Update(cfg *config.Config, root string) error {
+	s.SetRoot(root)
+
+	var listen string
+	if cfg.Cloud.TFTP.Server.Enabled {
+		listen = cfg.TFTPListenAddress()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if listen == s.listen {
+		return nil
+	}
+	s.stopLocked()
+	if listen == "" {
+		return nil
+	}
+	return s.startLocked(listen)
+}
+
+// Start listens on addr, replacing any earlier listener. A port of 0 picks a
+// free port; see Addr.
+func (s *Server) Start(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+	return s.startLocked(addr)
+}
+
+// Stop closes the listener. Transfers in progress run to completion.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+}
+
+// Addr returns the address the server listens on, or "" if it is stopped
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return ""
+	}
+	return s.conn.LocalAddr().String()
+}
+
+// Transfers returns the most recent transfers, oldest first
+func (s *Server) Transfers() []Transfer {
+	s.transfersMu.Lock()
+	defer s.transfersMu.Unlock()
+	return append([]Transfer{}, s.transfers...)
+}
+
+// startLocked opens the listener. s.mu must be held.
+func (s *Server) startLocked(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("starting TFTP server: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("starting TFTP server: %w", err)
+	}
+
+	s.listen, s.conn = addr, conn
+	go s.serve(conn)
+	slog.Info("TFTP server listening", "addr", conn.LocalAddr(), "root", s.Root())
+	return nil
+}
+
+// stopLocked closes the listener. s.mu must be held.
+func (s *Server) stopLocked() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	slog.Info("TFTP server stopped", "addr", s.conn.LocalAddr())
+	s.listen, s.conn = "", nil
+}
+
+// serve handles each request in its own goroutine until conn is closed
+func (s *Server) serve(conn *net.UDPConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, client, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("TFTP server", "error", err)
+			continue
+		}
+
+		packet := append([]byte(nil), buf[:n]...)
+		local := conn.LocalAddr().(*net.UDPAddr).IP
+		go s.handle(conn, local, client, packet)
+	}
+}
+
+// handle answers a request. Refusals go out from the listening port;
+// transfers get a port of their own, as the protocol requires.
+func (s *Server) handle(listener *net.UDPConn, local net.IP, client *net.UDPAddr, packet []byte) {
+	req, err := parseRequest(packet)
+	if err != nil {
+		listener.WriteToUDP(errorPacket(errIllegalOp, err.Error()), client)
+		return
+	}
+	switch {
+	case req.opcode == opWRQ:
+		listener.WriteToUDP(errorPacket(errAccessViolation, "server is read-only"), client)
+		slog.Warn("TFTP: refused write", "file", req.filename, "client", client.IP)
+		s.record(Transfer{Client: client.IP.String(), File: req.filename, Started: time.Now(), Finished: time.Now(), Error: "write refused"})
+		return
+	case req.opcode != opRRQ:
+		listener.WriteToUDP(errorPacket(errIllegalOp, "expected a read request"), client)
+		return
+	case req.mode != "octet" && req.mode != "netascii":
+		listener.WriteToUDP(errorPacket(errIllegalOp, "unsupported mode "+req.mode), client)
+		return
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: local})
+	if err != nil {
+		slog.Error("TFTP server", "error", err)
+		listener.WriteToUDP(errorPacket(errNotDefined, "server error"), client)
+		return
+	}
+	defer conn.Close()
+
+	t := &transfer{conn: conn, client: client, timeout: defaultTimeout}
+	record := Transfer{Client: client.IP.String(), File: req.filename, Started: time.Now()}
+	record.Bytes, record.BlockSize, err = t.send(s.Root(), req)
+	record.Finished = time.Now()
+	if err != nil {
+		record.Error = err.Error()
+		slog.Warn("TFTP: transfer failed", "file", record.File, "client", record.Client, "bytes", record.Bytes, "error", err)
+	} else {
+		slog.Debug("TFTP: sent file", "file", record.File, "bytes", record.Bytes, "blksize", record.BlockSize, "client", record.Client, "duration", record.Finished.Sub(record.Started).Round(time.Millisecond))
+	}
+	s.record(record)
+}
+
+// record remembers a finished transfer
+func (s *Server) record(t Transfer) {
+	s.transfersMu.Lock()
+	defer s.transfersMu.Unlock()
+	s.transfers = append(s.transfers, t)
+	if len(s.transfers) > maxTransfers {
+		s.transfers = s.transfers[len(s.transfers)-maxTransfers:]
+	}
+}
+
+// resolve maps a requested filename to a file under root. Backslashes are
+// accepted as separators and the name can never leave root.
+func resolve(root, filename string) string {
+	name := path.Clean("/" + strings.ReplaceAll(filename, "\\", "/"))
+	return filepath.Join(root, filepath.FromSlash(name))
+}
+
+// openFile opens a regular file for a transfer
+func openFile(root, filename string) (*os.File, int64, error) {
+	if root == "" {
+		return nil, 0, os.ErrNotExist
+	}
+	f, err := os.Open(resolve(root, filename))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, 0, os.ErrNotExist
+	}
+	return f, info.Size(), nil
+}
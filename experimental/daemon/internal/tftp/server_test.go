@@ -0,0 +1,223 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveStaysInRoot(t *testing.T) {
+	root := filepath.FromSlash("/srv/tftp")
+	tests := map[string]string{
+		"ipxe.efi":                "/srv/tftp/ipxe.efi",
+		"/ipxe.efi":               "/srv/tftp/ipxe.efi",
+		"pxe/ipxe.efi":            "/srv/tftp/pxe/ipxe.efi",
+		`pxe\ipxe.efi`:            "/srv/tftp/pxe/ipxe.efi",
+		"../etc/passwd":           "/srv/tftp/etc/passwd",
+		"/../../etc/passwd":       "/srv/tftp/etc/passwd",
+		`..\..\etc\passwd`:        "/srv/tftp/etc/passwd",
+		"pxe/../../etc/passwd":    "/srv/tftp/etc/passwd",
+		"pxe/./../ipxe.efi":       "/srv/tftp/ipxe.efi",
+		"..":                      "/srv/tftp",
+		"":                        "/srv/tftp",
+		"pxe//..//..//..//shadow": "/srv/tftp/shadow",
+	}
+	for filename, want := range tests {
+		if got := resolve(root, filename); got != filepath.FromSlash(want) {
+			t.Errorf("resolve(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+// tftpClient is a minimal TFTP client for the tests
+type tftpClient struct {
+	t      *testing.T
+	conn   *net.UDPConn
+	server *net.UDPAddr
+}
+
+func newClient(t *testing.T, addr string) *tftpClient {
+	t.Helper()
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &tftpClient{t: t, conn: conn, server: server}
+}
+
+// read receives a packet and remembers the transfer port it came from
+func (c *tftpClient) read() []byte {
+	c.t.Helper()
+	buf := make([]byte, 65535)
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, from, err := c.conn.ReadFromUDP(buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.server = from
+	return buf[:n]
+}
+
+func (c *tftpClient) send(packet []byte) {
+	c.t.Helper()
+	if _, err := c.conn.WriteToUDP(packet, c.server); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *tftpClient) ack(block uint16) {
+	c.send([]byte{0, opACK, byte(block >> 8), byte(block)})
+}
+
+// download requests filename with options and returns the options the
+// server acknowledged, the size of each DATA block and the file contents
+func (c *tftpClient) download(filename string, options ...string) (map[string]string, []int, []byte) {
+	c.t.Helper()
+	c.send(rrq(filename, "octet", options...))
+
+	var acked map[string]string
+	var sizes []int
+	var content []byte
+	packet := c.read()
+	if binary.BigEndian.Uint16(packet) == opOACK {
+		acked = map[string]string{}
+		fields := bytes.Split(packet[2:], []byte{0})
+		for i := 0; i+1 < len(fields); i += 2 {
+			acked[string(fields[i])] = string(fields[i+1])
+		}
+		c.ack(0)
+		packet = c.read()
+	}
+
+	blockSize := defaultBlockSize
+	if size, ok := acked["blksize"]; ok {
+		var err error
+		if blockSize, err = strconv.Atoi(size); err != nil {
+			c.t.Fatalf("OACK blksize %q: %v", size, err)
+		}
+	}
+	for expected := uint16(1); ; expected++ {
+		switch binary.BigEndian.Uint16(packet) {
+		case opDATA:
+		case opERROR:
+			c.t.Fatalf("server error %d: %s", binary.BigEndian.Uint16(packet[2:]), strings.TrimRight(string(packet[4:]), "\x00"))
+		default:
+			c.t.Fatalf("unexpected packet %v", packet)
+		}
+		if block := binary.BigEndian.Uint16(packet[2:]); block != expected {
+			c.t.Fatalf("got block %d, want %d", block, expected)
+		}
+		data := packet[4:]
+		sizes = append(sizes, len(data))
+		content = append(content, data...)
+		c.ack(expected)
+		if len(data) < blockSize {
+			return acked, sizes, content
+		}
+		packet = c.read()
+	}
+}
+
+// startTestServer serves a root holding pxe/ipxe.efi of size bytes on a
+// free loopback port
+func startTestServer(t *testing.T, size int) (*Server, []byte) {
+	t.Helper()
+	root := t.TempDir()
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "pxe"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "pxe", "ipxe.efi"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer()
+	s.SetRoot(root)
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	return s, content
+}
+
+func TestTransferNegotiatesBlockSizeAndSize(t *testing.T) {
+	s, content := startTestServer(t, 2500)
+	c := newClient(t, s.Addr())
+
+	acked, sizes, got := c.download("pxe/ipxe.efi", "blksize", "1024", "tsize", "0")
+	if acked["blksize"] != "1024" || acked["tsize"] != "2500" {
+		t.Errorf("OACK = %v, want blksize 1024 and tsize 2500", acked)
+	}
+	if want := []int{1024, 1024, 452}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("block sizes = %v, want %v", sizes, want)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs from the file")
+	}
+}
+
+func TestTransferWithoutOptions(t *testing.T) {
+	// A file that is a multiple of the block size ends with an empty block
+	s, content := startTestServer(t, 1024)
+	c := newClient(t, s.Addr())
+
+	acked, sizes, got := c.download(`\pxe\ipxe.efi`)
+	if acked != nil {
+		t.Errorf("got an OACK %v for a request without options", acked)
+	}
+	if want := []int{512, 512, 0}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("block sizes = %v, want %v", sizes, want)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs from the file")
+	}
+}
+
+func TestTransferRefusals(t *testing.T) {
+	s, _ := startTestServer(t, 10)
+	outside := filepath.Join(filepath.Dir(s.Root()), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		code   uint16
+	}{
+		{"escape with ..", rrq("../secret", "octet"), errFileNotFound},
+		{"escape with backslashes", rrq(`..\secret`, "octet"), errFileNotFound},
+		{"directory", rrq("pxe", "octet"), errFileNotFound},
+		{"missing file", rrq("pxe/missing", "octet"), errFileNotFound},
+		{"write", append([]byte{0, opWRQ}, "pxe/ipxe.efi\x00octet\x00"...), errAccessViolation},
+		{"mail mode", rrq("pxe/ipxe.efi", "mail"), errIllegalOp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(t, s.Addr())
+			c.send(tt.packet)
+			packet := c.read()
+			if op := binary.BigEndian.Uint16(packet); op != opERROR {
+				t.Fatalf("opcode = %d, want ERROR", op)
+			}
+			if code := binary.BigEndian.Uint16(packet[2:]); code != tt.code {
+				t.Errorf("error code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
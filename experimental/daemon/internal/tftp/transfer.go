@@ -0,0 +1,97 @@
+package tftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// transfer sends one file to one client from a dedicated port
+type transfer struct {
+	conn    *net.UDPConn
+	client  *net.UDPAddr
+	timeout time.Duration
+}
+
+// send negotiates options and sends the requested file. It returns the
+// number of bytes the client acknowledged and the block size used.
+func (t *transfer) send(root string, req *request) (int64, int, error) {
+	f, size, err := openFile(root, req.filename)
+	if err != nil {
+		code, message := uint16(errFileNotFound), "file not found"
+		if errors.Is(err, os.ErrPermission) {
+			code, message = errAccessViolation, "access denied"
+		}
+		t.conn.WriteToUDP(errorPacket(code, message), t.client)
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	accepted, blockSize, timeout := req.negotiate(size)
+	if timeout > 0 {
+		t.timeout = time.Duration(timeout) * time.Second
+	}
+	if len(accepted) > 0 {
+		// The client acknowledges the options with an ACK of block 0
+		if err := t.exchange(oackPacket(accepted), 0); err != nil {
+			return 0, blockSize, err
+		}
+	}
+
+	var sent int64
+	buf := make([]byte, blockSize)
+	for block := uint16(1); ; block++ {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.conn.WriteToUDP(errorPacket(errNotDefined, "read error"), t.client)
+			return sent, blockSize, err
+		}
+		if err := t.exchange(dataPacket(block, buf[:n]), block); err != nil {
+			return sent, blockSize, err
+		}
+		sent += int64(n)
+		// A short block ends the transfer
+		if n < blockSize {
+			return sent, blockSize, nil
+		}
+	}
+}
+
+// exchange sends a packet and waits for the client to acknowledge block,
+// resending on timeout. Duplicate ACKs are ignored rather than answered so
+// delayed packets cannot double the traffic.
+func (t *transfer) exchange(packet []byte, block uint16) error {
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if _, err := t.conn.WriteToUDP(packet, t.client); err != nil {
+			return err
+		}
+
+		t.conn.SetReadDeadline(time.Now().Add(t.timeout))
+		for {
+			n, from, err := t.conn.ReadFromUDP(buf)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if !from.IP.Equal(t.client.IP) || from.Port != t.client.Port {
+				t.conn.WriteToUDP(errorPacket(errUnknownTID, "unknown transfer ID"), from)
+				continue
+			}
+
+			acked, ok, err := parseAck(buf[:n])
+			if err != nil {
+				return err
+			}
+			if ok && acked == block {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("timed out waiting for the client to acknowledge block %d", block)
+}
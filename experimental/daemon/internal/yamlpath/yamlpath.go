@@ -0,0 +1,451 @@
+// Package yamlpath reads and writes values in YAML documents using the dotted
+// key paths understood by wild-config and wild-secret, such as
+// "cluster.nodes.talos.version" or "services[0].name".
+//
+// Map keys that themselves contain dots can be written in three ways:
+// quoted ("cluster.nodes.active.\"192.168.8.21\".disk"), bracketed
+// ("cluster.nodes.active[\"192.168.8.21\"].disk") or bare. Bare IPv4
+// addresses are always treated as a single key, and other bare keys are
+// matched greedily against the keys that already exist in the document.
+package yamlpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotFound is returned when a path does not exist in the document
+var ErrNotFound = errors.New("path not found")
+
+// Segment is one step of a parsed path
+type Segment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+	Quoted  bool
+}
+
+// Parse splits a dotted path into segments
+func Parse(path string) ([]Segment, error) {
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var segments []Segment
+	for i := 0; i < len(path); {
+		switch c := path[i]; {
+		case c == '.':
+			i++
+			if i == len(path) || path[i] == '.' {
+				return nil, fmt.Errorf("invalid path %q: empty key", path)
+			}
+		case c == '"':
+			key, n, err := readQuoted(path[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %w", path, err)
+			}
+			segments = append(segments, Segment{Key: key, Quoted: true})
+			i += n
+		case c == '[':
+			end := strings.IndexByte(path[i:], ']')
+			inner := ""
+			if end > 0 {
+				inner = path[i+1 : i+end]
+			}
+			if strings.HasPrefix(inner, `"`) {
+				key, n, err := readQuoted(path[i+1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: %w", path, err)
+				}
+				if i+1+n >= len(path) || path[i+1+n] != ']' {
+					return nil, fmt.Errorf("invalid path %q: unterminated [", path)
+				}
+				segments = append(segments, Segment{Key: key, Quoted: true})
+				i += n + 2
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if end < 0 || err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path %q: bad index [%s]", path, inner)
+			}
+			segments = append(segments, Segment{Index: index, IsIndex: true})
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], `.["`)
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, Segment{Key: path[i : i+end]})
+			i += end
+		}
+	}
+
+	return joinIPv4Keys(segments), nil
+}
+
+// readQuoted reads a double-quoted key at the start of s, returning the key
+// and the number of bytes consumed
+func readQuoted(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			key, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, err
+			}
+			return key, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quote")
+}
+
+// joinIPv4Keys merges four consecutive bare octet segments into a single key
+// so node IPs such as cluster.nodes.active.192.168.8.21 address one entry
+func joinIPv4Keys(segments []Segment) []Segment {
+	var out []Segment
+	for i := 0; i < len(segments); i++ {
+		if i+3 < len(segments) && isOctet(segments[i]) && isOctet(segments[i+1]) &&
+			isOctet(segments[i+2]) && isOctet(segments[i+3]) {
+			out = append(out, Segment{Key: segments[i].Key + "." + segments[i+1].Key + "." +
+				segments[i+2].Key + "." + segments[i+3].Key})
+			i += 3
+			continue
+		}
+		out = append(out, segments[i])
+	}
+	return out
+}
+
+func isOctet(s Segment) bool {
+	if s.IsIndex || s.Quoted || s.Key == "" || len(s.Key) > 3 {
+		return false
+	}
+	n, err := strconv.Atoi(s.Key)
+	return err == nil && n >= 0 && n <= 255 && strconv.Itoa(n) == s.Key
+}
+
+// root returns the top-level node of a document
+func root(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+// Get returns the node at path along with the keys it resolved to
+func Get(doc *yaml.Node, path string) (*yaml.Node, []string, error) {
+	segments, err := Parse(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := root(doc)
+	var resolved []string
+	for i := 0; i < len(segments); {
+		next, key, consumed := step(current, segments[i:])
+		if next == nil {
+			return nil, nil, ErrNotFound
+		}
+		current = next
+		resolved = append(resolved, key)
+		i += consumed
+	}
+	return current, resolved, nil
+}
+
+// Set stores value at path, creating intermediate mappings as needed, and
+// returns the keys the path resolved to
+func Set(doc *yaml.Node, path string, value *yaml.Node) ([]string, error) {
+	segments, err := Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := root(doc)
+	var resolved []string
+	for i := 0; i < len(segments); {
+		next, key, consumed := step(current, segments[i:])
+		last := i+consumed == len(segments)
+
+		if next == nil {
+			seg := segments[i]
+			switch {
+			case seg.IsIndex:
+				if current.Kind != yaml.SequenceNode || seg.Index != len(current.Content) {
+					return nil, fmt.Errorf("cannot set %s: index %d out of range", path, seg.Index)
+				}
+				next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				current.Content = append(current.Content, next)
+				key = strconv.Itoa(seg.Index)
+			case current.Kind == yaml.MappingNode || isNull(current):
+				if isNull(current) {
+					*current = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				}
+				next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				current.Content = append(current.Content,
+					&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: seg.Key}, next)
+				key = seg.Key
+			default:
+				return nil, fmt.Errorf("cannot set %s: %s is not a mapping", path, strings.Join(resolved, "."))
+			}
+			consumed = 1
+			last = i+1 == len(segments)
+		}
+
+		resolved = append(resolved, key)
+		if last {
+			head, line := next.HeadComment, next.LineComment
+			*next = *value
+			next.HeadComment, next.LineComment = head, line
+			return resolved, nil
+		}
+		current = next
+		i += consumed
+	}
+	return resolved, nil
+}
+
+// Delete removes the value at path and returns the keys it resolved to
+func Delete(doc *yaml.Node, path string) ([]string, error) {
+	segments, err := Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := root(doc)
+	var resolved []string
+	for i := 0; i < len(segments); {
+		next, key, consumed := step(current, segments[i:])
+		if next == nil {
+			return nil, ErrNotFound
+		}
+		resolved = append(resolved, key)
+
+		if i+consumed == len(segments) {
+			for j := 0; j < len(current.Content); j++ {
+				if current.Content[j] != next {
+					continue
+				}
+				if current.Kind == yaml.MappingNode {
+					current.Content = append(current.Content[:j-1], current.Content[j+1:]...)
+				} else {
+					current.Content = append(current.Content[:j], current.Content[j+1:]...)
+				}
+				return resolved, nil
+			}
+		}
+		current = next
+		i += consumed
+	}
+	return nil, ErrNotFound
+}
+
+// Update rewrites the document so it holds value, a decoded JSON value.
+// Nodes whose value does not change are left alone, so their comments,
+// style and key order survive; new keys are appended in sorted order.
+func Update(doc *yaml.Node, value interface{}) error {
+	return update(root(doc), value)
+}
+
+func update(node *yaml.Node, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		var content []*yaml.Node
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			item, ok := v[key]
+			if !ok || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := update(node.Content[i+1], item); err != nil {
+				return err
+			}
+			content = append(content, node.Content[i], node.Content[i+1])
+		}
+		var added []string
+		for key := range v {
+			if !seen[key] {
+				added = append(added, key)
+			}
+		}
+		sort.Strings(added)
+		for _, key := range added {
+			child, err := FromValue(v[key])
+			if err != nil {
+				return err
+			}
+			content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		}
+		node.Content = content
+		return nil
+	case []interface{}:
+		if node.Kind != yaml.SequenceNode {
+			break
+		}
+		for i, item := range v {
+			if i < len(node.Content) {
+				if err := update(node.Content[i], item); err != nil {
+					return err
+				}
+				continue
+			}
+			child, err := FromValue(item)
+			if err != nil {
+				return err
+			}
+			node.Content = append(node.Content, child)
+		}
+		node.Content = node.Content[:len(v)]
+		return nil
+	}
+
+	if sameValue(node, value) {
+		return nil
+	}
+	replacement, err := FromValue(value)
+	if err != nil {
+		return err
+	}
+	head, line := node.HeadComment, node.LineComment
+	*node = *replacement
+	node.HeadComment, node.LineComment = head, line
+	return nil
+}
+
+// sameValue reports whether node already holds value, comparing their JSON
+// encodings so that 1 and 1.0 or a timestamp and its string are equal
+func sameValue(node *yaml.Node, value interface{}) bool {
+	current, err := ToValue(node)
+	if err != nil {
+		return false
+	}
+	a, err := json.Marshal(current)
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(value)
+	return err == nil && bytes.Equal(a, b)
+}
+
+// step resolves the first segment (or, for bare keys, the longest run of
+// segments forming an existing dotted key) against node. It returns the
+// child node, its key and the number of segments consumed.
+func step(node *yaml.Node, segments []Segment) (*yaml.Node, string, int) {
+	seg := segments[0]
+
+	if seg.IsIndex {
+		if node.Kind != yaml.SequenceNode || seg.Index >= len(node.Content) {
+			return nil, "", 1
+		}
+		return node.Content[seg.Index], strconv.Itoa(seg.Index), 1
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, "", 1
+	}
+
+	// Count the bare keys that could be joined into one dotted key
+	run := 1
+	if !seg.Quoted {
+		for run < len(segments) && !segments[run].IsIndex && !segments[run].Quoted {
+			run++
+		}
+	}
+
+	for n := run; n >= 1; n-- {
+		keys := make([]string, n)
+		for i := range keys {
+			keys[i] = segments[i].Key
+		}
+		key := strings.Join(keys, ".")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1], key, n
+			}
+		}
+	}
+	return nil, seg.Key, 1
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// ToValue decodes a node into plain Go values suitable for JSON encoding
+func ToValue(node *yaml.Node) (interface{}, error) {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return normalize(value), nil
+}
+
+// normalize converts maps with non-string keys into string-keyed maps
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalize(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[fmt.Sprint(key)] = normalize(item)
+		}
+		return out
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// FromValue encodes a decoded JSON value as a YAML node. Whole numbers are
+// written as integers rather than floats.
+func FromValue(value interface{}) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(integerize(value)); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+func integerize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+		return v
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = integerize(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = integerize(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,312 @@
+package yamlpath
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testDocument = `cluster:
+  nodes:
+    active:
+      192.168.8.31:
+        role: controlplane # first node
+      node.local:
+        role: worker
+  a.b: dotted
+  a:
+    b: nested
+services:
+  - name: dns
+  - name: tftp
+`
+
+func parseDoc(t *testing.T, content string) *yaml.Node {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return &doc
+}
+
+func encodeDoc(t *testing.T, doc *yaml.Node) string {
+	t.Helper()
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		t.Fatal(err)
+	}
+	encoder.Close()
+	return buf.String()
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		path     string
+		value    interface{}
+		resolved []string
+	}{
+		{
+			path:     "cluster.nodes.active.192.168.8.31.role",
+			value:    "controlplane",
+			resolved: []string{"cluster", "nodes", "active", "192.168.8.31", "role"},
+		},
+		{
+			path:     `cluster.nodes.active."node.local".role`,
+			value:    "worker",
+			resolved: []string{"cluster", "nodes", "active", "node.local", "role"},
+		},
+		{
+			path:     `cluster.nodes.active["node.local"].role`,
+			value:    "worker",
+			resolved: []string{"cluster", "nodes", "active", "node.local", "role"},
+		},
+		{
+			// Bare keys are joined into the dotted key that exists
+			path:     "cluster.nodes.active.node.local.role",
+			value:    "worker",
+			resolved: []string{"cluster", "nodes", "active", "node.local", "role"},
+		},
+		{
+			// With both a dotted key and a nested path, the longer key wins
+			path:     "cluster.a.b",
+			value:    "dotted",
+			resolved: []string{"cluster", "a.b"},
+		},
+		{
+			path:     `cluster.a."b"`,
+			value:    "nested",
+			resolved: []string{"cluster", "a", "b"},
+		},
+		{
+			path:     ".services[1].name",
+			value:    "tftp",
+			resolved: []string{"services", "1", "name"},
+		},
+	}
+
+	doc := parseDoc(t, testDocument)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			node, resolved, err := Get(doc, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := ToValue(node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != tt.value {
+				t.Errorf("value = %v, want %v", value, tt.value)
+			}
+			if !reflect.DeepEqual(resolved, tt.resolved) {
+				t.Errorf("resolved = %q, want %q", resolved, tt.resolved)
+			}
+		})
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	doc := parseDoc(t, testDocument)
+	for _, path := range []string{"cluster.missing", "services[2].name", "services.name", "cluster.a.b.c"} {
+		if _, _, err := Get(doc, path); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrNotFound", path, err)
+		}
+	}
+	for _, path := range []string{"", "cluster..a", "cluster.", `cluster."a`, "services[x]", "services[-1]", `cluster["a"`} {
+		if _, _, err := Get(doc, path); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want a path error", path, err)
+		}
+	}
+}
+
+func TestParseJoinsIPv4Keys(t *testing.T) {
+	tests := map[string][]Segment{
+		"a.10.0.0.1.b": {{Key: "a"}, {Key: "10.0.0.1"}, {Key: "b"}},
+		"a.1.2.3":      {{Key: "a"}, {Key: "1"}, {Key: "2"}, {Key: "3"}},
+		"a.1.2.3.256":  {{Key: "a"}, {Key: "1"}, {Key: "2"}, {Key: "3"}, {Key: "256"}},
+		"a.01.2.3.4":   {{Key: "a"}, {Key: "01"}, {Key: "2"}, {Key: "3"}, {Key: "4"}},
+		`a."1".2.3.4`:  {{Key: "a"}, {Key: "1", Quoted: true}, {Key: "2"}, {Key: "3"}, {Key: "4"}},
+	}
+	for path, want := range tests {
+		got, err := Parse(path)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", path, got, want)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		path     string
+		value    interface{}
+		resolved []string
+		want     string
+	}{
+		{
+			name:     "creates intermediate maps",
+			doc:      "a: 1\n",
+			path:     "b.c.d",
+			value:    "x",
+			resolved: []string{"b", "c", "d"},
+			want:     "a: 1\nb:\n  c:\n    d: x\n",
+		},
+		{
+			name:     "replaces a null with a map",
+			doc:      "a:\n",
+			path:     "a.b",
+			value:    2,
+			resolved: []string{"a", "b"},
+			want:     "a:\n  b: 2\n",
+		},
+		{
+			name:     "keeps the comment of a replaced value",
+			doc:      "a: 1 # one\n",
+			path:     "a",
+			value:    2,
+			resolved: []string{"a"},
+			want:     "a: 2 # one\n",
+		},
+		{
+			name:     "creates an IPv4 key",
+			doc:      "nodes:\n  other: 1\n",
+			path:     "nodes.192.168.8.31.role",
+			value:    "worker",
+			resolved: []string{"nodes", "192.168.8.31", "role"},
+			want:     "nodes:\n  other: 1\n  192.168.8.31:\n    role: worker\n",
+		},
+		{
+			name:     "appends to a sequence",
+			doc:      "s:\n  - a\n",
+			path:     "s[1].name",
+			value:    "b",
+			resolved: []string{"s", "1", "name"},
+			want:     "s:\n  - a\n  - name: b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseDoc(t, tt.doc)
+			value, err := FromValue(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolved, err := Set(doc, tt.path, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resolved, tt.resolved) {
+				t.Errorf("resolved = %q, want %q", resolved, tt.resolved)
+			}
+			if got := encodeDoc(t, doc); got != tt.want {
+				t.Errorf("document =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	value, err := FromValue("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"cluster.a.b.c", "services[5].name", "services.name"} {
+		doc := parseDoc(t, testDocument)
+		if _, err := Set(doc, path, value); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", path)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		path string
+		want string
+	}{
+		{name: "a key", doc: "a: 1\nb: 2\n", path: "a", want: "b: 2\n"},
+		{name: "the last key of a map", doc: "a:\n  b: 1\n", path: "a.b", want: "a: {}\n"},
+		{name: "the last key of the document", doc: "a: 1\n", path: "a", want: "{}\n"},
+		{name: "a sequence element", doc: "s:\n  - a\n  - b\n", path: "s[0]", want: "s:\n  - b\n"},
+		{name: "an IPv4 key", doc: "n:\n  10.0.0.1: x\n  10.0.0.2: y\n", path: "n.10.0.0.1", want: "n:\n  10.0.0.2: y\n"},
+		{name: "a dotted key before a nested one", doc: "a.b: 1\na:\n  b: 2\n", path: "a.b", want: "a:\n  b: 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseDoc(t, tt.doc)
+			if _, err := Delete(doc, tt.path); err != nil {
+				t.Fatal(err)
+			}
+			if got := encodeDoc(t, doc); got != tt.want {
+				t.Errorf("document =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	doc := parseDoc(t, testDocument)
+	if _, err := Delete(doc, "cluster.missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	doc := parseDoc(t, `# Config
+b: 1 # kept
+a:
+  keep: true # unchanged
+  drop: 2
+list:
+  - one
+  - two
+  - three
+`)
+	value := map[string]interface{}{
+		"b":    float64(1),
+		"a":    map[string]interface{}{"keep": true, "new": "x"},
+		"list": []interface{}{"one", "TWO"},
+		"c":    float64(2.5),
+	}
+	if err := Update(doc, value); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Config
+b: 1 # kept
+a:
+  keep: true # unchanged
+  new: x
+list:
+  - one
+  - TWO
+c: 2.5
+`
+	if got := encodeDoc(t, doc); got != want {
+		t.Errorf("document =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFromValueWritesWholeNumbersAsIntegers(t *testing.T) {
+	tests := map[float64]string{3: "!!int", 1.5: "!!float", -2: "!!int"}
+	for value, tag := range tests {
+		node, err := FromValue(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node.Tag != tag {
+			t.Errorf("FromValue(%v) tag = %s, want %s", value, node.Tag, tag)
+		}
+	}
+}
@@ -1,74 +1,240 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 
+	"wild-cloud-central/internal/command"
 	"wild-cloud-central/internal/config"
 	"wild-cloud-central/internal/handlers"
+	"wild-cloud-central/internal/secrets"
+	"wild-cloud-central/internal/service"
+	"wild-cloud-central/internal/settings"
 )
 
 func main() {
+	// Flags and WILD_* environment variables override the defaults
+	s, err := settings.Parse(os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	s.ConfigureLogging()
+
 	// Create application instance
 	app := handlers.NewApp()
+	app.Settings = s
+	app.DataManager.SetOverrides(s.Overrides())
 
 	// Initialize data directory
 	if err := app.DataManager.Initialize(); err != nil {
-		log.Fatalf("Failed to initialize data directory: %v", err)
+		slog.Error("Failed to initialize data directory", "error", err)
+		os.Exit(1)
 	}
 
-	// Load configuration if it exists
 	paths := app.DataManager.GetPaths()
-	if cfg, err := config.Load(paths.ConfigFile); err != nil {
-		log.Printf("No configuration found, starting with empty config: %v", err)
-	} else {
-		app.Config = cfg
-		log.Printf("Configuration loaded successfully")
-	}
+	s.ResolvePaths(paths)
 
-	// Set up HTTP router
-	router := mux.NewRouter()
-	setupRoutes(app, router)
+	// dnsmasq is shared by all instances, so its customizations are too
+	app.DnsmasqManager.TemplateFile = paths.DnsmasqTemplate
+	app.DnsmasqManager.SnippetsDir = paths.DnsmasqSnippetsDir
 
-	// Use default server settings if config is empty
-	host := "0.0.0.0"
-	port := 5055
-	if app.Config != nil && app.Config.Server.Host != "" {
-		host = app.Config.Server.Host
+	// The default instance uses the data directory itself; named instances
+	// live under its instances directory
+	instances := handlers.NewInstances(app)
+	if keyFile := s.SecretsKeyFile.Value; keyFile != "" {
+		instances.Setup = func(instance *handlers.App) {
+			unlockSecrets(instance.Secrets, keyFile)
+		}
 	}
-	if app.Config != nil && app.Config.Server.Port != 0 {
-		port = app.Config.Server.Port
+	if err := instances.Open(); err != nil {
+		slog.Error("Failed to open instances", "error", err)
+		os.Exit(1)
 	}
 
-	addr := fmt.Sprintf("%s:%d", host, port)
-	log.Printf("Starting wild-cloud-central server on %s", addr)
+	// The service manager is daemon-wide, so it comes from the default
+	// instance's config
+	var manager string
+	var configured map[string]config.ServiceConfig
+	if cfg := app.CurrentConfig(); cfg != nil {
+		manager, configured = cfg.Server.ServiceManager, cfg.Server.Services
+	}
+	services, err := service.New(manager, serviceDefinitions(configured, paths.DnsmasqConf), command.ExecRunner{})
+	if err != nil {
+		slog.Error("Failed to set up service manager", "error", err)
+		os.Exit(1)
+	}
+	app.Services = services
+	app.DnsmasqManager.Services = services
+	slog.Info("Service manager selected", "kind", services.Kind())
+	if supervisor, ok := services.(*service.Process); ok {
+		supervisor.StartAll(context.Background())
+	}
+
+	// Set up HTTP router
+	router := mux.NewRouter()
+	setupRoutes(instances, app, router)
+
+	// Fall back to the config's server settings, then the defaults
+	s.ResolveListen(app.CurrentConfig())
+	addr := s.Listen.Value
+	slog.Info("Starting wild-cloud-central server", "addr", addr)
 
 	if err := http.ListenAndServe(addr, router); err != nil {
-		log.Fatal("Server failed to start:", err)
+		slog.Error("Server failed to start", "error", err)
+		os.Exit(1)
 	}
 }
 
-func setupRoutes(app *handlers.App, router *mux.Router) {
+func setupRoutes(instances *handlers.Instances, app *handlers.App, router *mux.Router) {
 	// Add CORS middleware
 	router.Use(app.CORSMiddleware)
 	
-	// API v1 routes
+	// Daemon-wide routes
 	router.HandleFunc("/api/v1/health", app.HealthHandler).Methods("GET")
-	router.HandleFunc("/api/v1/config", app.GetConfigHandler).Methods("GET")
-	router.HandleFunc("/api/v1/config", app.UpdateConfigHandler).Methods("PUT")
-	router.HandleFunc("/api/v1/config", app.CreateConfigHandler).Methods("POST")
-	router.HandleFunc("/api/v1/config/yaml", app.GetConfigYamlHandler).Methods("GET")
-	router.HandleFunc("/api/v1/config/yaml", app.UpdateConfigYamlHandler).Methods("PUT")
-	router.HandleFunc("/api/v1/dnsmasq/config", app.GetDnsmasqConfigHandler).Methods("GET")
-	router.HandleFunc("/api/v1/dnsmasq/restart", app.RestartDnsmasqHandler).Methods("POST")
-	router.HandleFunc("/api/v1/pxe/assets", app.DownloadPXEAssetsHandler).Methods("POST")
+	router.HandleFunc("/api/v1/events", app.EventsHandler).Methods("GET")
+	router.HandleFunc("/api/v1/settings", app.GetSettingsHandler).Methods("GET")
+	router.HandleFunc("/api/v1/dns", app.GetDNSHandler).Methods("GET")
+	router.HandleFunc("/api/v1/tftp", app.GetTFTPHandler).Methods("GET")
+	router.HandleFunc("/api/v1/services", app.ListServicesHandler).Methods("GET")
+	router.HandleFunc("/api/v1/services/{name}", app.GetServiceHandler).Methods("GET")
+	router.HandleFunc("/api/v1/services/{name}/{action:start|stop|restart}", app.ServiceActionHandler).Methods("POST")
+	router.HandleFunc("/api/v1/instances", app.ListInstancesHandler).Methods("GET")
+	router.HandleFunc("/api/v1/instances", app.CreateInstanceHandler).Methods("POST")
+	router.HandleFunc("/api/v1/instances/{instance}", app.DeleteInstanceHandler).Methods("DELETE")
+	router.HandleFunc("/api/v1/instances/{instance}/activate", app.ActivateInstanceHandler).Methods("POST")
+
+	// Instance routes, addressed by name or without a prefix for the active instance
+	setupInstanceRoutes(router.PathPrefix("/api/v1/instances/{instance}").Subrouter(), instances.ResolveNamed)
+	setupInstanceRoutes(router.PathPrefix("/api/v1").Subrouter(), instances.ResolveActive)
 	
 	// UI-specific endpoints
-	router.HandleFunc("/api/status", app.StatusHandler).Methods("GET")
+	router.HandleFunc("/api/status", forInstance(instances.ResolveActive, (*handlers.App).StatusHandler)).Methods("GET")
 
 	// Serve static files
-	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
-}
\ No newline at end of file
+	router.PathPrefix("/").Handler(http.FileServer(http.Dir(app.Settings.StaticDir.Value)))
+}
+
+// instanceHandler is an App handler called on the instance a request addresses
+type instanceHandler func(*handlers.App, http.ResponseWriter, *http.Request)
+
+// resolver picks the instance a request addresses, writing an error response
+// and returning false if there is none
+type resolver func(http.ResponseWriter, *http.Request) (*handlers.App, bool)
+
+// forInstance adapts an App handler to serve the instance resolve picks
+func forInstance(resolve resolver, handler instanceHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app, ok := resolve(w, r); ok {
+			handler(app, w, r)
+		}
+	}
+}
+
+func setupInstanceRoutes(router *mux.Router, resolve resolver) {
+	handle := func(path string, handler instanceHandler) *mux.Route {
+		return router.HandleFunc(path, forInstance(resolve, handler))
+	}
+
+	handle("/config", (*handlers.App).GetConfigHandler).Methods("GET")
+	handle("/config", (*handlers.App).UpdateConfigHandler).Methods("PUT")
+	handle("/config", (*handlers.App).CreateConfigHandler).Methods("POST")
+	handle("/config", (*handlers.App).PatchConfigHandler).Methods("PATCH")
+	handle("/config/yaml", (*handlers.App).GetConfigYamlHandler).Methods("GET")
+	handle("/config/yaml", (*handlers.App).UpdateConfigYamlHandler).Methods("PUT")
+	handle("/config/values/{path}", (*handlers.App).GetConfigValueHandler).Methods("GET")
+	handle("/config/values/{path}", (*handlers.App).SetConfigValueHandler).Methods("PUT")
+	handle("/config/values/{path}", (*handlers.App).DeleteConfigValueHandler).Methods("DELETE")
+	handle("/config/migrations", (*handlers.App).GetMigrationsHandler).Methods("GET")
+	handle("/config/warnings", (*handlers.App).GetConfigWarningsHandler).Methods("GET")
+	handle("/config/revisions", (*handlers.App).ListRevisionsHandler).Methods("GET")
+	handle("/config/revisions/diff", (*handlers.App).DiffRevisionsHandler).Methods("GET")
+	handle("/config/revisions/{id:[0-9]+}", (*handlers.App).GetRevisionHandler).Methods("GET")
+	handle("/config/revisions/{id:[0-9]+}/rollback", (*handlers.App).RollbackRevisionHandler).Methods("POST")
+	handle("/secrets", (*handlers.App).ListSecretsHandler).Methods("GET")
+	handle("/secrets/unlock", (*handlers.App).UnlockSecretsHandler).Methods("POST")
+	handle("/secrets/lock", (*handlers.App).LockSecretsHandler).Methods("POST")
+	handle("/secrets/rotate", (*handlers.App).RotateSecretsKeyHandler).Methods("POST")
+	handle("/secrets/{path}", (*handlers.App).GetSecretHandler).Methods("GET")
+	handle("/secrets/{path}", (*handlers.App).SetSecretHandler).Methods("PUT")
+	handle("/secrets/{path}", (*handlers.App).DeleteSecretHandler).Methods("DELETE")
+	handle("/templates/render", (*handlers.App).RenderTemplateHandler).Methods("POST")
+	handle("/apps/secrets", (*handlers.App).ListAppSecretsHandler).Methods("GET")
+	handle("/apps/secrets/generate", (*handlers.App).GenerateAppSecretsHandler).Methods("POST")
+	handle("/apps/{name}/secrets", (*handlers.App).GetAppSecretsHandler).Methods("GET")
+	handle("/apps/{name}/secrets/generate", (*handlers.App).GenerateAppSecretsHandler).Methods("POST")
+	handle("/bundle", (*handlers.App).ExportBundleHandler).Methods("GET")
+	handle("/bundle", (*handlers.App).ImportBundleHandler).Methods("POST")
+	handle("/dhcp/leases", (*handlers.App).ListLeasesHandler).Methods("GET")
+	handle("/dhcp/reservations", (*handlers.App).ListReservationsHandler).Methods("GET")
+	handle("/dhcp/reservations", (*handlers.App).CreateReservationHandler).Methods("POST")
+	handle("/dhcp/reservations/{mac}", (*handlers.App).GetReservationHandler).Methods("GET")
+	handle("/dhcp/reservations/{mac}", (*handlers.App).UpdateReservationHandler).Methods("PUT")
+	handle("/dhcp/reservations/{mac}", (*handlers.App).DeleteReservationHandler).Methods("DELETE")
+	handle("/dns/records", (*handlers.App).ListDNSRecordsHandler).Methods("GET")
+	handle("/dns/records", (*handlers.App).CreateDNSRecordHandler).Methods("POST")
+	handle("/dns/records/{name}", (*handlers.App).GetDNSRecordsHandler).Methods("GET")
+	handle("/dns/records/{name}", (*handlers.App).ReplaceDNSRecordsHandler).Methods("PUT")
+	handle("/dns/records/{name}", (*handlers.App).DeleteDNSRecordsHandler).Methods("DELETE")
+	handle("/dnsmasq/config", (*handlers.App).GetDnsmasqConfigHandler).Methods("GET")
+	handle("/dnsmasq/diff", (*handlers.App).DiffDnsmasqConfigHandler).Methods("GET")
+	handle("/dnsmasq/apply", (*handlers.App).ApplyDnsmasqConfigHandler).Methods("POST")
+	handle("/dnsmasq/snippets", (*handlers.App).GetDnsmasqSnippetsHandler).Methods("GET")
+	handle("/dnsmasq/restart", (*handlers.App).RestartDnsmasqHandler).Methods("POST")
+	handle("/pxe/assets", (*handlers.App).DownloadPXEAssetsHandler).Methods("POST")
+	handle("/status", (*handlers.App).StatusHandler).Methods("GET")
+}
+
+// unlockSecrets unlocks encrypted secrets with the passphrase in keyFile.
+// Plaintext secrets are left as they are: encrypting them removes
+// secrets.yaml, which only the rotate endpoint should do.
+func unlockSecrets(store *secrets.Store, keyFile string) {
+	if !store.State().Encrypted {
+		slog.Warn("Secrets are not encrypted, so the key file is not used. Encrypt them with POST /api/v1/secrets/rotate.",
+			"file", store.Path(), "encryptedFile", store.EncryptedPath(), "keyFile", keyFile)
+		return
+	}
+
+	passphrase, err := secrets.ReadKeyFile(keyFile)
+	if err != nil {
+		slog.Warn("Secrets stay locked", "error", err)
+		return
+	}
+	if err := store.Unlock(passphrase); err != nil {
+		slog.Error("Failed to unlock secrets with key file", "file", keyFile, "error", err)
+		return
+	}
+	slog.Info("Secrets unlocked with key file", "file", keyFile)
+}
+
+// serviceDefinitions lists dnsmasq and the configured helper services.
+// dnsmasq runs from the generated config unless the config overrides it.
+func serviceDefinitions(configured map[string]config.ServiceConfig, dnsmasqConf string) []service.Definition {
+	defs := []service.Definition{{
+		Name:    service.Dnsmasq,
+		Command: []string{"dnsmasq", "--keep-in-foreground", "--conf-file=" + dnsmasqConf},
+	}}
+	for name, svc := range configured {
+		if name == service.Dnsmasq {
+			if svc.Unit != "" {
+				defs[0].Unit = svc.Unit
+			}
+			if len(svc.Command) > 0 {
+				defs[0].Command = svc.Command
+			}
+			continue
+		}
+		defs = append(defs, service.Definition{Name: name, Unit: svc.Unit, Command: svc.Command})
+	}
+	return defs
+}